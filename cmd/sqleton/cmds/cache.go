@@ -0,0 +1,131 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/cache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "List and clear the cached results of query commands",
+	Long: `Commands with a cache section, or run with --cache, cache their results
+in ~/.sqleton/cache.db, keyed by connection and rendered query.`,
+}
+
+type CacheLsCommand struct {
+	*cmds.CommandDescription
+}
+
+func (c *CacheLsCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	store, err := cache.Open(cache.DefaultPath())
+	if err != nil {
+		return err
+	}
+	defer func(store *cache.Store) {
+		_ = store.Close()
+	}(store)
+
+	entries, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		row := types.NewRow(
+			types.MRP("key", e.Key[:12]),
+			types.MRP("command", e.Command),
+			types.MRP("connection", e.Connection),
+			types.MRP("status", string(e.Status(now))),
+			types.MRP("created_at", e.CreatedAt.Local().Format("2006-01-02 15:04:05")),
+			types.MRP("expires_at", e.ExpiresAt.Local().Format("2006-01-02 15:04:05")),
+			types.MRP("rows", e.RowCount),
+			types.MRP("size", e.Size),
+			types.MRP("query", e.Query),
+		)
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewCacheLsCommand(options ...cmds.CommandDescriptionOption) (*CacheLsCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers(
+		settings.WithFieldsFiltersParameterLayerOptions(
+			layers.WithDefaults(
+				&settings.FieldsFilterFlagsDefaults{
+					Filter: []string{"query"},
+				},
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("List the cached results"),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &CacheLsCommand{
+		CommandDescription: cmds.NewCommandDescription("ls", options_...),
+	}, nil
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete cached results",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		command, _ := cmd.Flags().GetString("command")
+		expired, _ := cmd.Flags().GetBool("expired")
+
+		store, err := cache.Open(cache.DefaultPath())
+		cobra.CheckErr(err)
+		defer func(store *cache.Store) {
+			_ = store.Close()
+		}(store)
+
+		n, err := store.Clear(cmd.Context(), cache.ClearOptions{
+			Command:     command,
+			ExpiredOnly: expired,
+		})
+		cobra.CheckErr(err)
+		fmt.Printf("cleared %d cached results\n", n)
+	},
+}
+
+func init() {
+	lsCommand, err := NewCacheLsCommand()
+	if err != nil {
+		panic(err)
+	}
+	cobraLsCommand, err := cli.BuildCobraCommandFromGlazeCommand(lsCommand)
+	if err != nil {
+		panic(err)
+	}
+	CacheCmd.AddCommand(cobraLsCommand)
+
+	cacheClearCmd.Flags().String("command", "", "Only clear the results of the commands containing this string")
+	cacheClearCmd.Flags().Bool("expired", false, "Only clear the results that can't be used anymore")
+	CacheCmd.AddCommand(cacheClearCmd)
+}
@@ -0,0 +1,345 @@
+package cmds
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/assertions"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const checkLong = `Run query commands and check the assertions of their assert section,
+exiting with an error if one of them fails, for example for data quality checks in CI:
+
+  name: late-orders
+  short: Orders paid but not shipped after 3 days
+  assert:
+    - row_count == 0
+  query: |
+    SELECT id, paid_at FROM orders
+    WHERE status = 'paid' AND paid_at < DATE_SUB(NOW(), INTERVAL 3 DAY)
+
+Check a command, with its flags after --, every command with assertions with --all, or
+those of a group with --prefix:
+
+  sqleton check -- shop late-orders --days 5
+  sqleton check --prefix shop
+
+--assert adds assertions to the command, to check commands without assert section:
+
+  sqleton check --assert "every row: time < 60" -- mysql ps
+
+--assert can be repeated, and commas separate assertions, except in strings,
+which must use single quotes:
+
+  sqleton check --assert "row_count > 0" --assert "no row: status == 'paid, not shipped'" -- shop orders
+
+The assertions are:
+
+  row_count == 0                        number of rows
+  max(lag_seconds) < 30                 count, sum, avg, min or max of a column
+  every row: status != 'error'          all the rows match
+  any row: role == 'admin'              at least one row matches
+  no row: email is null                 none of the rows match
+
+with the operators ==, !=, <, <=, >, >=, is null and is not null, and the values
+numbers, 'strings', true, false and null. The aggregates of no rows are null, which fails
+the comparisons, use every row: lag_seconds < 30 for checks that should pass on no rows.
+
+Each assertion is output as a row with its status, pass, fail or error.
+`
+
+type CheckCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+	commands            []cmds.Command
+}
+
+type CheckSettings struct {
+	All     bool     `glazed.parameter:"all"`
+	Prefix  []string `glazed.parameter:"prefix"`
+	Assert  []string `glazed.parameter:"assert"`
+	Command []string `glazed.parameter:"command"`
+}
+
+// checkedCommand is a command to check, with its arguments and assertions.
+type checkedCommand struct {
+	name       string
+	command    *cmds2.SqlCommand
+	args       []string
+	assertions []*assertions.Assertion
+}
+
+func (c *CheckCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &CheckSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	checked, err := c.checkedCommands(s)
+	if err != nil {
+		return err
+	}
+
+	total, failed := 0, 0
+	for _, cc := range checked {
+		results, err := c.check(ctx, parsedLayers, cc)
+		if err != nil {
+			// the other commands are still checked
+			total++
+			failed++
+			row := types.NewRow(
+				types.MRP("command", cc.name),
+				types.MRP("assertion", ""),
+				types.MRP("status", string(assertions.StatusError)),
+				types.MRP("actual", nil),
+				types.MRP("message", err.Error()),
+			)
+			err = gp.AddRow(ctx, row)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, r := range results {
+			total++
+			if r.Status != assertions.StatusPass {
+				failed++
+			}
+			row := types.NewRow(
+				types.MRP("command", cc.name),
+				types.MRP("assertion", r.Assertion),
+				types.MRP("status", string(r.Status)),
+				types.MRP("actual", r.Actual),
+				types.MRP("message", r.Message),
+			)
+			err = gp.AddRow(ctx, row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed > 0 {
+		// the results are output before exiting with the error
+		err = gp.Close(ctx)
+		if err != nil {
+			return err
+		}
+		return errors.Errorf("%d of %d checks failed", failed, total)
+	}
+
+	return nil
+}
+
+// CheckFlagError explains the --assert values rejected by the flag parsing, which reads them
+// as CSV: a double quote inside a value is a CSV error, strings must use single quotes.
+func CheckFlagError(_ *cobra.Command, err error) error {
+	if strings.Contains(err.Error(), `for "--assert" flag`) && strings.Contains(err.Error(), "quoted-field") {
+		return errors.Wrap(err, "strings in --assert must use single quotes, as in every row: status != 'paid'")
+	}
+	return err
+}
+
+// assertFlag returns the assertions of --assert.
+//
+// The flag is a string list, which splits its values on commas: `--assert "every row: status != 'a,b'"`
+// is received as `every row: status != 'a` and `b'`. Commas can only appear in the strings of assertions,
+// so a value with an unterminated string is joined back with the next ones.
+func (s *CheckSettings) assertFlag() []string {
+	ret := []string{}
+	open := false
+	for _, v := range s.Assert {
+		if open {
+			ret[len(ret)-1] += "," + v
+		} else {
+			ret = append(ret, v)
+		}
+		if strings.Count(v, "'")%2 == 1 {
+			open = !open
+		}
+	}
+	return ret
+}
+
+// checkedCommands returns the command given as argument, or the commands with assertions selected by --all and --prefix.
+func (c *CheckCommand) checkedCommands(s *CheckSettings) ([]*checkedCommand, error) {
+	extraAssertions, err := assertions.ParseAll(s.assertFlag())
+	if err != nil {
+		return nil, err
+	}
+	commands := commandsByPath(c.commands)
+
+	if len(s.Command) > 0 {
+		if s.All || len(s.Prefix) > 0 {
+			return nil, errors.New("pass either a command or --all and --prefix")
+		}
+		command, args, err := findCommand(commands, s.Command)
+		if err != nil {
+			return nil, err
+		}
+		sqlCommand, ok := command.(*cmds2.SqlCommand)
+		if !ok {
+			return nil, errors.Errorf("%s is not a query command", strings.Join(s.Command, " "))
+		}
+		assertions_, err := assertions.ParseAll(sqlCommand.Assert)
+		if err != nil {
+			return nil, err
+		}
+		assertions_ = append(assertions_, extraAssertions...)
+		name := strings.Join(s.Command[:len(s.Command)-len(args)], " ")
+		if len(assertions_) == 0 {
+			return nil, errors.Errorf("%s has no assertions, add an assert section or use --assert", name)
+		}
+		return []*checkedCommand{{
+			name:       name,
+			command:    sqlCommand,
+			args:       args,
+			assertions: assertions_,
+		}}, nil
+	}
+
+	if !s.All && len(s.Prefix) == 0 {
+		return nil, errors.New("no commands to check, pass a command or use --all or --prefix")
+	}
+	if len(extraAssertions) > 0 {
+		return nil, errors.New("--assert needs a command")
+	}
+
+	paths := make([]string, 0, len(commands))
+	for path := range commands {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ret := []*checkedCommand{}
+	for _, path := range paths {
+		sqlCommand, ok := commands[path].(*cmds2.SqlCommand)
+		if !ok || len(sqlCommand.Assert) == 0 || !matchesPrefix(path, s.Prefix) {
+			continue
+		}
+		assertions_, err := assertions.ParseAll(sqlCommand.Assert)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &checkedCommand{
+			name:       path,
+			command:    sqlCommand,
+			assertions: assertions_,
+		})
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no commands with assertions")
+	}
+	return ret, nil
+}
+
+// matchesPrefix returns true if path is one of prefixes or a subcommand of one of them, or if there are no prefixes.
+func matchesPrefix(path string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CheckCommand) check(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	cc *checkedCommand,
+) ([]*assertions.Result, error) {
+	_, commandLayers, commandPs, err := parseCommandArgs(cc.command, cc.args, parsedLayers)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse the arguments of %s", cc.name)
+	}
+	db, err := openConnection(ctx, c.dbConnectionFactory, commandLayers, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	rows, err := cc.command.Rows(ctx, db, commandPs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*assertions.Result, len(cc.assertions))
+	for i, a := range cc.assertions {
+		ret[i] = a.Check(rows)
+	}
+	return ret, nil
+}
+
+func NewCheckCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	commands []cmds.Command,
+	options ...cmds.CommandDescriptionOption,
+) (*CheckCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Check the assertions of query commands, exiting with an error if one fails"),
+		cmds.WithLong(checkLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"all",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Check all the commands with assertions"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"prefix",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Check the commands with assertions in these groups, as in \"shop orders\""),
+			),
+			parameters.NewParameterDefinition(
+				"assert",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Assertions added to those of the command"),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"command",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Command to check, with its flags, after --"),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &CheckCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		commands:            commands,
+		CommandDescription: cmds.NewCommandDescription(
+			"check",
+			options_...,
+		),
+	}, nil
+}
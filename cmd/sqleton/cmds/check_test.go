@@ -0,0 +1,51 @@
+package cmds
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/sqleton/pkg/assertions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		assert   []string
+		expected []string
+	}{
+		{
+			name:     "single assertion",
+			assert:   []string{"every row: time < 60"},
+			expected: []string{"every row: time < 60"},
+		},
+		{
+			name: "comma in a string",
+			// --assert "no row: status == 'paid, not shipped'"
+			assert:   []string{"no row: status == 'paid", " not shipped'"},
+			expected: []string{"no row: status == 'paid, not shipped'"},
+		},
+		{
+			name: "several commas in a string",
+			// --assert "any row: tags == 'a,b,c'"
+			assert:   []string{"any row: tags == 'a", "b", "c'"},
+			expected: []string{"any row: tags == 'a,b,c'"},
+		},
+		{
+			name: "assertions separated by a comma",
+			// --assert "row_count > 0,no row: name == 'x'"
+			assert:   []string{"row_count > 0", "no row: name == 'x'"},
+			expected: []string{"row_count > 0", "no row: name == 'x'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &CheckSettings{Assert: tt.assert}
+			expressions := s.assertFlag()
+			assert.Equal(t, tt.expected, expressions)
+			_, err := assertions.ParseAll(expressions)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/go-go-golems/sqleton/pkg/sink"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+)
+
+const copyLong = `Run a sqleton command against the source connection and insert its rows
+into a table of the destination connection.
+
+The source connection is selected with the usual connection flags, the destination
+with --to, either the name of a connection (from the config file or a dbt profile)
+or a database URL. The command to run, along with its flags, comes after --:
+
+  sqleton copy --dbt-profile prod.main --to sqlite:////tmp/local.db --table posts \
+      -- select posts --limit 0
+
+  sqleton copy --to local --table active_users --mode upsert --key id \
+      -- query "SELECT id, name, email FROM users WHERE active"
+
+  sqleton copy --to local --table posts -- wp ls-posts --status publish
+
+The destination table is created if it doesn't exist, with column types inferred from
+the first batch of rows. Use --column-types id:INTEGER,body:MEDIUMTEXT to declare types.
+
+Modes:
+  append   insert the rows (default)
+  replace  delete the rows of the destination table first
+  upsert   update the rows with the same --key columns, insert the others
+
+In append and upsert modes, each batch of rows is inserted in its own transaction,
+and a failed copy leaves the batches inserted before the failure. In replace mode,
+the delete and all the batches run in a single transaction, so that a failed copy
+leaves the table as it was.
+`
+
+type CopyCommand struct {
+	*cmds.CommandDescription
+	commands []cmds.Command
+}
+
+type CopySettings struct {
+	To          string                 `glazed.parameter:"to"`
+	Table       string                 `glazed.parameter:"table"`
+	Mode        string                 `glazed.parameter:"mode"`
+	Keys        []string               `glazed.parameter:"key"`
+	BatchSize   int                    `glazed.parameter:"batch-size"`
+	ColumnTypes map[string]interface{} `glazed.parameter:"column-types"`
+	Progress    bool                   `glazed.parameter:"progress"`
+	Command     []string               `glazed.parameter:"command"`
+}
+
+func (c *CopyCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &CopySettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	command, args, err := findCommand(commandsByPath(c.commands), s.Command)
+	if err != nil {
+		return err
+	}
+	_, commandLayers, commandPs, err := parseCommandArgs(command, args, parsedLayers)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the arguments of %s", strings.Join(s.Command, " "))
+	}
+
+	layers_ := make([]*layers.ParsedParameterLayer, 0, len(parsedLayers))
+	for _, l := range parsedLayers {
+		layers_ = append(layers_, l)
+	}
+	config, err := sql2.NewConfigFromParsedLayers(layers_...)
+	if err != nil {
+		return err
+	}
+	source, err := connections.ResolveOne(s.To, connections.ConfigPath(), config.DbtProfilesPath)
+	if err != nil {
+		return err
+	}
+	db, err := connections.Open(ctx, source)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	columnTypes := map[string]string{}
+	for k, v := range s.ColumnTypes {
+		columnTypes[k] = fmt.Sprint(v)
+	}
+
+	options := []sink.TableWriterOption{
+		sink.WithMode(sink.Mode(s.Mode)),
+		sink.WithKeys(s.Keys...),
+		sink.WithBatchSize(s.BatchSize),
+		sink.WithColumnTypes(columnTypes),
+	}
+	if s.Progress {
+		options = append(options, sink.WithProgress(printCopyProgress))
+	}
+	w, err := sink.NewTableWriter(db, s.Table, options...)
+	if err != nil {
+		return err
+	}
+
+	err = command.Run(ctx, commandLayers, commandPs, w)
+	if _, ok := err.(*cmds.ExitWithoutGlazeError); ok {
+		return err
+	}
+	if err == nil {
+		err = w.Close(ctx)
+	} else {
+		_ = w.Abort()
+	}
+	if s.Progress && w.Stats().Batches > 0 && isatty.IsTerminal(os.Stderr.Fd()) {
+		_, _ = fmt.Fprintln(os.Stderr)
+	}
+	stats := w.Stats()
+	if err != nil {
+		return errors.Wrapf(err, "copy failed after %d rows", stats.Rows)
+	}
+
+	elapsed := time.Since(stats.Started)
+	return gp.AddRow(ctx, types.NewRow(
+		types.MRP("to", source.Name),
+		types.MRP("table", s.Table),
+		types.MRP("mode", s.Mode),
+		types.MRP("created", stats.Created),
+		types.MRP("deleted", stats.Deleted),
+		types.MRP("rows", stats.Rows),
+		types.MRP("batches", stats.Batches),
+		types.MRP("duration_ms", elapsed.Milliseconds()),
+		types.MRP("rows_per_s", rowsPerSecond(stats.Rows, elapsed)),
+	))
+}
+
+// printCopyProgress reports the progress on stderr, on a single line when stderr is a terminal.
+func printCopyProgress(stats sink.Stats) {
+	line := fmt.Sprintf("copied %d rows in %d batches (%.0f rows/s)",
+		stats.Rows, stats.Batches, rowsPerSecond(stats.Rows, time.Since(stats.Started)))
+	if isatty.IsTerminal(os.Stderr.Fd()) {
+		_, _ = fmt.Fprintf(os.Stderr, "\r%s", line)
+	} else {
+		_, _ = fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+func rowsPerSecond(rows int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return math.Round(float64(rows) / elapsed.Seconds())
+}
+
+func NewCopyCommand(
+	commands []cmds.Command,
+	options ...cmds.CommandDescriptionOption,
+) (*CopyCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Copy the rows of a query into a table of another connection"),
+		cmds.WithLong(copyLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"to",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Destination connection name or database URL"),
+				parameters.WithRequired(true),
+			),
+			parameters.NewParameterDefinition(
+				"table",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Destination table, created if it doesn't exist"),
+				parameters.WithRequired(true),
+			),
+			parameters.NewParameterDefinition(
+				"mode",
+				parameters.ParameterTypeChoice,
+				parameters.WithHelp("What to do with the rows already in the destination table"),
+				parameters.WithChoices(sink.Modes),
+				parameters.WithDefault(string(sink.ModeAppend)),
+			),
+			parameters.NewParameterDefinition(
+				"key",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Key columns, used for upsert and as primary key of a created table"),
+			),
+			parameters.NewParameterDefinition(
+				"batch-size",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of rows inserted per transaction"),
+				parameters.WithDefault(1000),
+			),
+			parameters.NewParameterDefinition(
+				"column-types",
+				parameters.ParameterTypeKeyValue,
+				parameters.WithHelp("Column types of a created table, as column:TYPE"),
+			),
+			parameters.NewParameterDefinition(
+				"progress",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Report progress on stderr after every batch"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"command",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Command to copy the rows of, with its flags, after --"),
+				parameters.WithRequired(true),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &CopyCommand{
+		commands: commands,
+		CommandDescription: cmds.NewCommandDescription(
+			"copy",
+			options_...,
+		),
+	}, nil
+}
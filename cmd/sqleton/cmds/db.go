@@ -8,10 +8,14 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/middlewares/row"
 	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/go-go-golems/sqleton/pkg/health"
 	"github.com/jmoiron/sqlx"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"sort"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql" // MySQL driver for database/sql
 )
@@ -59,26 +63,111 @@ func createConfigFromCobra(cmd *cobra.Command) *sql2.DatabaseConfig {
 
 var dbTestConnectionCmd = &cobra.Command{
 	Use:   "test",
-	Short: "Test the connection to a database",
+	Short: "Test the connection to a database and report on its health",
+	Long: `Connect to the database and output a row with the connect and ping latency,
+server version, current user, database and schema, timezone, character set,
+read-only and TLS status, as well as whether the current user can select, insert
+and create tables in the probed schema.
+
+With --all, every profile in the dbt profiles file is tested.
+Exits with a non-zero status if any connection failed.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+
+		all, _ := cmd.Flags().GetBool("all")
+		probeSchema, _ := cmd.Flags().GetString("probe-schema")
+
 		config := createConfigFromCobra(cmd)
 
-		fmt.Printf("Testing connection to %s\n", config.ToString())
-		db, err := config.Connect()
-		cobra.CheckErr(err)
+		var sources []*sql2.Source
+		if all {
+			var err error
+			sources, err = sql2.ParseDbtProfiles(config.DbtProfilesPath)
+			cobra.CheckErr(err)
+			sort.Slice(sources, func(i, j int) bool {
+				return sources[i].Name < sources[j].Name
+			})
+		} else if config.DSN == "" {
+			source, err := config.GetSource()
+			cobra.CheckErr(err)
+			sources = []*sql2.Source{source}
+		}
 
-		cobra.CheckErr(err)
-		defer func(db *sqlx.DB) {
-			_ = db.Close()
-		}(db)
+		gp, _, err := cli.CreateGlazedProcessorFromCobra(cmd)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Could not create glaze  procersors: %v\n", err)
+			os.Exit(1)
+		}
 
-		err = db.Ping()
-		cobra.CheckErr(err)
+		failed := false
+		testConnection := func(source *sql2.Source, driver string, dsn string) {
+			report, err := health.Check(ctx, driver, dsn, probeSchema)
+			cobra.CheckErr(err)
+			if report.Error != nil {
+				failed = true
+			}
+
+			row := types.NewRow(
+				types.MRP("name", source.Name),
+				types.MRP("type", source.Type),
+				types.MRP("host", source.Hostname),
+				types.MRP("port", source.Port),
+				types.MRP("database", source.Database),
+			)
+			if report.Error != nil {
+				row.Set("status", "error")
+				row.Set("error", report.Error.Error())
+			} else {
+				row.Set("status", "ok")
+				row.Set("error", "")
+			}
+			row.Set("connect_ms", float64(report.ConnectLatency.Microseconds())/1000)
+			row.Set("ping_ms", float64(report.PingLatency.Microseconds())/1000)
+			row.Set("driver", report.Driver)
+			row.Set("server_version", report.ServerVersion)
+			row.Set("current_user", report.CurrentUser)
+			row.Set("current_database", report.CurrentDatabase)
+			row.Set("current_schema", report.CurrentSchema)
+			row.Set("timezone", report.Timezone)
+			row.Set("charset", report.Charset)
+			row.Set("read_only", boolOrNil(report.ReadOnly))
+			row.Set("tls", boolOrNil(report.TLS))
+			row.Set("probe_schema", report.ProbeSchema)
+			row.Set("can_select", boolOrNil(report.CanSelect))
+			row.Set("can_insert", boolOrNil(report.CanInsert))
+			row.Set("can_create", boolOrNil(report.CanCreate))
+			row.Set("warnings", strings.Join(report.Warnings, "; "))
+
+			err = gp.AddRow(ctx, row)
+			cobra.CheckErr(err)
+		}
 
-		fmt.Println("Connection successful")
+		if len(sources) == 0 {
+			testConnection(&sql2.Source{Type: config.Driver}, config.Driver, config.DSN)
+		}
+		for _, source := range sources {
+			testConnection(source, connections.Driver(source), source.ToConnectionString())
+		}
+
+		err = gp.Close(ctx)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error rendering output: %s\n", err)
+			os.Exit(1)
+		}
+
+		if failed {
+			os.Exit(1)
+		}
 	},
 }
 
+func boolOrNil(b *bool) interface{} {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
+
 // dbTestConnectionCmdWithPrefix is a test command to use
 // configuration flags and settings with a prefix, which can be used to
 // mix sqleton commands with say, escuse-me commands
@@ -151,6 +240,39 @@ var dbPrintEvidenceSettingsCmd = &cobra.Command{
 	},
 }
 
+var dbExportConfigCmd = &cobra.Command{
+	Use:   "export-config",
+	Short: "Output the settings to connect to a database in the format of another tool",
+	Long: fmt.Sprintf(`Output the connection settings for use with other tools.
+
+Supported formats: %s.
+
+The mycnf format outputs option groups to be used with --defaults-group-suffix=_NAME,
+pgpass a ~/.pgpass line, pg-service a pg_service.conf section and dbt a profiles.yml block.
+The dbeaver and datagrip formats output a data-source XML element.`,
+		strings.Join(connections.ExportFormats, ", ")),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := createConfigFromCobra(cmd)
+		if config.DSN != "" {
+			cobra.CheckErr(fmt.Errorf("cannot export a DSN connection, use the individual connection flags"))
+		}
+		source, err := config.GetSource()
+		cobra.CheckErr(err)
+
+		format, _ := cmd.Flags().GetString("format")
+		name, _ := cmd.Flags().GetString("name")
+		if name == "" {
+			name = source.Name
+		}
+		if name == "" {
+			name = source.Database
+		}
+
+		err = connections.Export(os.Stdout, format, name, source)
+		cobra.CheckErr(err)
+	},
+}
+
 var dbPrintEnvCmd = &cobra.Command{
 	Use:   "print-env",
 	Short: "Output the settings to connect to a database as environment variables",
@@ -282,22 +404,29 @@ var dbPrintSettingsCmd = &cobra.Command{
 
 var dbLsCmd = &cobra.Command{
 	Use:   "ls",
-	Short: "List databases from profiles",
+	Short: "List databases from profiles and the connections of the sqleton config file",
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := cmd.Context()
 
 		useDbtProfiles := viper.GetBool("use-dbt-profiles")
 
-		if !useDbtProfiles {
-			cmd.PrintErrln("Not using dbt profiles")
-			return
-		}
+		var sources []*sql2.Source
+		if useDbtProfiles {
+			dbtProfilesPath := viper.GetString("dbt-profiles-path")
 
-		dbtProfilesPath := viper.GetString("dbt-profiles-path")
+			var err error
+			sources, err = sql2.ParseDbtProfiles(dbtProfilesPath)
+			cobra.CheckErr(err)
+		}
 
-		sources, err := sql2.ParseDbtProfiles(dbtProfilesPath)
+		configured, err := connections.LoadConfigConnections(connections.ConfigPath())
 		cobra.CheckErr(err)
 
+		if !useDbtProfiles && len(configured) == 0 {
+			cmd.PrintErrln("Not using dbt profiles")
+			return
+		}
+
 		gp, _, err := cli.CreateGlazedProcessorFromCobra(cmd)
 		if err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "Could not create glaze  procersors: %v\n", err)
@@ -310,6 +439,13 @@ var dbLsCmd = &cobra.Command{
 
 		for _, source := range sources {
 			row := types.NewRowFromStruct(source, true)
+			row.Set("origin", "dbt")
+			err := gp.AddRow(ctx, row)
+			cobra.CheckErr(err)
+		}
+		for _, name := range connections.SortedNames(configured) {
+			row := types.NewRowFromStruct(configured[name], true)
+			row.Set("origin", "config")
 			err := gp.AddRow(ctx, row)
 			cobra.CheckErr(err)
 		}
@@ -339,12 +475,26 @@ func init() {
 
 	err = dbtParameterLayer.AddFlagsToCobraCommand(dbTestConnectionCmd)
 	cobra.CheckErr(err)
+	dbTestConnectionCmd.Flags().Bool("all", false, "Test all the profiles in the dbt profiles file")
+	dbTestConnectionCmd.Flags().String("probe-schema", "", "Schema to check permissions on (default: the current schema)")
+	err = cli.AddGlazedProcessorFlagsToCobraCommand(dbTestConnectionCmd)
+	cobra.CheckErr(err)
 
 	err = connectionLayer.AddFlagsToCobraCommand(dbPrintEvidenceSettingsCmd)
 	cobra.CheckErr(err)
 	dbPrintEvidenceSettingsCmd.Flags().String("git-repo", "", "Git repo to use for evidence.dev")
 	DbCmd.AddCommand(dbPrintEvidenceSettingsCmd)
 
+	err = connectionLayer.AddFlagsToCobraCommand(dbExportConfigCmd)
+	cobra.CheckErr(err)
+	err = dbtParameterLayer.AddFlagsToCobraCommand(dbExportConfigCmd)
+	cobra.CheckErr(err)
+	dbExportConfigCmd.Flags().String("format", "", fmt.Sprintf("Output format (%s)", strings.Join(connections.ExportFormats, ", ")))
+	dbExportConfigCmd.Flags().String("name", "", "Name of the section, service or profile (default: the dbt profile or database name)")
+	err = dbExportConfigCmd.MarkFlagRequired("format")
+	cobra.CheckErr(err)
+	DbCmd.AddCommand(dbExportConfigCmd)
+
 	err = connectionLayer.AddFlagsToCobraCommand(dbPrintEnvCmd)
 	cobra.CheckErr(err)
 	dbPrintEnvCmd.Flags().Bool("envrc", false, "Output as an .envrc file")
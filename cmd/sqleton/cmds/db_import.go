@@ -0,0 +1,135 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/spf13/cobra"
+)
+
+// defaultImportFiles are imported when no file is passed to db import.
+var defaultImportFiles = []string{
+	"$HOME/.my.cnf",
+	"$HOME/.pgpass",
+	"$HOME/.pg_service.conf",
+	"$HOME/.dbt/profiles.yml",
+}
+
+var dbImportCmd = &cobra.Command{
+	Use:   "import [FILE...]",
+	Short: "Import connections from other tools into the sqleton config file",
+	Long: `Import connections from ~/.my.cnf, ~/.pgpass, pg_service.conf, .env files
+with a DATABASE_URL, docker-compose files and dbt profiles.yml files, and store them
+as named connections in the connections section of the sqleton config file.
+
+The format is detected from the file name, use --format to override it.
+Without files, ~/.my.cnf, ~/.pgpass, ~/.pg_service.conf and ~/.dbt/profiles.yml are imported.
+
+Connections that already exist with different settings are reported as conflicts
+and left untouched, unless --overwrite is passed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+
+		format, _ := cmd.Flags().GetString("format")
+		prefix, _ := cmd.Flags().GetString("prefix")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		files := args
+		if len(files) == 0 {
+			for _, f := range defaultImportFiles {
+				f = os.ExpandEnv(f)
+				if _, err := os.Stat(f); err == nil {
+					files = append(files, f)
+				}
+			}
+		}
+
+		configPath := connections.ConfigPath()
+		existing, err := connections.LoadConfigConnections(configPath)
+		cobra.CheckErr(err)
+
+		gp, _, err := cli.CreateGlazedProcessorFromCobra(cmd)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Could not create glaze  procersors: %v\n", err)
+			os.Exit(1)
+		}
+
+		addRow := func(i *connections.Imported, name string, status string, reason string) {
+			err := gp.AddRow(ctx, types.NewRow(
+				types.MRP("name", name),
+				types.MRP("type", i.Source.Type),
+				types.MRP("host", i.Source.Hostname),
+				types.MRP("port", i.Source.Port),
+				types.MRP("database", i.Source.Database),
+				types.MRP("file", i.File),
+				types.MRP("status", status),
+				types.MRP("reason", reason),
+			))
+			cobra.CheckErr(err)
+		}
+
+		var imported []*connections.Imported
+		for _, f := range files {
+			imported_, err := connections.ImportFile(f, format)
+			cobra.CheckErr(err)
+			imported = append(imported, imported_...)
+		}
+		connections.DisambiguateNames(imported)
+
+		changed := false
+		for _, i := range imported {
+			name := prefix + i.Source.Name
+			if i.SkipReason != "" {
+				addRow(i, name, "skipped", i.SkipReason)
+				continue
+			}
+
+			source := *i.Source
+			source.Name = name
+
+			previous, ok := existing[name]
+			switch {
+			case !ok:
+				addRow(i, name, "added", "")
+			case connections.SameSource(previous, &source):
+				addRow(i, name, "unchanged", "")
+				continue
+			case overwrite:
+				addRow(i, name, "updated", "")
+			default:
+				addRow(i, name, "conflict",
+					fmt.Sprintf("%s already exists with different settings, use --overwrite to replace it", name))
+				continue
+			}
+
+			existing[name] = &source
+			changed = true
+		}
+
+		err = gp.Close(ctx)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error rendering output: %s\n", err)
+			os.Exit(1)
+		}
+
+		if changed && !dryRun {
+			err = connections.SaveConfigConnections(configPath, existing)
+			cobra.CheckErr(err)
+		}
+	},
+}
+
+func init() {
+	dbImportCmd.Flags().String("format", "", fmt.Sprintf("Format of the imported files (%s)", strings.Join(connections.ImportFormats, ", ")))
+	dbImportCmd.Flags().String("prefix", "", "Prefix to add to the names of the imported connections")
+	dbImportCmd.Flags().Bool("overwrite", false, "Overwrite existing connections with different settings")
+	dbImportCmd.Flags().Bool("dry-run", false, "Only report what would be imported")
+	err := cli.AddGlazedProcessorFlagsToCobraCommand(dbImportCmd)
+	cobra.CheckErr(err)
+	DbCmd.AddCommand(dbImportCmd)
+}
@@ -0,0 +1,286 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/diff"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const diffResultsLong = `Run a query command twice and compare its results, for example against two connections
+to check that a migration didn't change the output of a query:
+
+  sqleton diff-results --before prod --after staging -- wp posts-counts
+
+or with two sets of flags, which are added to the flags of the command:
+
+  sqleton diff-results --after-flags "--from 2023-02-01" --key post_type -- wp posts-counts --from 2023-01-01
+
+--before and --after are connection names or database URLs, the usual connection flags are used
+for the side that isn't given one.
+
+The rows are matched by the --key columns, or the keys declared by the command. Changed rows
+are output as one row per changed column, with _column, _before and _after, while added and
+removed rows are output as they are. The _change column is added, removed or changed.
+Without keys, whole rows are compared and there are only added and removed rows.
+
+Use --fail-on-diff to exit with an error if the results differ, for example in CI.
+`
+
+type DiffResultsCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+	commands            []cmds.Command
+}
+
+type DiffResultsSettings struct {
+	Before      string   `glazed.parameter:"before"`
+	After       string   `glazed.parameter:"after"`
+	BeforeFlags string   `glazed.parameter:"before-flags"`
+	AfterFlags  string   `glazed.parameter:"after-flags"`
+	Keys        []string `glazed.parameter:"key"`
+	FailOnDiff  bool     `glazed.parameter:"fail-on-diff"`
+	Command     []string `glazed.parameter:"command"`
+}
+
+func (c *DiffResultsCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &DiffResultsSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+	if s.Before == "" && s.After == "" && s.BeforeFlags == "" && s.AfterFlags == "" {
+		return errors.New("nothing to compare, use --before, --after, --before-flags or --after-flags")
+	}
+
+	command, args, err := findCommand(commandsByPath(c.commands), s.Command)
+	if err != nil {
+		return err
+	}
+	sqlCommand, ok := command.(*cmds2.SqlCommand)
+	if !ok {
+		return errors.Errorf("%s is not a query command", strings.Join(s.Command, " "))
+	}
+
+	keys := s.Keys
+	if len(keys) == 0 {
+		keys = sqlCommand.Keys
+	}
+
+	before, err := c.runSide(ctx, parsedLayers, sqlCommand, args, s.Before, s.BeforeFlags)
+	if err != nil {
+		return errors.Wrap(err, "before")
+	}
+	after, err := c.runSide(ctx, parsedLayers, sqlCommand, args, s.After, s.AfterFlags)
+	if err != nil {
+		return errors.Wrap(err, "after")
+	}
+
+	changes := diff.Rows(before, after, keys)
+	for _, change := range changes {
+		err = addChangeRows(ctx, gp, change, keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.FailOnDiff && len(changes) > 0 {
+		// the differences are output before exiting with the error
+		err = gp.Close(ctx)
+		if err != nil {
+			return err
+		}
+		return errors.Errorf("%d rows differ", len(changes))
+	}
+
+	return nil
+}
+
+// runSide runs the command with its args followed by flags, against connection,
+// or the connection of the diff-results flags if empty.
+func (c *DiffResultsCommand) runSide(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	command *cmds2.SqlCommand,
+	args []string,
+	connection string,
+	flags string,
+) ([]types.Row, error) {
+	extraArgs, err := splitArgs(flags)
+	if err != nil {
+		return nil, err
+	}
+	_, commandLayers, commandPs, err := parseCommandArgs(command, append(append([]string{}, args...), extraArgs...), parsedLayers)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse the arguments of %s", command.Name)
+	}
+
+	db, err := openConnection(ctx, c.dbConnectionFactory, commandLayers, connection)
+	if err != nil {
+		return nil, err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	return command.Rows(ctx, db, commandPs)
+}
+
+// addChangeRows outputs a changed row as one row per changed column, and added and removed rows as they are.
+func addChangeRows(ctx context.Context, gp middlewares.Processor, change *diff.RowChange, keys []string) error {
+	if change.Type != diff.ChangeTypeChanged {
+		row := types.NewRow(types.MRP("_change", string(change.Type)))
+		values := change.After
+		if values == nil {
+			values = change.Before
+		}
+		for pair := values.Oldest(); pair != nil; pair = pair.Next() {
+			row.Set(pair.Key, pair.Value)
+		}
+		return gp.AddRow(ctx, row)
+	}
+
+	for _, field := range change.ChangedFields() {
+		row := types.NewRow(types.MRP("_change", string(change.Type)))
+		for _, k := range keys {
+			v, _ := change.After.Get(k)
+			row.Set(k, v)
+		}
+		before, _ := change.Before.Get(field)
+		after, _ := change.After.Get(field)
+		row.Set("_column", field)
+		row.Set("_before", before)
+		row.Set("_after", after)
+		err := gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitArgs splits s into arguments the way a shell would, on whitespace outside of quotes.
+func splitArgs(s string) ([]string, error) {
+	ret := []string{}
+	current := strings.Builder{}
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				ret = append(ret, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote or escape in %s", s)
+	}
+	if inArg {
+		ret = append(ret, current.String())
+	}
+	return ret, nil
+}
+
+func NewDiffResultsCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	commands []cmds.Command,
+	options ...cmds.CommandDescriptionOption,
+) (*DiffResultsCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Compare the results of a query command between two connections or two sets of flags"),
+		cmds.WithLong(diffResultsLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"before",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Connection name or database URL to run the command against first"),
+			),
+			parameters.NewParameterDefinition(
+				"after",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Connection name or database URL to run the command against second"),
+			),
+			parameters.NewParameterDefinition(
+				"before-flags",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Flags added to the command for the first run"),
+			),
+			parameters.NewParameterDefinition(
+				"after-flags",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Flags added to the command for the second run"),
+			),
+			parameters.NewParameterDefinition(
+				"key",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Columns identifying a row (default: the keys of the command)"),
+			),
+			parameters.NewParameterDefinition(
+				"fail-on-diff",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Exit with an error if the results differ"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"command",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Command to compare the results of, with its flags, after --"),
+				parameters.WithRequired(true),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &DiffResultsCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		commands:            commands,
+		CommandDescription: cmds.NewCommandDescription(
+			"diff-results",
+			options_...,
+		),
+	}, nil
+}
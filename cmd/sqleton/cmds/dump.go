@@ -0,0 +1,301 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/dump"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const dumpLong = `Export a whole table into a directory, one file per chunk of --chunk-size rows.
+
+  sqleton dump --table wp_posts --chunk-size 50000 --format csv --out dump/wp_posts
+
+The table is walked in primary key order (or --key order), each chunk being selected
+with a keyset predicate on the last key of the previous chunk, so that the chunks
+are as fast to export at the end of the table as at its start.
+
+The chunks are recorded in manifest.json in the output directory, with the range of keys,
+the number of rows and the sha256 checksum of each file. Use --resume to continue an interrupted
+dump after the last chunk of the manifest.
+`
+
+type DumpCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+}
+
+type DumpSettings struct {
+	Table     string   `glazed.parameter:"table"`
+	ChunkSize int      `glazed.parameter:"chunk-size"`
+	Format    string   `glazed.parameter:"format"`
+	Out       string   `glazed.parameter:"out"`
+	Keys      []string `glazed.parameter:"key"`
+	Columns   []string `glazed.parameter:"columns"`
+	Where     string   `glazed.parameter:"where"`
+	Resume    bool     `glazed.parameter:"resume"`
+}
+
+func (c *DumpCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &DumpSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+	if s.ChunkSize <= 0 {
+		return errors.Errorf("chunk size must be positive, got %d", s.ChunkSize)
+	}
+
+	db, err := c.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not ping database")
+	}
+
+	keys := []*pagination.Key{}
+	for _, k := range s.Keys {
+		keys = append(keys, &pagination.Key{Column: k})
+	}
+	if len(keys) == 0 {
+		keys, err = primaryKeys(ctx, db, s.Table)
+		if err != nil {
+			return errors.Wrap(err, "use --key to set the columns to walk the table by")
+		}
+	}
+	keyNames := make([]string, len(keys))
+	for i, k := range keys {
+		keyNames[i] = k.Column
+		if len(s.Columns) > 0 && !containsColumn(s.Columns, k.Column) {
+			return errors.Errorf("the key column %s has to be one of the dumped columns", k.Column)
+		}
+	}
+	p := &pagination.Pagination{Keys: keys, PageSize: s.ChunkSize}
+
+	manifest := &dump.Manifest{
+		Table:     s.Table,
+		Format:    s.Format,
+		ChunkSize: s.ChunkSize,
+		Keys:      keyNames,
+		Columns:   s.Columns,
+		Where:     s.Where,
+		StartedAt: time.Now(),
+		Chunks:    []*dump.Chunk{},
+	}
+
+	existing, err := dump.ReadManifest(s.Out)
+	switch {
+	case err == nil:
+		if !s.Resume {
+			return errors.Errorf("%s already contains a dump, use --resume to continue it", s.Out)
+		}
+		err = existing.CheckResume(manifest)
+		if err != nil {
+			return err
+		}
+		manifest = existing
+	case errors.Is(err, os.ErrNotExist):
+		err = os.MkdirAll(s.Out, 0755)
+		if err != nil {
+			return err
+		}
+		err = manifest.Write(s.Out)
+		if err != nil {
+			return errors.Wrap(err, "could not write manifest")
+		}
+	default:
+		return err
+	}
+
+	flavor := builderFlavor(db)
+	cursor := manifest.Cursor()
+	for !manifest.Complete() {
+		sb := (&SelectCommandSettings{Table: s.Table, Columns: s.Columns, Where: s.Where}).newSelectBuilder()
+		if cursor != "" {
+			where, err := p.WhereArgs(cursor, sb.Var)
+			if err != nil {
+				return err
+			}
+			sb = sb.Where(where)
+		}
+		sb = sb.OrderBy(p.OrderBy()).Limit(s.ChunkSize)
+		query, queryArgs := sb.BuildWithFlavor(flavor)
+
+		index := len(manifest.Chunks)
+		file := manifest.ChunkFile(index)
+		w, err := dump.NewChunkWriter(filepath.Join(s.Out, file), s.Format, keyNames)
+		if err != nil {
+			return err
+		}
+		err = stream.RunQueryIntoGlaze(ctx, db, query, queryArgs, w, stream.WithFetchSize(stream.DefaultFetchSize))
+		if err != nil {
+			w.Abort()
+			return errors.Wrapf(err, "could not dump chunk %d", index)
+		}
+
+		if w.Rows == 0 {
+			w.Abort()
+		} else {
+			err = w.Close(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "could not write %s", file)
+			}
+			cursor, err = p.EncodeCursor(w.LastRow())
+			if err != nil {
+				return err
+			}
+			chunk := &dump.Chunk{
+				Index:  index,
+				File:   file,
+				From:   w.First(),
+				To:     w.Last(),
+				Rows:   w.Rows,
+				SHA256: w.SHA256(),
+				Cursor: cursor,
+			}
+			manifest.Chunks = append(manifest.Chunks, chunk)
+
+			err = gp.AddRow(ctx, types.NewRow(
+				types.MRP("chunk", chunk.Index),
+				types.MRP("file", filepath.Join(s.Out, chunk.File)),
+				types.MRP("from", formatKey(chunk.From)),
+				types.MRP("to", formatKey(chunk.To)),
+				types.MRP("rows", chunk.Rows),
+				types.MRP("sha256", chunk.SHA256),
+			))
+			if err != nil {
+				return err
+			}
+		}
+
+		if w.Rows < s.ChunkSize {
+			now := time.Now()
+			manifest.CompletedAt = &now
+		}
+		err = manifest.Write(s.Out)
+		if err != nil {
+			return errors.Wrap(err, "could not write manifest")
+		}
+	}
+
+	return nil
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == "*" || strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatKey(values []interface{}) string {
+	ret := make([]string, len(values))
+	for i, v := range values {
+		if t, ok := v.(time.Time); ok {
+			ret[i] = t.Format(time.RFC3339Nano)
+		} else {
+			ret[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(ret, ", ")
+}
+
+func NewDumpCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DumpCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Export a table into chunked files"),
+		cmds.WithLong(dumpLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"table",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Table to dump"),
+				parameters.WithRequired(true),
+			),
+			parameters.NewParameterDefinition(
+				"chunk-size",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of rows per file"),
+				parameters.WithDefault(50000),
+			),
+			parameters.NewParameterDefinition(
+				"format",
+				parameters.ParameterTypeChoice,
+				parameters.WithHelp("Format of the files"),
+				parameters.WithChoices(dump.Formats),
+				parameters.WithDefault("csv"),
+			),
+			parameters.NewParameterDefinition(
+				"out",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Directory to write the files and the manifest to"),
+				parameters.WithRequired(true),
+			),
+			parameters.NewParameterDefinition(
+				"key",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Columns to walk the table by, identifying a row (default: the primary key)"),
+			),
+			parameters.NewParameterDefinition(
+				"columns",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Columns to dump (default: all)"),
+			),
+			parameters.NewParameterDefinition(
+				"where",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Only dump the rows matching this condition"),
+			),
+			parameters.NewParameterDefinition(
+				"resume",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Continue the dump of the manifest in --out"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &DumpCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		CommandDescription: cmds.NewCommandDescription(
+			"dump",
+			options_...,
+		),
+	}, nil
+}
@@ -0,0 +1,497 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var GenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate sqleton commands from the database schema",
+}
+
+const generateRepositoryLong = `Introspect the tables of the database and write a directory of query commands
+for each of them, ready to be added to the repositories of the sqleton config file.
+
+  sqleton generate repository --out ~/.sqleton/repositories/shop
+
+The commands are written to <out>/<schema>/<table>/, and run as sqleton <schema> <table> <command>:
+
+- list: the rows of the table, filtered by column, paginated by primary key
+- get: a single row, by primary key (tables with a primary key)
+- count: the number of rows, optionally grouped by columns with --by
+- recent: the most recent rows by a date column (tables with a date column)
+
+The flags filtering on a column depend on its type, as for select --create-query,
+and their help includes the comment of the column. Existing files are left untouched,
+unless --overwrite is passed.
+`
+
+type GenerateRepositoryCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+}
+
+type GenerateRepositorySettings struct {
+	Out       string   `glazed.parameter:"out"`
+	Tables    []string `glazed.parameter:"tables"`
+	Overwrite bool     `glazed.parameter:"overwrite"`
+}
+
+// generatedFlags are the flags of the generated commands that are not column filters.
+var generatedFlags = []string{"where", "columns", "limit", "offset", "by", "since"}
+
+func (c *GenerateRepositoryCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &GenerateRepositorySettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	tables, err := schema.ListTables(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	reserved, err := reservedFlags(generatedFlags)
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	for _, t := range tables {
+		if len(s.Tables) > 0 && !containsColumn(s.Tables, t.Name) && !containsColumn(s.Tables, t.Schema+"."+t.Name) {
+			continue
+		}
+		found++
+
+		// postgres tables are qualified, as there can be several schemas in the search path
+		table := t.Name
+		if db.DriverName() == "postgres" {
+			table = t.Schema + "." + t.Name
+		}
+		columns, err := schema.ListColumns(ctx, db, table)
+		if err != nil {
+			return err
+		}
+
+		dir := filepath.Join(s.Out, t.Schema, t.Name)
+		for _, description := range generateTableCommands(t, table, columns, reserved) {
+			status := "written"
+			path, err := writeCommandFile(dir, description, s.Overwrite)
+			if err != nil {
+				if !errors.Is(err, os.ErrExist) {
+					return err
+				}
+				status = "exists"
+				path = filepath.Join(dir, description.Name+".yaml")
+			}
+
+			err = gp.AddRow(ctx, types.NewRow(
+				types.MRP("schema", t.Schema),
+				types.MRP("table", t.Name),
+				types.MRP("command", description.Name),
+				types.MRP("file", path),
+				types.MRP("status", status),
+			))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if found == 0 && len(s.Tables) > 0 {
+		return errors.Errorf("none of the tables %s exist", strings.Join(s.Tables, ", "))
+	}
+
+	return nil
+}
+
+// generateTableCommands returns the commands generated for table t, selected from as table.
+// The column flags don't use the names in reserved.
+func generateTableCommands(
+	t *schema.Table, table string,
+	columns []*schema.Column,
+	reserved []string,
+) []*cmds2.SqlCommandDescription {
+	long := tableLong(t, columns)
+
+	primaryKey := []*schema.Column{}
+	dates := []string{}
+	for _, c := range columns {
+		if !flagNameRegexp.MatchString(c.Name) {
+			continue
+		}
+		if c.PrimaryKey {
+			primaryKey = append(primaryKey, c)
+		}
+		if c.Kind() == schema.KindDate {
+			dates = append(dates, c.Name)
+		}
+	}
+	// a primary key with a column we can't make a flag of is as good as none
+	pkCount := 0
+	for _, c := range columns {
+		if c.PrimaryKey {
+			pkCount++
+		}
+	}
+	if pkCount != len(primaryKey) {
+		primaryKey = nil
+	}
+
+	ret := []*cmds2.SqlCommandDescription{
+		generateList(t, table, columns, primaryKey, reserved, long),
+	}
+	if len(primaryKey) > 0 {
+		ret = append(ret, generateGet(t, table, primaryKey, reserved, long))
+	}
+	ret = append(ret, generateCount(t, table, columns, reserved, long))
+	if len(dates) > 0 {
+		ret = append(ret, generateRecent(t, table, columns, dates, long))
+	}
+	return ret
+}
+
+// tableLong describes the table and its columns, with their comments.
+func tableLong(t *schema.Table, columns []*schema.Column) string {
+	b := &strings.Builder{}
+	if t.Comment != "" {
+		_, _ = fmt.Fprintf(b, "%s\n\n", t.Comment)
+	}
+	_, _ = fmt.Fprintf(b, "Columns of %s:\n\n", t.Name)
+	for _, c := range columns {
+		_, _ = fmt.Fprintf(b, "- %s %s", c.Name, c.Type)
+		if c.PrimaryKey {
+			_, _ = fmt.Fprint(b, " (primary key)")
+		}
+		if c.Comment != "" {
+			_, _ = fmt.Fprintf(b, ": %s", c.Comment)
+		}
+		_, _ = fmt.Fprintln(b)
+	}
+	return b.String()
+}
+
+func columnNames(columns []*schema.Column) []string {
+	ret := make([]string, len(columns))
+	for i, c := range columns {
+		ret[i] = c.Name
+	}
+	return ret
+}
+
+func (qb *queryBuilder) addWhereFlag() {
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name: "where",
+		Type: parameters.ParameterTypeString,
+		Help: "Additional where clause, as raw SQL",
+	})
+	qb.printf("\nWHERE 1=1")
+	qb.printf("\n{{ if .where }}  AND ({{ .where }}){{ end }}")
+}
+
+// generateList selects the rows of the table, filtered by column.
+// Tables with a primary key are paginated by it, the others are paged with --offset.
+func generateList(
+	t *schema.Table, table string,
+	columns []*schema.Column, primaryKey []*schema.Column,
+	reserved []string, long string,
+) *cmds2.SqlCommandDescription {
+	qb := &queryBuilder{}
+
+	// the primary key is always selected, as the pagination cursor is read from it
+	choices := []string{}
+	for _, c := range columns {
+		if !containsColumn(columnNames(primaryKey), c.Name) {
+			choices = append(choices, c.Name)
+		}
+	}
+	if len(primaryKey) > 0 {
+		qb.printf("SELECT {{ if .columns }}%s, {{ join \", \" .columns }}{{ else }}*{{ end }} FROM %s",
+			strings.Join(columnNames(primaryKey), ", "), table)
+	} else {
+		qb.printf("SELECT {{ if .columns }}{{ join \", \" .columns }}{{ else }}*{{ end }} FROM %s", table)
+	}
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name:    "columns",
+		Type:    parameters.ParameterTypeChoiceList,
+		Help:    "Columns to select (default: all)",
+		Choices: choices,
+	})
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name:    "limit",
+		Type:    parameters.ParameterTypeInteger,
+		Help:    "Limit the number of rows (default: 50)",
+		Default: 50,
+	})
+
+	qb.addWhereFlag()
+	reserved = append([]string{}, reserved...)
+	for _, c := range columns {
+		reserved = qb.addColumnFilters(c, c.Name, reserved)
+	}
+
+	ret := &cmds2.SqlCommandDescription{
+		Name:  "list",
+		Short: fmt.Sprintf("List the rows of %s", t.Name),
+		Long:  long,
+	}
+
+	if len(primaryKey) > 0 {
+		keys := []*pagination.Key{}
+		for _, c := range primaryKey {
+			keys = append(keys, &pagination.Key{Column: c.Name})
+		}
+		ret.Keys = columnNames(primaryKey)
+		ret.Pagination = &pagination.Pagination{Keys: keys, PageSizeFlag: "limit"}
+		qb.printf("\n{{ if .pagination.where }}  AND {{ .pagination.where }}{{ end }}")
+		qb.printf("\nORDER BY {{ .pagination.order_by }}")
+		qb.printf("\nLIMIT {{ .pagination.limit }}")
+	} else {
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "offset",
+			Type:    parameters.ParameterTypeInteger,
+			Help:    "Offset the number of rows (default: 0)",
+			Default: 0,
+		})
+		qb.printf("\n{{ if .limit }}LIMIT {{ .limit }}{{ end }}")
+		qb.printf("\n{{ if .offset }}OFFSET {{ .offset }}{{ end }}")
+	}
+
+	ret.Flags = qb.flags
+	ret.Query = qb.query.String()
+	return ret
+}
+
+// generateGet selects a single row by primary key.
+// The flag of a key column is named after it, or <column>_key if the name is reserved.
+func generateGet(
+	t *schema.Table, table string,
+	primaryKey []*schema.Column,
+	reserved []string, long string,
+) *cmds2.SqlCommandDescription {
+	qb := &queryBuilder{}
+	qb.printf("SELECT * FROM %s\nWHERE ", table)
+	for i, c := range primaryKey {
+		name := c.Name
+		if containsColumn(reserved, name) {
+			name += "_key"
+		}
+		type_ := parameters.ParameterTypeString
+		value := fmt.Sprintf("'{{ sqlEscape .%s }}'", name)
+		switch c.Kind() {
+		case schema.KindInt:
+			type_ = parameters.ParameterTypeInteger
+			value = fmt.Sprintf("{{ .%s }}", name)
+		case schema.KindFloat:
+			type_ = parameters.ParameterTypeFloat
+			value = fmt.Sprintf("{{ .%s }}", name)
+		case schema.KindDate:
+			type_ = parameters.ParameterTypeDate
+			value = fmt.Sprintf("{{ sqlDate .%s }}", name)
+		}
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:     name,
+			Type:     type_,
+			Help:     columnHelp(c, "Value of %s"),
+			Required: true,
+		})
+		if i > 0 {
+			qb.printf(" AND ")
+		}
+		qb.printf("%s = %s", c.Name, value)
+	}
+
+	return &cmds2.SqlCommandDescription{
+		Name:  "get",
+		Short: fmt.Sprintf("Get a row of %s by %s", t.Name, strings.Join(columnNames(primaryKey), ", ")),
+		Long:  long,
+		Flags: qb.flags,
+		Query: qb.query.String(),
+		Keys:  columnNames(primaryKey),
+	}
+}
+
+// generateCount counts the rows of the table, filtered by column and grouped by the --by columns.
+func generateCount(
+	t *schema.Table, table string,
+	columns []*schema.Column,
+	reserved []string, long string,
+) *cmds2.SqlCommandDescription {
+	qb := &queryBuilder{}
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name:    "by",
+		Type:    parameters.ParameterTypeChoiceList,
+		Help:    "Columns to count the rows by",
+		Choices: columnNames(columns),
+	})
+	qb.printf("SELECT {{ range .by }}{{ . }}, {{ end }}COUNT(*) AS count FROM %s", table)
+
+	qb.addWhereFlag()
+	reserved = append([]string{}, reserved...)
+	for _, c := range columns {
+		reserved = qb.addColumnFilters(c, c.Name, reserved)
+	}
+	qb.printf("\n{{ if .by }}GROUP BY {{ join \", \" .by }}")
+	qb.printf("\nORDER BY count DESC{{ end }}")
+
+	return &cmds2.SqlCommandDescription{
+		Name:  "count",
+		Short: fmt.Sprintf("Count the rows of %s", t.Name),
+		Long:  long,
+		Flags: qb.flags,
+		Query: qb.query.String(),
+	}
+}
+
+// generateRecent selects the most recent rows of the table by one of its date columns.
+func generateRecent(t *schema.Table, table string, columns []*schema.Column, dates []string, long string) *cmds2.SqlCommandDescription {
+	// creation dates are the most likely to be asked for
+	by := dates[0]
+	for _, d := range dates {
+		if strings.Contains(strings.ToLower(d), "creat") {
+			by = d
+			break
+		}
+	}
+
+	qb := &queryBuilder{}
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name:    "columns",
+		Type:    parameters.ParameterTypeChoiceList,
+		Help:    "Columns to select (default: all)",
+		Choices: columnNames(columns),
+	})
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name:    "by",
+		Type:    parameters.ParameterTypeChoice,
+		Help:    fmt.Sprintf("Date column to order the rows by (default: %s)", by),
+		Choices: dates,
+		Default: by,
+	})
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name: "since",
+		Type: parameters.ParameterTypeDate,
+		Help: "Only rows on or after this date",
+	})
+	qb.addFlag(&parameters.ParameterDefinition{
+		Name:    "limit",
+		Type:    parameters.ParameterTypeInteger,
+		Help:    "Limit the number of rows (default: 20)",
+		Default: 20,
+	})
+	qb.printf("SELECT {{ if .columns }}{{ join \", \" .columns }}{{ else }}*{{ end }} FROM %s", table)
+	qb.printf("\n{{ if .since }}WHERE {{ .by }} >= {{ sqlDate .since }}{{ end }}")
+	qb.printf("\nORDER BY {{ .by }} DESC")
+	qb.printf("\n{{ if .limit }}LIMIT {{ .limit }}{{ end }}")
+
+	return &cmds2.SqlCommandDescription{
+		Name:  "recent",
+		Short: fmt.Sprintf("The most recent rows of %s", t.Name),
+		Long:  long,
+		Flags: qb.flags,
+		Query: qb.query.String(),
+	}
+}
+
+func NewGenerateRepositoryCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*GenerateRepositoryCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Generate a repository of query commands for the tables of the database"),
+		cmds.WithLong(generateRepositoryLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"out",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Directory to write the commands to"),
+				parameters.WithRequired(true),
+			),
+			parameters.NewParameterDefinition(
+				"tables",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Tables to generate commands for (default: all)"),
+			),
+			parameters.NewParameterDefinition(
+				"overwrite",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Overwrite existing command files"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &GenerateRepositoryCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		CommandDescription: cmds.NewCommandDescription(
+			"repository",
+			options_...,
+		),
+	}, nil
+}
+
+func init() {
+	dbtParameterLayer, err := sql.NewDbtParameterLayer()
+	if err != nil {
+		panic(err)
+	}
+	sqlConnectionParameterLayer, err := sql.NewSqlConnectionParameterLayer()
+	if err != nil {
+		panic(err)
+	}
+
+	repositoryCommand, err := NewGenerateRepositoryCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+	cobraRepositoryCommand, err := cli.BuildCobraCommandFromGlazeCommand(repositoryCommand)
+	if err != nil {
+		panic(err)
+	}
+	GenerateCmd.AddCommand(cobraRepositoryCommand)
+}
@@ -0,0 +1,71 @@
+package cmds
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestReservedFlags(t *testing.T) {
+	reserved, err := reservedFlags(generatedFlags)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"where", "host", "user", "port", "database", "schema", "fields", "filter",
+		"select", "template", "page_after", "all_pages", "print_query", "log_level", "help",
+	} {
+		assert.Contains(t, reserved, name)
+	}
+}
+
+func TestGenerateTableCommandsLoad(t *testing.T) {
+	reserved, err := reservedFlags(generatedFlags)
+	require.NoError(t, err)
+
+	// columns named like the flags of the connection and glazed layers
+	columns := []*schema.Column{
+		{Name: "host", DataType: "varchar", PrimaryKey: true},
+		{Name: "user", DataType: "text"},
+		{Name: "port", DataType: "int"},
+		{Name: "fields", DataType: "text"},
+		{Name: "select", DataType: "text"},
+		{Name: "template", DataType: "text"},
+		{Name: "created_at", DataType: "timestamp"},
+	}
+	table := &schema.Table{Name: "servers"}
+
+	loader := &cmds2.SqlCommandLoader{}
+	flags := map[string][]string{}
+	for _, description := range generateTableCommands(table, "servers", columns, reserved) {
+		s, err := yaml.Marshal(description)
+		require.NoError(t, err)
+
+		commands, err := loader.LoadCommandFromYAML(bytes.NewReader(s))
+		require.NoError(t, err, description.Name)
+		require.Len(t, commands, 1)
+		command, ok := commands[0].(*cmds2.SqlCommand)
+		require.True(t, ok)
+
+		cobraCommand, err := cli.BuildCobraCommandFromGlazeCommand(command)
+		require.NoError(t, err, description.Name)
+		assert.Equal(t, description.Name, cobraCommand.Name())
+
+		for _, f := range description.Flags {
+			flags[description.Name] = append(flags[description.Name], f.Name)
+		}
+	}
+
+	assert.Contains(t, flags["list"], "host_in")
+	assert.Contains(t, flags["list"], "user_like")
+	assert.Contains(t, flags["list"], "port_min")
+	assert.NotContains(t, flags["list"], "host")
+	assert.NotContains(t, flags["list"], "fields")
+	assert.Equal(t, []string{"host_key"}, flags["get"])
+	assert.Contains(t, flags["count"], "select_in")
+}
@@ -0,0 +1,284 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List and rerun the queries recorded in the history",
+	Long: `When history is enabled in the config file with
+
+  history: true
+
+(or with SQLETON_HISTORY=1), every run of run, query, select and the query commands
+is recorded in ~/.sqleton/history.db, with its flags, rendered query, connection,
+duration, number of rows and error. Passwords are not recorded.`,
+}
+
+type HistoryLsCommand struct {
+	*cmds.CommandDescription
+}
+
+type HistoryLsSettings struct {
+	Limit   int    `glazed.parameter:"limit"`
+	Command string `glazed.parameter:"command"`
+	Errors  bool   `glazed.parameter:"errors"`
+}
+
+func (c *HistoryLsCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &HistoryLsSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	store, err := history.Open(history.DefaultPath())
+	if err != nil {
+		return err
+	}
+	defer func(store *history.Store) {
+		_ = store.Close()
+	}(store)
+
+	entries, err := store.List(ctx, history.ListOptions{
+		Limit:      s.Limit,
+		Command:    s.Command,
+		ErrorsOnly: s.Errors,
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		row := types.NewRow(
+			types.MRP("id", e.ID),
+			types.MRP("started_at", e.StartedAt.Format("2006-01-02 15:04:05")),
+			types.MRP("command", e.Command),
+			types.MRP("args", joinArgs(e.Args)),
+			types.MRP("connection", e.Connection),
+			types.MRP("duration", e.Duration.String()),
+			types.MRP("rows", e.Rows),
+			types.MRP("error", e.Error),
+		)
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewHistoryLsCommand(options ...cmds.CommandDescriptionOption) (*HistoryLsCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("List the most recent entries of the history"),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"limit",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of entries to list, 0 for all"),
+				parameters.WithDefault(20),
+			),
+			parameters.NewParameterDefinition(
+				"command",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Only list the commands containing this string"),
+			),
+			parameters.NewParameterDefinition(
+				"errors",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Only list the commands that failed"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &HistoryLsCommand{
+		CommandDescription: cmds.NewCommandDescription("ls", options_...),
+	}, nil
+}
+
+type HistoryShowCommand struct {
+	*cmds.CommandDescription
+}
+
+func (c *HistoryShowCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	id, _ := ps["id"].(int)
+
+	store, err := history.Open(history.DefaultPath())
+	if err != nil {
+		return err
+	}
+	defer func(store *history.Store) {
+		_ = store.Close()
+	}(store)
+
+	e, err := store.Get(ctx, int64(id))
+	if err != nil {
+		return err
+	}
+
+	if queryOnly, _ := ps["query-only"].(bool); queryOnly {
+		fmt.Println(e.Query)
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	row := types.NewRow(
+		types.MRP("id", e.ID),
+		types.MRP("started_at", e.StartedAt.Format("2006-01-02 15:04:05")),
+		types.MRP("command", e.Command),
+		types.MRP("args", joinArgs(e.Args)),
+		types.MRP("connection", e.Connection),
+		types.MRP("query", e.Query),
+		types.MRP("query_args", e.QueryArgs),
+		types.MRP("duration", e.Duration.String()),
+		types.MRP("rows", e.Rows),
+		types.MRP("error", e.Error),
+	)
+	return gp.AddRow(ctx, row)
+}
+
+func NewHistoryShowCommand(options ...cmds.CommandDescriptionOption) (*HistoryShowCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers(
+		settings.WithOutputParameterLayerOptions(
+			layers.WithDefaults(map[string]interface{}{
+				"output": "yaml",
+			}),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Show an entry of the history, with its query"),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"query-only",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Only print the query"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"id",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Id of the entry, as listed by history ls"),
+				parameters.WithRequired(true),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &HistoryShowCommand{
+		CommandDescription: cmds.NewCommandDescription("show", options_...),
+	}, nil
+}
+
+var historyRerunCmd = &cobra.Command{
+	Use:   "rerun <id> [-- flags]",
+	Short: "Rerun an entry of the history, with the same arguments",
+	Long: `Rerun an entry of the history, with the same arguments. Flags after -- are
+added to them, for example to change the output format:
+
+  sqleton history rerun 12 -- --output json
+
+Passwords are not recorded, use the config file or the environment to pass them.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		cobra.CheckErr(errors.Wrapf(err, "invalid id %s", args[0]))
+
+		store, err := history.Open(history.DefaultPath())
+		cobra.CheckErr(err)
+		e, err := store.Get(cmd.Context(), id)
+		_ = store.Close()
+		cobra.CheckErr(err)
+
+		executable, err := os.Executable()
+		cobra.CheckErr(err)
+
+		rerunArgs := append(append([]string{}, e.Args...), args[1:]...)
+		_, _ = fmt.Fprintf(os.Stderr, "sqleton %s\n", joinArgs(rerunArgs))
+
+		c := exec.CommandContext(cmd.Context(), executable, rerunArgs...)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		err = c.Run()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		cobra.CheckErr(err)
+	},
+}
+
+// joinArgs joins args into a command line, quoting the arguments that need it, the reverse of splitArgs.
+func joinArgs(args []string) string {
+	ret := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?;&|<>(){}[]#~!") {
+			ret[i] = arg
+			continue
+		}
+		ret[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(ret, " ")
+}
+
+func init() {
+	lsCommand, err := NewHistoryLsCommand()
+	if err != nil {
+		panic(err)
+	}
+	cobraLsCommand, err := cli.BuildCobraCommandFromGlazeCommand(lsCommand)
+	if err != nil {
+		panic(err)
+	}
+	HistoryCmd.AddCommand(cobraLsCommand)
+
+	showCommand, err := NewHistoryShowCommand()
+	if err != nil {
+		panic(err)
+	}
+	cobraShowCommand, err := cli.BuildCobraCommandFromGlazeCommand(showCommand)
+	if err != nil {
+		panic(err)
+	}
+	HistoryCmd.AddCommand(cobraShowCommand)
+
+	HistoryCmd.AddCommand(historyRerunCmd)
+}
@@ -0,0 +1,425 @@
+package cmds
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+// sessionDialect describes how to list and kill the sessions of a database server.
+type sessionDialect struct {
+	flavor sqlbuilder.Flavor
+	// from is the table (or view) listing the sessions
+	from string
+	// columns maps the normalized session fields (id, user, host, db, state, time, info)
+	// to the expressions of the sessions table
+	columns map[string]string
+	// self excludes the session that sqleton itself is using
+	self string
+	// userFlag is the name of the flag filtering by user, which can't be `user`
+	// because that would clash with the sql-connection flags.
+	userFlag string
+	// killQuery returns the statement that cancels the running query of a session,
+	// killConnection the statement that terminates the session altogether.
+	killQuery      func(id int64) string
+	killConnection func(id int64) string
+	// signalResult is set when the kill statements return a boolean telling whether
+	// the session was signalled, as pg_cancel_backend and pg_terminate_backend do.
+	signalResult bool
+}
+
+var mysqlSessionDialect = &sessionDialect{
+	flavor: sqlbuilder.MySQL,
+	from:   "information_schema.PROCESSLIST",
+	columns: map[string]string{
+		"id":    "ID",
+		"user":  "USER",
+		"host":  "HOST",
+		"db":    "DB",
+		"state": "STATE",
+		"time":  "TIME",
+		"info":  "INFO",
+	},
+	self:           "ID <> CONNECTION_ID()",
+	userFlag:       "mysql_user",
+	killQuery:      func(id int64) string { return fmt.Sprintf("KILL QUERY %d", id) },
+	killConnection: func(id int64) string { return fmt.Sprintf("KILL CONNECTION %d", id) },
+}
+
+var pgSessionDialect = &sessionDialect{
+	flavor: sqlbuilder.PostgreSQL,
+	from:   "pg_stat_activity",
+	columns: map[string]string{
+		"id":    "pid",
+		"user":  "usename",
+		"host":  "client_addr::text",
+		"db":    "datname",
+		"state": "state",
+		"time":  "COALESCE(EXTRACT(EPOCH FROM now() - query_start)::bigint, 0)",
+		"info":  "query",
+	},
+	self:           "pid <> pg_backend_pid()",
+	userFlag:       "pg_user",
+	killQuery:      func(id int64) string { return fmt.Sprintf("SELECT pg_cancel_backend(%d)", id) },
+	killConnection: func(id int64) string { return fmt.Sprintf("SELECT pg_terminate_backend(%d)", id) },
+	signalResult:   true,
+}
+
+var sessionFields = []string{"id", "user", "host", "db", "state", "time", "info"}
+
+type KillCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+	dialect             *sessionDialect
+}
+
+type KillSettings struct {
+	Ids        []int    `glazed.parameter:"ids"`
+	UserLike   string   `glazed.parameter:"user_like"`
+	Db         string   `glazed.parameter:"db"`
+	DbLike     string   `glazed.parameter:"db_like"`
+	State      []string `glazed.parameter:"state"`
+	Hostname   string   `glazed.parameter:"hostname"`
+	InfoLike   string   `glazed.parameter:"info_like"`
+	MinTime    int      `glazed.parameter:"min_time"`
+	Connection bool     `glazed.parameter:"connection"`
+	Yes        bool     `glazed.parameter:"yes"`
+
+	// Users is filled from the dialect specific user flag
+	Users []string
+}
+
+// buildSelectSessionsQuery returns the query listing the sessions matching the filters,
+// and whether any filter was given at all.
+func (c *KillCommand) buildSelectSessionsQuery(s *KillSettings) (string, []interface{}, bool) {
+	sb := c.dialect.flavor.NewSelectBuilder()
+	columns := []string{}
+	for _, f := range sessionFields {
+		columns = append(columns, sb.As(c.dialect.columns[f], f))
+	}
+	sb.Select(columns...).From(c.dialect.from)
+	sb.Where(c.dialect.self)
+
+	hasFilter := false
+	where := func(expr string) {
+		sb.Where(expr)
+		hasFilter = true
+	}
+	toInterfaces := func(values []string) []interface{} {
+		ret := []interface{}{}
+		for _, v := range values {
+			ret = append(ret, v)
+		}
+		return ret
+	}
+
+	if len(s.Ids) > 0 {
+		ids := []interface{}{}
+		for _, id := range s.Ids {
+			ids = append(ids, id)
+		}
+		where(sb.In(c.dialect.columns["id"], ids...))
+	}
+	if len(s.Users) > 0 {
+		where(sb.In(c.dialect.columns["user"], toInterfaces(s.Users)...))
+	}
+	if s.UserLike != "" {
+		where(sb.Like(c.dialect.columns["user"], "%"+s.UserLike+"%"))
+	}
+	if s.Db != "" {
+		where(sb.Equal(c.dialect.columns["db"], s.Db))
+	}
+	if s.DbLike != "" {
+		where(sb.Like(c.dialect.columns["db"], "%"+s.DbLike+"%"))
+	}
+	if len(s.State) > 0 {
+		where(sb.In(c.dialect.columns["state"], toInterfaces(s.State)...))
+	}
+	if s.Hostname != "" {
+		where(sb.Equal(c.dialect.columns["host"], s.Hostname))
+	}
+	if s.InfoLike != "" {
+		where(sb.Like(c.dialect.columns["info"], "%"+s.InfoLike+"%"))
+	}
+	if s.MinTime > 0 {
+		where(sb.GreaterEqualThan(c.dialect.columns["time"], s.MinTime))
+	}
+	sb.OrderBy(c.dialect.columns["id"])
+
+	query, args := sb.Build()
+	return query, args, hasFilter
+}
+
+func (c *KillCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &KillSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return errors.Wrap(err, "could not initialize kill settings")
+	}
+	s.Users, _ = ps[c.dialect.userFlag].([]string)
+
+	query, args, hasFilter := c.buildSelectSessionsQuery(s)
+	if !hasFilter {
+		return errors.New("refusing to kill all sessions, pass session ids or at least one filter")
+	}
+
+	db, err := c.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not ping database")
+	}
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "could not list sessions")
+	}
+	sessions := []map[string]interface{}{}
+	for rows.Next() {
+		m := map[string]interface{}{}
+		err = rows.MapScan(m)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		for k, v := range m {
+			if b, ok := v.([]byte); ok {
+				m[k] = string(b)
+			}
+		}
+		sessions = append(sessions, m)
+	}
+	_ = rows.Close()
+
+	if len(sessions) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "No matching sessions")
+		return nil
+	}
+
+	action := "query"
+	if s.Connection {
+		action = "connection"
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "%-8s %-16s %-24s %-16s %8s  %s\n", "ID", "USER", "HOST", "DB", "TIME", "INFO")
+	for _, session := range sessions {
+		info := fmt.Sprintf("%v", session["info"])
+		if len(info) > 60 {
+			info = info[:60] + "..."
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "%-8v %-16v %-24v %-16v %8v  %s\n",
+			session["id"], session["user"], session["host"], session["db"], session["time"], info)
+	}
+
+	if !s.Yes {
+		_, _ = fmt.Fprintf(os.Stderr, "Kill the %s of these %d sessions? [y/N] ", action, len(sessions))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			_, _ = fmt.Fprintln(os.Stderr, "Aborted")
+			return nil
+		}
+	}
+
+	for _, session := range sessions {
+		id, err := toInt64(session["id"])
+		if err != nil {
+			return err
+		}
+
+		statement := c.dialect.killQuery(id)
+		if s.Connection {
+			statement = c.dialect.killConnection(id)
+		}
+
+		status, err := c.kill(ctx, db, statement)
+		if err != nil {
+			status = err.Error()
+		}
+
+		row := types.NewRow()
+		for _, f := range sessionFields {
+			row.Set(f, session[f])
+		}
+		row.Set("action", action)
+		row.Set("status", status)
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kill runs the kill statement of a session and returns its status, "not killed" if the
+// server reports that the session could not be signalled.
+func (c *KillCommand) kill(ctx context.Context, db *sqlx.DB, statement string) (string, error) {
+	if !c.dialect.signalResult {
+		_, err := db.ExecContext(ctx, statement)
+		if err != nil {
+			return "", err
+		}
+		return "killed", nil
+	}
+
+	var signalled bool
+	err := db.QueryRowContext(ctx, statement).Scan(&signalled)
+	if err != nil {
+		return "", err
+	}
+	if !signalled {
+		return "not killed", nil
+	}
+	return "killed", nil
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch v_ := v.(type) {
+	case int64:
+		return v_, nil
+	case int32:
+		return int64(v_), nil
+	case int:
+		return int64(v_), nil
+	case uint64:
+		return int64(v_), nil
+	case string:
+		var ret int64
+		_, err := fmt.Sscan(v_, &ret)
+		return ret, err
+	default:
+		return 0, errors.Errorf("unexpected session id %v (%T)", v, v)
+	}
+}
+
+func newKillCommand(
+	dialect *sessionDialect,
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*KillCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"ids",
+				parameters.ParameterTypeIntegerList,
+				parameters.WithHelp("Ids of the sessions to kill"),
+			),
+		),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				dialect.userFlag,
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Filter by user(s)"),
+			),
+			parameters.NewParameterDefinition(
+				"user_like",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Filter by user using LIKE"),
+			),
+			parameters.NewParameterDefinition(
+				"db",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Filter by database"),
+			),
+			parameters.NewParameterDefinition(
+				"db_like",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Filter by database using LIKE"),
+			),
+			parameters.NewParameterDefinition(
+				"state",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Filter by state(s)"),
+			),
+			parameters.NewParameterDefinition(
+				"hostname",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Filter by host"),
+			),
+			parameters.NewParameterDefinition(
+				"info_like",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Filter by query using LIKE"),
+			),
+			parameters.NewParameterDefinition(
+				"min_time",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Only kill sessions running for at least this many seconds"),
+				parameters.WithDefault(0),
+			),
+			parameters.NewParameterDefinition(
+				"connection",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Terminate the whole connection instead of only cancelling the running query"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"yes",
+				parameters.ParameterTypeBool,
+				parameters.WithShortFlag("y"),
+				parameters.WithHelp("Don't ask for confirmation"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &KillCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		dialect:             dialect,
+		CommandDescription:  cmds.NewCommandDescription("kill", options_...),
+	}, nil
+}
+
+func NewMysqlKillCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*KillCommand, error) {
+	return newKillCommand(mysqlSessionDialect, dbConnectionFactory,
+		append([]cmds.CommandDescriptionOption{
+			cmds.WithShort("Kill MySQL queries or connections from the processlist"),
+			cmds.WithLong("Issues KILL QUERY (or KILL CONNECTION with --connection) for the given session ids,\n" +
+				"or for the sessions of information_schema.processlist matching the filters."),
+		}, options...)...)
+}
+
+func NewPgKillCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*KillCommand, error) {
+	return newKillCommand(pgSessionDialect, dbConnectionFactory,
+		append([]cmds.CommandDescriptionOption{
+			cmds.WithShort("Cancel PostgreSQL queries or terminate backends from pg_stat_activity"),
+			cmds.WithLong("Calls pg_cancel_backend (or pg_terminate_backend with --connection) for the given pids,\n" +
+				"or for the sessions of pg_stat_activity matching the filters."),
+		}, options...)...)
+}
@@ -0,0 +1,280 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/load"
+	"github.com/go-go-golems/sqleton/pkg/sink"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+)
+
+const loadLong = `Load CSV, TSV, JSON lines, JSON, XLSX and Parquet files into a table
+of the configured connection.
+
+  sqleton load --table orders --create orders.csv
+  sqleton load --create --mode replace export/*.parquet
+
+The format is detected from the file extension, use --format to override it.
+Without --table, each file is loaded into a table named after the file.
+With --mode replace, the rows of a table are only replaced by the first file loaded into it,
+the following ones are appended, so that all the files given end up in the table.
+
+With --create, a missing table is created with column types inferred from the first
+batch of rows. The types of csv and xlsx columns are inferred from the first
+--sample-size rows, use --no-infer to load them as strings.
+
+Rows are inserted in batches of --batch-size rows, each in its own transaction, except
+with --mode replace, where the table is emptied and refilled in a single transaction. They are inserted using
+COPY FROM STDIN on postgres, LOAD DATA LOCAL INFILE on mysql and prepared statements on sqlite.
+Use --fast-path=false to use plain multi-row INSERT statements instead, for example
+when local_infile is disabled on the mysql server.
+`
+
+type LoadCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+}
+
+type LoadSettings struct {
+	Files       []string               `glazed.parameter:"files"`
+	Table       string                 `glazed.parameter:"table"`
+	Format      string                 `glazed.parameter:"format"`
+	Create      bool                   `glazed.parameter:"create"`
+	Mode        string                 `glazed.parameter:"mode"`
+	Keys        []string               `glazed.parameter:"key"`
+	BatchSize   int                    `glazed.parameter:"batch-size"`
+	ColumnTypes map[string]interface{} `glazed.parameter:"column-types"`
+	FastPath    bool                   `glazed.parameter:"fast-path"`
+	Sheet       string                 `glazed.parameter:"sheet"`
+	Delimiter   string                 `glazed.parameter:"delimiter"`
+	SampleSize  int                    `glazed.parameter:"sample-size"`
+	NoInfer     bool                   `glazed.parameter:"no-infer"`
+	Progress    bool                   `glazed.parameter:"progress"`
+}
+
+func (c *LoadCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &LoadSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	options := load.Options{
+		Format:     s.Format,
+		Sheet:      s.Sheet,
+		SampleSize: s.SampleSize,
+		NoInfer:    s.NoInfer,
+	}
+	if s.Delimiter != "" {
+		delimiter := []rune(strings.ReplaceAll(s.Delimiter, `\t`, "\t"))
+		if len(delimiter) != 1 {
+			return errors.Errorf("the delimiter must be a single character, got %s", s.Delimiter)
+		}
+		options.Delimiter = delimiter[0]
+	}
+
+	columnTypes := map[string]string{}
+	for k, v := range s.ColumnTypes {
+		columnTypes[k] = fmt.Sprint(v)
+	}
+
+	db, err := c.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not ping database")
+	}
+
+	// loaded are the tables already loaded into by this run
+	loaded := map[string]bool{}
+	for _, file := range s.Files {
+		table := s.Table
+		if table == "" {
+			table = load.TableName(file)
+		}
+		mode := sink.Mode(s.Mode)
+		if mode == sink.ModeReplace && loaded[table] {
+			mode = sink.ModeAppend
+		}
+		loaded[table] = true
+
+		writerOptions := []sink.TableWriterOption{
+			sink.WithMode(mode),
+			sink.WithKeys(s.Keys...),
+			sink.WithBatchSize(s.BatchSize),
+			sink.WithColumnTypes(columnTypes),
+			sink.WithCreateTable(s.Create),
+			sink.WithFastPath(s.FastPath),
+		}
+		if s.Progress {
+			writerOptions = append(writerOptions, sink.WithProgress(printCopyProgress))
+		}
+		w, err := sink.NewTableWriter(db, table, writerOptions...)
+		if err != nil {
+			return err
+		}
+
+		err = load.ReadFile(ctx, file, options, w)
+		if err == nil {
+			err = w.Close(ctx)
+		} else {
+			_ = w.Abort()
+		}
+		if s.Progress && w.Stats().Batches > 0 && isatty.IsTerminal(os.Stderr.Fd()) {
+			_, _ = fmt.Fprintln(os.Stderr)
+		}
+		stats := w.Stats()
+		if err != nil {
+			return errors.Wrapf(err, "loading %s failed after %d rows", file, stats.Rows)
+		}
+
+		elapsed := time.Since(stats.Started)
+		err = gp.AddRow(ctx, types.NewRow(
+			types.MRP("file", file),
+			types.MRP("table", table),
+			types.MRP("mode", string(mode)),
+			types.MRP("created", stats.Created),
+			types.MRP("deleted", stats.Deleted),
+			types.MRP("rows", stats.Rows),
+			types.MRP("batches", stats.Batches),
+			types.MRP("duration_ms", elapsed.Milliseconds()),
+			types.MRP("rows_per_s", rowsPerSecond(stats.Rows, elapsed)),
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewLoadCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*LoadCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Load CSV, JSON, XLSX and Parquet files into a table"),
+		cmds.WithLong(loadLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"table",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Table to load the files into (default: named after each file)"),
+			),
+			parameters.NewParameterDefinition(
+				"format",
+				parameters.ParameterTypeString,
+				parameters.WithHelp(fmt.Sprintf("Format of the files (%s), detected from the extension if empty", strings.Join(load.Formats, ", "))),
+			),
+			parameters.NewParameterDefinition(
+				"create",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Create the table if it doesn't exist"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"mode",
+				parameters.ParameterTypeChoice,
+				parameters.WithHelp("What to do with the rows already in the table"),
+				parameters.WithChoices(sink.Modes),
+				parameters.WithDefault(string(sink.ModeAppend)),
+			),
+			parameters.NewParameterDefinition(
+				"key",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Key columns, used for upsert and as primary key of a created table"),
+			),
+			parameters.NewParameterDefinition(
+				"batch-size",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of rows inserted per transaction"),
+				parameters.WithDefault(5000),
+			),
+			parameters.NewParameterDefinition(
+				"column-types",
+				parameters.ParameterTypeKeyValue,
+				parameters.WithHelp("Column types of a created table, as column:TYPE"),
+			),
+			parameters.NewParameterDefinition(
+				"fast-path",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Use the bulk loading mechanism of the database"),
+				parameters.WithDefault(true),
+			),
+			parameters.NewParameterDefinition(
+				"sheet",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("XLSX sheet to load (default: the first one)"),
+			),
+			parameters.NewParameterDefinition(
+				"delimiter",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Field delimiter of csv files"),
+			),
+			parameters.NewParameterDefinition(
+				"sample-size",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of rows used to infer the column types of csv and xlsx files"),
+				parameters.WithDefault(1000),
+			),
+			parameters.NewParameterDefinition(
+				"no-infer",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Load the values of csv and xlsx files as strings"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"progress",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Report progress on stderr after every batch"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"files",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Files to load"),
+				parameters.WithRequired(true),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &LoadCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		CommandDescription: cmds.NewCommandDescription(
+			"load",
+			options_...,
+		),
+	}, nil
+}
@@ -0,0 +1,51 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoadReplaceSeveralFiles(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	a := filepath.Join(dir, "a.csv")
+	b := filepath.Join(dir, "b.csv")
+	require.NoError(t, os.WriteFile(a, []byte("id,name\n1,a1\n2,a2\n"), 0644))
+	require.NoError(t, os.WriteFile(b, []byte("id,name\n3,b3\n"), 0644))
+
+	c, err := NewLoadCommand(func(map[string]*layers.ParsedParameterLayer) (*sqlx.DB, error) {
+		return sqlx.Connect("sqlite3", dbPath)
+	})
+	require.NoError(t, err)
+
+	ps := map[string]interface{}{
+		"files":      []string{a, b},
+		"table":      "items",
+		"create":     true,
+		"mode":       "replace",
+		"batch-size": 100,
+	}
+	// the second run replaces the rows of the first one, each run keeps all its files
+	for i := 0; i < 2; i++ {
+		gp := middlewares.NewTableProcessor()
+		require.NoError(t, c.Run(context.Background(), map[string]*layers.ParsedParameterLayer{}, ps, gp))
+	}
+
+	db, err := sqlx.Connect("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	names := []string{}
+	require.NoError(t, db.Select(&names, "SELECT name FROM items ORDER BY id"))
+	assert.Equal(t, []string{"a1", "a2", "b3"}, names)
+}
@@ -21,6 +21,7 @@ func init() {
 		),
 		sqleton.WithDbConnectionFactory(sql.OpenDatabaseFromDefaultSqlConnectionLayer),
 		sqleton.WithQuery("SHOW PROCESSLIST"),
+		sqleton.WithKeys([]string{"Id"}),
 	)
 	if err != nil {
 		panic(err)
@@ -30,4 +31,29 @@ func init() {
 		panic(err)
 	}
 	MysqlCmd.AddCommand(cobraPsCommand)
+
+	dbtParameterLayer, err := sql.NewDbtParameterLayer()
+	if err != nil {
+		panic(err)
+	}
+	sqlConnectionParameterLayer, err := sql.NewSqlConnectionParameterLayer()
+	if err != nil {
+		panic(err)
+	}
+
+	killCommand, err := NewMysqlKillCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+	cobraKillCommand, err := cli.BuildCobraCommandFromGlazeCommand(killCommand)
+	if err != nil {
+		panic(err)
+	}
+	MysqlCmd.AddCommand(cobraKillCommand)
 }
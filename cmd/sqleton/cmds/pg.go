@@ -0,0 +1,40 @@
+package cmds
+
+import (
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/spf13/cobra"
+)
+
+var PgCmd = &cobra.Command{
+	Use:   "pg",
+	Short: "PostgreSQL commands",
+}
+
+func init() {
+	dbtParameterLayer, err := sql.NewDbtParameterLayer()
+	if err != nil {
+		panic(err)
+	}
+	sqlConnectionParameterLayer, err := sql.NewSqlConnectionParameterLayer()
+	if err != nil {
+		panic(err)
+	}
+
+	killCommand, err := NewPgKillCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+	cobraKillCommand, err := cli.BuildCobraCommandFromGlazeCommand(killCommand)
+	if err != nil {
+		panic(err)
+	}
+	PgCmd.AddCommand(cobraKillCommand)
+}
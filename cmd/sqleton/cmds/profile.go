@@ -0,0 +1,176 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/profile"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const profileLong = `Compute statistics for each column of a table, one row per column.
+
+  sqleton profile orders
+  sqleton profile orders --columns amount,created --sample 1% --buckets 20
+
+The statistics are the number of NULLs, the number of distinct values, the minimum and maximum,
+the most frequent values, and a histogram of the values for numbers and dates, and of the lengths
+for strings. Use --approx-distinct to estimate the distinct values with a HyperLogLog instead
+of counting them in the database, which is cheaper on large tables.
+
+--sample profiles a random sample of the rows, given as a percentage (1%) or a fraction (0.01),
+using TABLESAMPLE on postgres, RAND() on mysql and random() on sqlite.
+`
+
+type ProfileCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+}
+
+type ProfileSettings struct {
+	Table          string   `glazed.parameter:"table"`
+	Columns        []string `glazed.parameter:"columns"`
+	Sample         string   `glazed.parameter:"sample"`
+	Top            int      `glazed.parameter:"top"`
+	Buckets        int      `glazed.parameter:"buckets"`
+	ApproxDistinct bool     `glazed.parameter:"approx-distinct"`
+}
+
+func (c *ProfileCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &ProfileSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	options := profile.Options{
+		Top:                 s.Top,
+		Buckets:             s.Buckets,
+		ApproximateDistinct: s.ApproxDistinct,
+	}
+	if s.Sample != "" {
+		options.Sample, err = profile.ParseSample(s.Sample)
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := c.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	columns, err := schema.ListColumns(ctx, db, s.Table)
+	if err != nil {
+		return err
+	}
+	if len(s.Columns) > 0 {
+		selected := []*schema.Column{}
+		for _, name := range s.Columns {
+			found := false
+			for _, c := range columns {
+				if strings.EqualFold(c.Name, name) {
+					selected = append(selected, c)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.Errorf("unknown column %s, the columns of %s are: %s",
+					name, s.Table, strings.Join(columnNames(columns), ", "))
+			}
+		}
+		columns = selected
+	}
+
+	profiles, err := profile.Table(ctx, db, s.Table, columns, options)
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		err = gp.AddRow(ctx, p.Row())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewProfileCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*ProfileCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Compute statistics for the columns of a table"),
+		cmds.WithLong(profileLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"columns",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Columns to profile (default: all)"),
+			),
+			parameters.NewParameterDefinition(
+				"sample",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Profile a random sample of the rows (1% or 0.01)"),
+			),
+			parameters.NewParameterDefinition(
+				"top",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of most frequent values to show per column, 0 to disable"),
+				parameters.WithDefault(5),
+			),
+			parameters.NewParameterDefinition(
+				"buckets",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of buckets of the histograms, 0 to disable"),
+				parameters.WithDefault(10),
+			),
+			parameters.NewParameterDefinition(
+				"approx-distinct",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Estimate the number of distinct values with a HyperLogLog"),
+				parameters.WithDefault(false),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"table",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Table to profile"),
+				parameters.WithRequired(true),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &ProfileCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		CommandDescription: cmds.NewCommandDescription(
+			"profile",
+			options_...,
+		),
+	}, nil
+}
@@ -2,13 +2,14 @@ package cmds
 
 import (
 	"context"
-	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
 	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/stream"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -34,6 +35,12 @@ func NewQueryCommand(
 			parameters.WithRequired(true),
 		),
 		),
+		cmds.WithFlags(parameters.NewParameterDefinition(
+			"fetch-size",
+			parameters.ParameterTypeInteger,
+			parameters.WithHelp("Number of rows fetched at once through a server-side cursor on postgres (0 to disable)"),
+			parameters.WithDefault(stream.DefaultFetchSize),
+		)),
 		cmds.WithLayers(glazeParameterLayer),
 	}, options...)
 
@@ -48,9 +55,15 @@ func (q *QueryCommand) Run(
 	parsedLayers map[string]*layers.ParsedParameterLayer,
 	ps map[string]interface{},
 	gp middlewares.Processor,
-) error {
+) (err error) {
 	query := ps["query"].(string)
 
+	h := history.Start(q.Name, parsedLayers)
+	defer func() {
+		h.Finish(err)
+	}()
+	gp = h.Processor(gp)
+
 	db, err := q.dbConnectionFactory(parsedLayers)
 	if err != nil {
 		return err
@@ -64,7 +77,10 @@ func (q *QueryCommand) Run(
 		return err
 	}
 
-	err = sql.RunNamedQueryIntoGlaze(ctx, db, query, map[string]interface{}{}, gp)
+	h.AddQuery(query)
+	fetchSize, _ := ps["fetch-size"].(int)
+	// :name tokens are parameters, which can't be given on the command line
+	err = stream.RunNamedQueryIntoGlaze(ctx, db, query, map[string]interface{}{}, gp, stream.WithFetchSize(fetchSize))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,482 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	replPrompt             = "sqleton> "
+	replContinuationPrompt = "      -> "
+)
+
+const replHelp = `Statements are terminated by ';' and can span multiple lines.
+
+Meta-commands:
+  \d              list the tables of the current database
+  \d TABLE        describe the columns of TABLE
+  \x              toggle expanded (one field per line) output
+  \o [FORMAT]     set the output format (table, csv, json, yaml, markdown, ...), reset if empty
+  \run CMD ARGS   run a loaded sqleton command, for example: \run wp ls-posts --limit 5
+  \?              show this help
+  \q              quit
+`
+
+// ReplCommand opens an interactive SQL shell on the configured connection.
+// Query results are rendered through the glazed pipeline configured by the glazed flags,
+// and the loaded sqleton commands can be run from inside the shell.
+type ReplCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+	commands            []cmds.Command
+}
+
+type repl struct {
+	db           *sqlx.DB
+	parsedLayers map[string]*layers.ParsedParameterLayer
+	ps           map[string]interface{}
+	commands     map[string]cmds.GlazeCommand
+
+	// output overrides the glazed output format when set through \o
+	output   string
+	expanded bool
+
+	// pending holds the lines of a statement that has not been terminated yet
+	pending   strings.Builder
+	completer *replCompleter
+}
+
+func (c *ReplCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+) error {
+	db, err := c.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return errors.Wrap(err, "could not open database")
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not ping database")
+	}
+
+	// glazed cancels the context of the command on the first Ctrl-C, which only interrupts
+	// what is running in the session, see interruptible. The session ends with \q or Ctrl-D.
+	ctx = context.Background()
+
+	r := &repl{
+		db:           db,
+		parsedLayers: parsedLayers,
+		ps:           ps,
+		commands:     commandsByPath(c.commands),
+	}
+	r.completer = newReplCompleter(ctx, r)
+
+	historyFile, _ := ps["history-file"].(string)
+	if historyFile != "" {
+		historyFile = os.ExpandEnv(historyFile)
+		_ = os.MkdirAll(filepath.Dir(historyFile), 0755)
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 replPrompt,
+		HistoryFile:            historyFile,
+		AutoComplete:           r.completer,
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "\\q",
+		DisableAutoSaveHistory: true,
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not initialize line editor")
+	}
+	defer func(rl *readline.Instance) {
+		_ = rl.Close()
+	}(rl)
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			// Ctrl-C discards the statement being edited
+			r.pending.Reset()
+			rl.SetPrompt(replPrompt)
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if r.pending.Len() == 0 {
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "\\") {
+				_ = rl.SaveHistory(trimmed)
+				quit := false
+				err = r.interruptible(ctx, "command", func(ctx context.Context) error {
+					var err error
+					quit, err = r.runMetaCommand(ctx, trimmed)
+					return err
+				})
+				if err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				}
+				if quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		r.pending.WriteString(line)
+		r.pending.WriteString("\n")
+		if !strings.HasSuffix(trimmed, ";") {
+			rl.SetPrompt(replContinuationPrompt)
+			continue
+		}
+
+		statement := strings.TrimSpace(r.pending.String())
+		r.pending.Reset()
+		rl.SetPrompt(replPrompt)
+		_ = rl.SaveHistory(strings.Join(strings.Fields(statement), " "))
+
+		err = r.interruptible(ctx, "query", func(ctx context.Context) error {
+			return r.runQuery(ctx, strings.TrimSuffix(statement, ";"))
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+	}
+}
+
+// interruptible runs f with a context that is canceled by a Ctrl-C, so that interrupting
+// a long query, meta-command or \run command returns to the prompt instead of ending the session.
+// what names what was canceled in the returned error.
+func (r *repl) interruptible(ctx context.Context, what string, f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := f(ctx)
+	// an interrupted query can end without error, as if it had no more rows
+	if ctx.Err() != nil {
+		return errors.Errorf("%s canceled", what)
+	}
+	return err
+}
+
+// createProcessor creates a glazed processor writing to stdout out of the glazed parameters in ps,
+// honoring the output format and expanded mode selected through meta-commands.
+func (r *repl) createProcessor(ps map[string]interface{}, overrideOutput bool) (*middlewares.TableProcessor, error) {
+	ps_ := map[string]interface{}{}
+	for k, v := range ps {
+		ps_[k] = v
+	}
+	if overrideOutput && r.output != "" {
+		ps_["output"] = r.output
+	}
+
+	gp, err := settings.SetupTableProcessor(ps_)
+	if err != nil {
+		return nil, err
+	}
+	_, err = settings.SetupProcessorOutput(gp, ps_, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.expanded {
+		record := 0
+		gp.AddRowMiddlewareInFront(row.NewLambdaMiddleware(
+			func(ctx context.Context, row_ types.Row) ([]types.Row, error) {
+				record++
+				ret := []types.Row{}
+				for pair := row_.Oldest(); pair != nil; pair = pair.Next() {
+					ret = append(ret, types.NewRow(
+						types.MRP("record", record),
+						types.MRP("field", pair.Key),
+						types.MRP("value", pair.Value),
+					))
+				}
+				return ret, nil
+			}))
+	}
+
+	return gp, nil
+}
+
+func (r *repl) runQuery(ctx context.Context, query string) error {
+	gp, err := r.createProcessor(r.ps, true)
+	if err != nil {
+		return err
+	}
+
+	err = sql.RunQueryIntoGlaze(ctx, r.db, query, []interface{}{}, gp)
+	if err != nil {
+		return err
+	}
+
+	// the statement might have changed the schema
+	r.completer.invalidate(query)
+
+	return gp.Close(ctx)
+}
+
+// runMetaCommand executes a backslash command. It returns true if the REPL should exit.
+func (r *repl) runMetaCommand(ctx context.Context, line string) (bool, error) {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		return false, err
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "\\q", "\\quit":
+		return true, nil
+
+	case "\\?", "\\h", "\\help":
+		fmt.Print(replHelp)
+
+	case "\\x":
+		r.expanded = !r.expanded
+		if r.expanded {
+			fmt.Println("Expanded display is on.")
+		} else {
+			fmt.Println("Expanded display is off.")
+		}
+
+	case "\\o":
+		if len(args) > 2 {
+			return false, errors.New("usage: \\o [FORMAT]")
+		}
+		if len(args) == 1 {
+			r.output = ""
+			fmt.Println("Output format reset.")
+		} else {
+			r.output = args[1]
+			fmt.Printf("Output format is %s.\n", r.output)
+		}
+
+	case "\\d":
+		if len(args) > 2 {
+			return false, errors.New("usage: \\d [TABLE]")
+		}
+		if len(args) == 1 {
+			return false, r.listTables(ctx)
+		}
+		return false, r.describeTable(ctx, args[1])
+
+	case "\\run":
+		return false, r.runCommand(ctx, args[1:])
+
+	default:
+		return false, errors.Errorf("unknown meta-command %s, try \\?", args[0])
+	}
+
+	return false, nil
+}
+
+func (r *repl) listTables(ctx context.Context) error {
+	tables, err := schema.ListTables(ctx, r.db)
+	if err != nil {
+		return err
+	}
+
+	gp, err := r.createProcessor(r.ps, true)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		err = gp.AddRow(ctx, types.NewRow(
+			types.MRP("schema", t.Schema),
+			types.MRP("name", t.Name),
+			types.MRP("type", t.Type),
+			types.MRP("comment", t.Comment),
+		))
+		if err != nil {
+			return err
+		}
+	}
+	return gp.Close(ctx)
+}
+
+func (r *repl) describeTable(ctx context.Context, table string) error {
+	columns, err := schema.ListColumns(ctx, r.db, table)
+	if err != nil {
+		return err
+	}
+
+	gp, err := r.createProcessor(r.ps, true)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		err = gp.AddRow(ctx, types.NewRow(
+			types.MRP("column", c.Name),
+			types.MRP("type", c.Type),
+			types.MRP("nullable", c.Nullable),
+			types.MRP("primary_key", c.PrimaryKey),
+			types.MRP("comment", c.Comment),
+		))
+		if err != nil {
+			return err
+		}
+	}
+	return gp.Close(ctx)
+}
+
+func (r *repl) runCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		paths := make([]string, 0, len(r.commands))
+		for path := range r.commands {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fmt.Println(strings.Join(paths, "\n"))
+		return nil
+	}
+
+	command, args, err := findCommand(r.commands, args)
+	if err != nil {
+		return err
+	}
+
+	// run the command against the same connection as the REPL itself
+	cmd, parsedLayers, ps, err := parseCommandArgs(command, args, r.parsedLayers)
+	if err != nil {
+		return err
+	}
+
+	gp, err := r.createProcessor(ps, !cmd.Flags().Changed("output"))
+	if err != nil {
+		return err
+	}
+
+	err = command.Run(ctx, parsedLayers, ps, gp)
+	if _, ok := err.(*cmds.ExitWithoutGlazeError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return gp.Close(ctx)
+}
+
+// splitCommandLine splits a meta-command line into words, honoring single and double quotes
+// as well as backslash escapes inside double quotes.
+func splitCommandLine(line string) ([]string, error) {
+	ret := []string{}
+	var current strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				ret = append(ret, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		ret = append(ret, current.String())
+	}
+
+	return ret, nil
+}
+
+func NewReplCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	commands []cmds.Command,
+	options ...cmds.CommandDescriptionOption,
+) (*ReplCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Run an interactive SQL shell"),
+		cmds.WithLong(replHelp),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"history-file",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("File to persist the shell history to (empty to disable)"),
+				parameters.WithDefault("$HOME/.sqleton/repl_history"),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &ReplCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		commands:            commands,
+		CommandDescription: cmds.NewCommandDescription(
+			"repl",
+			options_...,
+		),
+	}, nil
+}
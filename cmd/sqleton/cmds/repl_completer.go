@@ -0,0 +1,217 @@
+package cmds
+
+import (
+	"context"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var replMetaCommands = []string{"\\d", "\\x", "\\o", "\\run", "\\?", "\\q"}
+
+var replOutputFormats = []string{"table", "csv", "tsv", "markdown", "html", "json", "yaml", "excel", "sql"}
+
+var sqlKeywords = []string{
+	"SELECT", "FROM", "WHERE", "AND", "OR", "NOT", "IN", "IS", "NULL", "LIKE", "BETWEEN",
+	"JOIN", "LEFT", "RIGHT", "INNER", "OUTER", "ON", "USING", "AS", "DISTINCT",
+	"GROUP", "BY", "ORDER", "HAVING", "LIMIT", "OFFSET", "ASC", "DESC", "UNION", "ALL",
+	"INSERT", "INTO", "VALUES", "UPDATE", "SET", "DELETE", "CREATE", "TABLE", "DROP", "ALTER",
+	"COUNT", "SUM", "AVG", "MIN", "MAX", "CASE", "WHEN", "THEN", "ELSE", "END", "EXPLAIN",
+}
+
+// replCompleter completes meta-commands, loaded sqleton command names and flags,
+// as well as SQL keywords and the table and column names of the connected schema.
+//
+// Table names are loaded once, column names are loaded lazily for the tables
+// that are mentioned in the statement being edited.
+type replCompleter struct {
+	ctx context.Context
+	r   *repl
+
+	mu      sync.Mutex
+	tables  []string
+	columns map[string][]string
+}
+
+func newReplCompleter(ctx context.Context, r *repl) *replCompleter {
+	return &replCompleter{
+		ctx:     ctx,
+		r:       r,
+		columns: map[string][]string{},
+	}
+}
+
+// invalidate drops the cached schema if the statement looks like it changed it.
+func (c *replCompleter) invalidate(statement string) {
+	s := strings.ToUpper(strings.TrimSpace(statement))
+	for _, prefix := range []string{"CREATE", "DROP", "ALTER", "RENAME"} {
+		if strings.HasPrefix(s, prefix) {
+			c.mu.Lock()
+			c.tables = nil
+			c.columns = map[string][]string{}
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *replCompleter) getTables() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tables == nil {
+		c.tables = []string{}
+		tables, err := schema.ListTables(c.ctx, c.r.db)
+		if err == nil {
+			for _, t := range tables {
+				c.tables = append(c.tables, t.Name)
+			}
+		}
+	}
+	return c.tables
+}
+
+func (c *replCompleter) getColumns(table string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if columns, ok := c.columns[table]; ok {
+		return columns
+	}
+	ret := []string{}
+	columns, err := schema.ListColumns(c.ctx, c.r.db, table)
+	if err == nil {
+		for _, col := range columns {
+			ret = append(ret, col.Name)
+		}
+	}
+	c.columns[table] = ret
+	return ret
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '$'
+}
+
+// mentionedTables returns the known tables that appear as words in text.
+func (c *replCompleter) mentionedTables(text string) []string {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool { return !isIdentifierRune(r) }) {
+		words[strings.ToLower(w)] = true
+	}
+
+	ret := []string{}
+	for _, t := range c.getTables() {
+		if words[strings.ToLower(t)] {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+func (c *replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+
+	start := strings.LastIndexFunc(text, func(r rune) bool {
+		return !isIdentifierRune(r) && r != '\\' && r != '-'
+	}) + 1
+	prefix := text[start:]
+	words := strings.Fields(text[:start])
+
+	var candidates []string
+	switch {
+	case c.r.pending.Len() == 0 && len(words) == 0 && strings.HasPrefix(prefix, "\\"):
+		candidates = replMetaCommands
+
+	case c.r.pending.Len() == 0 && len(words) > 0 && words[0] == "\\run":
+		candidates = c.commandCandidates(words[1:])
+
+	case c.r.pending.Len() == 0 && len(words) == 1 && words[0] == "\\d":
+		candidates = c.getTables()
+
+	case c.r.pending.Len() == 0 && len(words) == 1 && words[0] == "\\o":
+		candidates = replOutputFormats
+
+	case strings.Contains(prefix, "."):
+		// complete table.column
+		table, _ := schema.SplitTableName(prefix)
+		for _, col := range c.getColumns(table) {
+			candidates = append(candidates, table+"."+col)
+		}
+
+	default:
+		candidates = append(candidates, c.getTables()...)
+		for _, t := range c.mentionedTables(c.r.pending.String() + text) {
+			candidates = append(candidates, c.getColumns(t)...)
+		}
+		upperPrefix := strings.ToUpper(prefix)
+		for _, k := range sqlKeywords {
+			if prefix != "" && strings.HasPrefix(k, upperPrefix) {
+				// keep the case the user is typing in
+				if prefix == strings.ToLower(prefix) {
+					k = strings.ToLower(k)
+				}
+				candidates = append(candidates, k)
+			}
+		}
+	}
+
+	return completeWithPrefix(candidates, prefix), len([]rune(prefix))
+}
+
+// commandCandidates completes the next word of a `\run` line: either the next
+// verb of a command path, or the flags of the command once the path is complete.
+func (c *replCompleter) commandCandidates(words []string) []string {
+	if command, _, err := findCommand(c.r.commands, words); err == nil {
+		ret := []string{}
+		description := command.Description()
+		for _, f := range description.Flags {
+			ret = append(ret, "--"+f.Name)
+		}
+		for _, l := range description.Layers {
+			for name := range l.GetParameterDefinitions() {
+				ret = append(ret, "--"+l.GetPrefix()+name)
+			}
+		}
+		sort.Strings(ret)
+		return ret
+	}
+
+	seen := map[string]bool{}
+	ret := []string{}
+	for path := range c.r.commands {
+		verbs := strings.Split(path, " ")
+		if len(verbs) <= len(words) {
+			continue
+		}
+		match := true
+		for i, w := range words {
+			if verbs[i] != w {
+				match = false
+				break
+			}
+		}
+		if match && !seen[verbs[len(words)]] {
+			seen[verbs[len(words)]] = true
+			ret = append(ret, verbs[len(words)])
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func completeWithPrefix(candidates []string, prefix string) [][]rune {
+	seen := map[string]bool{}
+	ret := [][]rune{}
+	lowerPrefix := strings.ToLower(prefix)
+	for _, candidate := range candidates {
+		if seen[candidate] || !strings.HasPrefix(strings.ToLower(candidate), lowerPrefix) {
+			continue
+		}
+		seen[candidate] = true
+		ret = append(ret, []rune(candidate[len(prefix):]+" "))
+	}
+	return ret
+}
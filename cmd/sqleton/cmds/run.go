@@ -3,7 +3,6 @@ package cmds
 import (
 	"context"
 	"fmt"
-	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
@@ -11,6 +10,8 @@ import (
 	cli "github.com/go-go-golems/glazed/pkg/settings"
 	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/stream"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 
@@ -28,12 +29,18 @@ func (c *RunCommand) Run(
 	ctx context.Context,
 	parsedLayers map[string]*layers.ParsedParameterLayer,
 	ps map[string]interface{},
-	gp middlewares.Processor) error {
+	gp middlewares.Processor) (err error) {
 	inputFiles, ok := ps["input-files"].([]string)
 	if !ok {
 		return fmt.Errorf("input-files is not a string list")
 	}
 
+	h := history.Start(c.Name, parsedLayers)
+	defer func() {
+		h.Finish(err)
+	}()
+	gp = h.Processor(gp)
+
 	db, err := c.dbConnectionFactory(parsedLayers)
 	if err != nil {
 		return errors.Wrap(err, "could not open database")
@@ -48,6 +55,7 @@ func (c *RunCommand) Run(
 	}
 
 	explain, _ := ps["explain"].(bool)
+	fetchSize, _ := ps["fetch-size"].(int)
 
 	for _, arg := range inputFiles {
 		query := ""
@@ -70,8 +78,12 @@ func (c *RunCommand) Run(
 
 		// TODO(2022-12-20, manuel): collect named parameters here, maybe through prerun?
 		// See: https://github.com/wesen/sqleton/issues/40
-		err = sql.RunNamedQueryIntoGlaze(ctx, db, query, map[string]interface{}{}, gp)
-		cobra.CheckErr(err)
+		h.AddQuery(query)
+		// as with query, :name tokens are parameters and :: escapes a colon, for example in postgres casts
+		err = stream.RunNamedQueryIntoGlaze(ctx, db, query, map[string]interface{}{}, gp, stream.WithFetchSize(fetchSize))
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,224 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/schedule"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const scheduleLong = `Run query commands periodically, as listed in a schedule file, and write their
+rows to files, sqlite tables, webhooks or shell commands:
+
+  jobs:
+    - name: orders-daily
+      command: shop orders
+      flags:
+        status: [ paid, shipped ]
+      schedule: "0 6 * * *"
+      sinks:
+        - type: file
+          path: /data/orders-{{ .Time.Format "2006-01-02" }}.csv
+          format: csv
+        - type: sqlite
+          path: /data/snapshots.db
+          table: orders
+          timestamp-column: snapshot_at
+        - type: webhook
+          url: https://hooks.example.com/orders
+        - type: command
+          run: mail -s "orders" ops@example.com
+
+The process runs until interrupted, and logs each run with its duration and number of rows.
+Use --once to run the jobs once, for example to try a schedule file.
+
+The jobs run against the connection of the connection flags, or their connection field,
+a connection name or database URL.
+`
+
+type ScheduleCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory cmds2.DBConnectionFactory
+	commands            []cmds.Command
+}
+
+type ScheduleSettings struct {
+	File string   `glazed.parameter:"file"`
+	Once bool     `glazed.parameter:"once"`
+	Jobs []string `glazed.parameter:"job"`
+}
+
+// scheduledCommand is the command of a job, with its parsed flags.
+type scheduledCommand struct {
+	command      *cmds2.SqlCommand
+	parsedLayers map[string]*layers.ParsedParameterLayer
+	ps           map[string]interface{}
+}
+
+func (c *ScheduleCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &ScheduleSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	f, err := schedule.Load(s.File)
+	if err != nil {
+		return err
+	}
+	jobs := f.Jobs
+	if len(s.Jobs) > 0 {
+		jobs = []*schedule.Job{}
+		for _, job := range f.Jobs {
+			for _, name := range s.Jobs {
+				if job.Name == name {
+					jobs = append(jobs, job)
+				}
+			}
+		}
+		if len(jobs) == 0 {
+			return errors.Errorf("no job named %s", strings.Join(s.Jobs, ", "))
+		}
+	}
+
+	// the commands are parsed upfront, so that a typo fails at startup rather than at the first run
+	commands := commandsByPath(c.commands)
+	scheduled := map[string]*scheduledCommand{}
+	for _, job := range jobs {
+		command, args, err := findCommand(commands, job.Args())
+		if err != nil {
+			return errors.Wrapf(err, "job %s", job.Name)
+		}
+		sqlCommand, ok := command.(*cmds2.SqlCommand)
+		if !ok {
+			return errors.Errorf("job %s: %s is not a query command", job.Name, job.Command)
+		}
+		_, commandLayers, commandPs, err := parseCommandArgs(sqlCommand, args, parsedLayers)
+		if err != nil {
+			return errors.Wrapf(err, "job %s: could not parse the flags of %s", job.Name, job.Command)
+		}
+		scheduled[job.Name] = &scheduledCommand{
+			command:      sqlCommand,
+			parsedLayers: commandLayers,
+			ps:           commandPs,
+		}
+	}
+
+	scheduler := schedule.NewScheduler(jobs, func(ctx context.Context, job *schedule.Job) ([]types.Row, error) {
+		sc := scheduled[job.Name]
+		db, err := openConnection(ctx, c.dbConnectionFactory, sc.parsedLayers, job.Connection)
+		if err != nil {
+			return nil, err
+		}
+		defer func(db *sqlx.DB) {
+			_ = db.Close()
+		}(db)
+		return sc.command.Rows(ctx, db, sc.ps)
+	})
+
+	if !s.Once {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = scheduler.Run(ctx)
+		if err != nil {
+			return err
+		}
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	failed := 0
+	for _, job := range jobs {
+		r := scheduler.RunJob(ctx, job)
+		errorMessage := ""
+		if r.Error != nil {
+			errorMessage = r.Error.Error()
+			failed++
+		}
+		row := types.NewRow(
+			types.MRP("job", r.Job),
+			types.MRP("started_at", r.StartedAt.Format("2006-01-02 15:04:05")),
+			types.MRP("duration", r.Duration.String()),
+			types.MRP("rows", r.Rows),
+			types.MRP("error", errorMessage),
+		)
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		// the results are output before exiting with the error
+		err = gp.Close(ctx)
+		if err != nil {
+			return err
+		}
+		return errors.Errorf("%d of %d jobs failed", failed, len(jobs))
+	}
+
+	return nil
+}
+
+func NewScheduleCommand(
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	commands []cmds.Command,
+	options ...cmds.CommandDescriptionOption,
+) (*ScheduleCommand, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Glazed parameter layer")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Run query commands periodically, as listed in a schedule file"),
+		cmds.WithLong(scheduleLong),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"once",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Run the jobs once and exit, outputting the result of each run"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"job",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Only run these jobs"),
+			),
+		),
+		cmds.WithArguments(
+			parameters.NewParameterDefinition(
+				"file",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Schedule file"),
+				parameters.WithRequired(true),
+			),
+		),
+		cmds.WithLayers(glazedParameterLayer),
+	}, options...)
+
+	return &ScheduleCommand{
+		dbConnectionFactory: dbConnectionFactory,
+		commands:            commands,
+		CommandDescription: cmds.NewCommandDescription(
+			"schedule",
+			options_...,
+		),
+	}, nil
+}
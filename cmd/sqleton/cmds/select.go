@@ -4,7 +4,6 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	sql2 "github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
@@ -12,6 +11,8 @@ import (
 	"github.com/go-go-golems/glazed/pkg/settings"
 	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/stream"
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -37,54 +38,146 @@ type SelectCommand struct {
 }
 
 type SelectCommandSettings struct {
-	Columns  []string `glazed.parameter:"columns"`
-	Limit    int      `glazed.parameter:"limit"`
-	Offset   int      `glazed.parameter:"offset"`
-	Count    bool     `glazed.parameter:"count"`
-	Where    string   `glazed.parameter:"where"`
-	OrderBy  string   `glazed.parameter:"order-by"`
-	Distinct bool     `glazed.parameter:"distinct"`
-	Table    string   `glazed.parameter:"table"`
+	Columns   []string `glazed.parameter:"columns"`
+	Limit     int      `glazed.parameter:"limit"`
+	Offset    int      `glazed.parameter:"offset"`
+	Count     bool     `glazed.parameter:"count"`
+	Where     string   `glazed.parameter:"where"`
+	OrderBy   string   `glazed.parameter:"order-by"`
+	Distinct  bool     `glazed.parameter:"distinct"`
+	Table     string   `glazed.parameter:"table"`
+	Paginate  bool     `glazed.parameter:"paginate"`
+	PageAfter string   `glazed.parameter:"page-after"`
+	AllPages  bool     `glazed.parameter:"all-pages"`
+	Eq        []string `glazed.parameter:"eq"`
+	In        []string `glazed.parameter:"in"`
+	Like      []string `glazed.parameter:"like"`
+	Gt        []string `glazed.parameter:"gt"`
+	Lt        []string `glazed.parameter:"lt"`
+	Between   []string `glazed.parameter:"between"`
+	IsNull    []string `glazed.parameter:"is-null"`
+	Join      []string `glazed.parameter:"join"`
+	LeftJoin  []string `glazed.parameter:"left-join"`
+	GroupBy   []string `glazed.parameter:"group-by"`
+	Agg       []string `glazed.parameter:"agg"`
+	Having    string   `glazed.parameter:"having"`
+
+	// filters are the parsed structured filters, validated against the columns of the table
+	filters []*selectFilter
+	// joins are the parsed joins, with the conditions of the auto-joins resolved
+	joins      []*selectJoin
+	aggregates []*selectAggregate
 }
 
-func (sc *SelectCommand) Run(
-	ctx context.Context,
-	parsedLayers map[string]*layers.ParsedParameterLayer,
-	ps map[string]interface{},
-	gp middlewares.Processor,
-) error {
-	s := &SelectCommandSettings{}
+// grouped returns true if the query aggregates rows with --group-by or --agg.
+func (s *SelectCommandSettings) grouped() bool {
+	return len(s.GroupBy) > 0 || len(s.aggregates) > 0
+}
 
-	// pass in ps so we also get the `table` arguments
-	err := parameters.InitializeStructFromParameters(s, ps)
+// parse parses the filters, joins and aggregates of the settings.
+func (s *SelectCommandSettings) parse() error {
+	var err error
+	s.filters, err = s.parseFilters()
 	if err != nil {
-		return errors.Wrap(err, "Failed to initialize select command settings")
+		return err
 	}
+	s.joins, err = s.parseJoins()
+	if err != nil {
+		return err
+	}
+	s.aggregates, err = s.parseAggregates()
+	if err != nil {
+		return err
+	}
+	if s.Having != "" && !s.grouped() {
+		return errors.New("--having needs --group-by or --agg")
+	}
+	return nil
+}
 
-	sb := sqlbuilder.NewSelectBuilder()
-	sb = sb.From(s.Table)
+// resolve resolves the auto-joins and checks the filters against the columns of the tables.
+func (s *SelectCommandSettings) resolve(ctx context.Context, db *sqlx.DB) error {
+	err := resolveJoins(ctx, db, s.Table, s.joins)
+	if err != nil {
+		return err
+	}
+	return validateFilters(ctx, db, s.Table, s.joins, s.filters)
+}
+
+// selectColumns returns the columns of the SELECT clause.
+//
+// Grouped queries select the --columns, the --group-by columns and the aggregates.
+func (s *SelectCommandSettings) selectColumns() []string {
+	if s.grouped() {
+		columns := append([]string{}, s.Columns...)
+		columns = append(columns, s.GroupBy...)
+		for _, a := range s.aggregates {
+			columns = append(columns, fmt.Sprintf("%s AS %s", a.expr(), a.alias()))
+		}
+		if s.Count {
+			columns = append(columns, "COUNT(*) AS count")
+		}
+		return columns
+	}
 
 	if s.Count {
 		countColumns := strings.Join(s.Columns, ", ")
+		if countColumns == "" {
+			countColumns = "*"
+		}
 		if s.Distinct {
 			countColumns = "DISTINCT " + countColumns
 		}
-		s.Columns = []string{sb.As(fmt.Sprintf("COUNT(%s)", countColumns), "count")}
-	} else {
-		if len(s.Columns) == 0 {
-			s.Columns = []string{"*"}
+		return []string{fmt.Sprintf("COUNT(%s) AS count", countColumns)}
+	}
+
+	if len(s.Columns) == 0 {
+		return []string{"*"}
+	}
+	return s.Columns
+}
+
+// newSelectBuilder returns a builder for the columns, joins, where clause, filters and grouping
+// of the settings, without ORDER BY, LIMIT and OFFSET. The filter values are bound arguments.
+func (s *SelectCommandSettings) newSelectBuilder() *sqlbuilder.SelectBuilder {
+	sb := sqlbuilder.NewSelectBuilder()
+	sb = sb.From(s.Table)
+	for _, j := range s.joins {
+		if j.Left {
+			sb = sb.JoinWithOption(sqlbuilder.LeftJoin, j.table(), j.On)
+		} else {
+			sb = sb.Join(j.table(), j.On)
 		}
 	}
-	sb = sb.Select(s.Columns...)
+
+	sb = sb.Select(s.selectColumns()...)
 	if s.Distinct && !s.Count {
 		sb = sb.Distinct()
 	}
 
 	if s.Where != "" {
-		sb = sb.Where(s.Where)
+		// parenthesized, as other conditions are ANDed to it
+		sb = sb.Where("(" + s.Where + ")")
+	}
+	for _, f := range s.filters {
+		sb = sb.Where(f.expr(&sb.Cond))
+	}
+
+	if len(s.GroupBy) > 0 {
+		sb = sb.GroupBy(s.GroupBy...)
+	}
+	if s.Having != "" {
+		sb = sb.Having(s.Having)
 	}
 
-	if s.Limit > 0 && !s.Count {
+	return sb
+}
+
+// buildQuery returns the SELECT query of the settings, with its limit, offset and ordering.
+func (s *SelectCommandSettings) buildQuery(flavor sqlbuilder.Flavor) (string, []interface{}) {
+	sb := s.newSelectBuilder()
+
+	if s.Limit > 0 && !(s.Count && !s.grouped()) {
 		sb = sb.Limit(s.Limit)
 	}
 	if s.Offset > 0 {
@@ -94,102 +187,44 @@ func (sc *SelectCommand) Run(
 		sb = sb.OrderBy(s.OrderBy)
 	}
 
-	createQuery, _ := ps["create-query"].(string)
-
-	if createQuery != "" {
-		short := fmt.Sprintf("Select"+" columns from %s", s.Table)
-		if s.Count {
-			short = fmt.Sprintf("Count all rows from %s", s.Table)
-		}
-		if s.Where != "" {
-			short = fmt.Sprintf("Select"+" from %s where %s", s.Table, s.Where)
-		}
-
-		flags := []*parameters.ParameterDefinition{}
-		if s.Where == "" {
-			flags = append(flags, &parameters.ParameterDefinition{
-				Name: "where",
-				Type: parameters.ParameterTypeString,
-			})
-		}
-		if !s.Count {
-			flags = append(flags, &parameters.ParameterDefinition{
-				Name:    "limit",
-				Type:    parameters.ParameterTypeInteger,
-				Help:    fmt.Sprintf("Limit the number of rows (default: %d), set to 0 to disable", s.Limit),
-				Default: s.Limit,
-			})
-			flags = append(flags, &parameters.ParameterDefinition{
-				Name:    "offset",
-				Type:    parameters.ParameterTypeInteger,
-				Help:    fmt.Sprintf("Offset the number of rows (default: %d)", s.Offset),
-				Default: s.Offset,
-			})
-			flags = append(flags, &parameters.ParameterDefinition{
-				Name:    "distinct",
-				Type:    parameters.ParameterTypeBool,
-				Help:    fmt.Sprintf("Whether to select distinct rows (default: %t)", s.Distinct),
-				Default: s.Distinct,
-			})
-
-			orderByHelp := "Order by"
-			var orderDefault interface{}
-			if s.OrderBy != "" {
-				orderByHelp = fmt.Sprintf("Order by (default: %s)", s.OrderBy)
-				orderDefault = s.OrderBy
-			}
-			flags = append(flags, &parameters.ParameterDefinition{
-				Name:    "order_by",
-				Type:    parameters.ParameterTypeString,
-				Help:    orderByHelp,
-				Default: orderDefault,
-			})
-		}
+	return sb.BuildWithFlavor(flavor)
+}
 
-		sb := &strings.Builder{}
-		_, _ = fmt.Fprintf(sb, "SELECT ")
-		if !s.Count {
-			_, _ = fmt.Fprintf(sb, "{{ if .distinct }}DISTINCT{{ end }} ")
-		}
-		_, _ = fmt.Fprintf(sb, "%s FROM %s", strings.Join(s.Columns, ", "), s.Table)
-		if s.Where != "" {
-			_, _ = fmt.Fprintf(sb, " WHERE %s", s.Where)
-		} else {
-			_, _ = fmt.Fprintf(sb, "\n{{ if .where  }}  WHERE {{.where}} {{ end }}")
-		}
+func (sc *SelectCommand) Run(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) (err error) {
+	s := &SelectCommandSettings{}
 
-		_, _ = fmt.Fprintf(sb, "\n{{ if .order_by }} ORDER BY {{ .order_by }}{{ end }}")
-		_, _ = fmt.Fprintf(sb, "\n{{ if .limit }} LIMIT {{ .limit }}{{ end }}")
-		_, _ = fmt.Fprintf(sb, "\nOFFSET {{ .offset }}")
-
-		query := sb.String()
-		sqlCommand, err := cmds2.NewSqlCommand(&cmds.CommandDescription{
-			Name:  createQuery,
-			Short: short,
-			Flags: flags,
-		},
-			cmds2.WithDbConnectionFactory(sql2.OpenDatabaseFromDefaultSqlConnectionLayer),
-			cmds2.WithQuery(query),
-		)
-		if err != nil {
-			return err
-		}
+	h := history.Start(sc.Name, parsedLayers)
+	defer func() {
+		h.Finish(err)
+	}()
+	gp = h.Processor(gp)
 
-		// marshal to yaml
-		yamlBytes, err := yaml.Marshal(sqlCommand)
-		if err != nil {
-			return err
-		}
+	// pass in ps so we also get the `table` arguments
+	err = parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return errors.Wrap(err, "Failed to initialize select command settings")
+	}
 
-		fmt.Println(string(yamlBytes))
-		return nil
+	err = s.parse()
+	if err != nil {
+		return err
 	}
 
-	query, queryArgs := sb.Build()
+	if s.Paginate || s.PageAfter != "" || s.AllPages {
+		return sc.runPages(ctx, parsedLayers, ps, s, gp, h)
+	}
 
+	createQuery, _ := ps["create-query"].(string)
 	printQuery, _ := ps["print-query"].(bool)
 
-	if printQuery {
+	if printQuery && createQuery == "" && len(s.filters) == 0 && len(s.joins) == 0 {
+		// there is nothing to check against the schema, so the query is printed without connecting
+		query, queryArgs := s.buildQuery(sqlbuilder.DefaultFlavor)
 		fmt.Println(query)
 		fmt.Println(queryArgs)
 		return nil
@@ -208,7 +243,48 @@ func (sc *SelectCommand) Run(
 		return err
 	}
 
-	err = sql2.RunQueryIntoGlaze(ctx, db, query, queryArgs, gp)
+	err = s.resolve(ctx, db)
+	if err != nil {
+		return err
+	}
+	flavor := builderFlavor(db)
+
+	if createQuery != "" {
+		description, err := s.createQuery(ctx, db, createQuery, flavor)
+		if err != nil {
+			return err
+		}
+
+		if createQueryDir, _ := ps["create-query-dir"].(string); createQueryDir != "" {
+			path, err := writeCommandFile(createQueryDir, description, false)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("wrote %s\n", path)
+			return nil
+		}
+
+		// marshal to yaml
+		yamlBytes, err := yaml.Marshal(description)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(yamlBytes))
+		return nil
+	}
+
+	query, queryArgs := s.buildQuery(flavor)
+
+	if printQuery {
+		fmt.Println(query)
+		fmt.Println(queryArgs)
+		return nil
+	}
+
+	fetchSize, _ := ps["fetch-size"].(int)
+	h.AddQuery(query, queryArgs...)
+	err = stream.RunQueryIntoGlaze(ctx, db, query, queryArgs, gp, stream.WithFetchSize(fetchSize))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,391 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// aggregateTemplate renders the agg flag of a generated command the way --agg is rendered by select.
+const aggregateTemplate = `{{- range .agg }}{{ $a := splitn ":" 2 . }}` +
+	`{{ $alias := printf "%s_%s" $a._0 (last (splitList "." $a._1)) }}{{ if eq $a._1 "*" }}{{ $alias = $a._0 }}{{ end }}` +
+	`{{ $columns = append $columns (printf "%s(%s) AS %s" (upper $a._0) $a._1 $alias) }}{{ end }}`
+
+// flagNameRegexp matches the column names that can be used as flag names and template fields.
+var flagNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// createQueryFlags are the flags of generated commands that are not column filters.
+var createQueryFlags = []string{"where", "columns", "limit", "offset", "distinct", "order_by", "group_by", "agg", "having"}
+
+// rootFlags are the persistent flags of the sqleton root command, inherited by every command.
+var rootFlags = []string{"help", "config", "verbose", "log_level", "log_format", "log_file", "with_caller", "mem_profile"}
+
+// reservedFlags returns flags, followed by the names of the flags every command file gets when it is loaded:
+// the flags of the layers of sql commands, pagination included, and of the root command.
+// Column filters must not use these names, as the command could then not be loaded.
+// The names are written with underscores, as flags are in command files.
+func reservedFlags(flags []string) ([]string, error) {
+	c, err := cmds2.NewSqlCommand(
+		cmds.NewCommandDescription("reserved"),
+		cmds2.WithPagination(&pagination.Pagination{Keys: []*pagination.Key{{Column: "id"}}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := append([]string{}, flags...)
+	ret = append(ret, rootFlags...)
+	for _, l := range c.Layers {
+		for name := range l.GetParameterDefinitions() {
+			ret = append(ret, strings.ReplaceAll(name, "-", "_"))
+		}
+	}
+	return ret, nil
+}
+
+// queryBuilder accumulates the flags and the query template of a generated command.
+type queryBuilder struct {
+	flags []*parameters.ParameterDefinition
+	query strings.Builder
+}
+
+func (qb *queryBuilder) addFlag(flag *parameters.ParameterDefinition) {
+	qb.flags = append(qb.flags, flag)
+}
+
+func (qb *queryBuilder) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(&qb.query, format, args...)
+}
+
+// createQuery returns the description of a sqleton command running the query described by the settings,
+// as it is written in a command file.
+//
+// The joins and the where clause are part of the query, the filters are inlined as literals
+// quoted for flavor, and the columns, limit, offset, order and grouping become flags of the command.
+// Each column of the table also gets filter flags depending on its type: `<column>` (one of the values)
+// and `<column>_like` for strings, `<column>_min` and `<column>_max` for numbers, and
+// `<column>_from` and `<column>_to` for dates.
+func (s *SelectCommandSettings) createQuery(
+	ctx context.Context,
+	db *sqlx.DB,
+	name string,
+	flavor sqlbuilder.Flavor,
+) (*cmds2.SqlCommandDescription, error) {
+	where := s.Where
+	if len(s.filters) > 0 {
+		filterWhere, err := interpolateFilters(s.filters, flavor)
+		if err != nil {
+			return nil, err
+		}
+		if where != "" {
+			where = fmt.Sprintf("(%s) AND %s", where, filterWhere)
+		} else {
+			where = filterWhere
+		}
+	}
+
+	columns, err := schema.ListColumns(ctx, db, s.Table)
+	if err != nil {
+		return nil, err
+	}
+	_, tableName := schema.SplitTableName(s.Table)
+	// with joins, the columns of the table are qualified to avoid ambiguities
+	qualifier := ""
+	if len(s.joins) > 0 {
+		qualifier = tableName + "."
+	}
+
+	from := s.Table
+	for _, j := range s.joins {
+		from += " " + j.String()
+	}
+
+	short := fmt.Sprintf("Select"+" columns from %s", s.Table)
+	if s.Count {
+		short = fmt.Sprintf("Count all rows from %s", s.Table)
+	}
+	if s.grouped() {
+		short = fmt.Sprintf("Aggregate rows from %s", s.Table)
+	}
+	if where != "" {
+		short = fmt.Sprintf("Select"+" from %s where %s", s.Table, where)
+	}
+
+	qb := &queryBuilder{}
+	if where == "" {
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: "where",
+			Type: parameters.ParameterTypeString,
+			Help: "Additional where clause, as raw SQL",
+		})
+	}
+
+	counting := s.Count && !s.grouped()
+	if !counting {
+		choices := []string{}
+		for _, c := range columns {
+			choices = append(choices, qualifier+c.Name)
+		}
+		for _, j := range s.joins {
+			joinedColumns, err := schema.ListColumns(ctx, db, j.Table)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range joinedColumns {
+				choices = append(choices, j.name()+"."+c.Name)
+			}
+		}
+		// --columns can be expressions, which have to be valid choices for the default
+		for _, c := range s.Columns {
+			if !containsColumn(choices, c) {
+				choices = append(choices, c)
+			}
+		}
+		columnsHelp := "Columns to select (default: all)"
+		if s.grouped() {
+			columnsHelp = "Columns to select along with the group-by columns and the aggregates"
+		}
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "columns",
+			Type:    parameters.ParameterTypeChoiceList,
+			Help:    columnsHelp,
+			Choices: choices,
+			Default: s.Columns,
+		})
+
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "limit",
+			Type:    parameters.ParameterTypeInteger,
+			Help:    fmt.Sprintf("Limit the number of rows (default: %d), set to 0 to disable", s.Limit),
+			Default: s.Limit,
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "offset",
+			Type:    parameters.ParameterTypeInteger,
+			Help:    fmt.Sprintf("Offset the number of rows (default: %d)", s.Offset),
+			Default: s.Offset,
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "distinct",
+			Type:    parameters.ParameterTypeBool,
+			Help:    fmt.Sprintf("Whether to select distinct rows (default: %t)", s.Distinct),
+			Default: s.Distinct,
+		})
+
+		// order_by is --order-by on the command line, like the flag of select
+		orderByHelp := "Order by"
+		var orderDefault interface{}
+		if s.OrderBy != "" {
+			orderByHelp = fmt.Sprintf("Order by (default: %s)", s.OrderBy)
+			orderDefault = s.OrderBy
+		}
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "order_by",
+			Type:    parameters.ParameterTypeString,
+			Help:    orderByHelp,
+			Default: orderDefault,
+		})
+	}
+	if s.grouped() {
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "group_by",
+			Type:    parameters.ParameterTypeStringList,
+			Help:    "Columns to group by",
+			Default: s.GroupBy,
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "agg",
+			Type:    parameters.ParameterTypeStringList,
+			Help:    "Aggregates to compute, as function:column (count, sum, avg, min, max)",
+			Default: s.Agg,
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name:    "having",
+			Type:    parameters.ParameterTypeString,
+			Help:    "Condition on the groups",
+			Default: s.Having,
+		})
+	}
+
+	switch {
+	case s.grouped():
+		// the selected columns depend on the columns, group_by and agg flags
+		qb.printf("{{- $columns := list }}{{ range .columns }}{{ $columns = append $columns . }}{{ end }}\n")
+		qb.printf("{{- range .group_by }}{{ $columns = append $columns . }}{{ end }}\n")
+		qb.printf("%s\n", aggregateTemplate)
+		if s.Count {
+			qb.printf("{{- $columns = append $columns \"COUNT(*) AS count\" }}\n")
+		}
+		qb.printf("SELECT {{ if .distinct }}DISTINCT{{ end }} {{ join \", \" $columns }} FROM %s", from)
+	case counting:
+		qb.printf("SELECT %s FROM %s", strings.Join(s.selectColumns(), ", "), from)
+	default:
+		qb.printf("SELECT {{ if .distinct }}DISTINCT{{ end }} {{ if .columns }}{{ join \", \" .columns }}{{ else }}*{{ end }} FROM %s", from)
+	}
+
+	qb.printf("\nWHERE 1=1")
+	if where != "" {
+		qb.printf("\n  AND (%s)", where)
+	} else {
+		qb.printf("\n{{ if .where }}  AND ({{ .where }}){{ end }}")
+	}
+	reserved, err := reservedFlags(createQueryFlags)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		reserved = qb.addColumnFilters(c, qualifier+c.Name, reserved)
+	}
+
+	if s.grouped() {
+		qb.printf("\n{{ if .group_by }}GROUP BY {{ join \", \" .group_by }}{{ end }}")
+		qb.printf("\n{{ if .having }}HAVING {{ .having }}{{ end }}")
+	}
+	if !counting {
+		qb.printf("\n{{ if .order_by }}ORDER BY {{ .order_by }}{{ end }}")
+		qb.printf("\n{{ if .limit }}LIMIT {{ .limit }}{{ end }}")
+		qb.printf("\n{{ if .offset }}OFFSET {{ .offset }}{{ end }}")
+	}
+
+	return &cmds2.SqlCommandDescription{
+		Name:  name,
+		Short: short,
+		Flags: qb.flags,
+		Query: qb.query.String(),
+	}, nil
+}
+
+// addColumnFilters adds the filter flags of a column, depending on its type, and their conditions.
+// Columns whose names can't be used as flag names, or collide with another flag, are skipped.
+// It returns reserved with the names of the added flags.
+func (qb *queryBuilder) addColumnFilters(c *schema.Column, column string, reserved []string) []string {
+	if !flagNameRegexp.MatchString(c.Name) {
+		return reserved
+	}
+	names := []string{}
+	switch c.Kind() {
+	case schema.KindString:
+		names = []string{c.Name, c.Name + "_like"}
+		if containsColumn(reserved, c.Name) {
+			names[0] = c.Name + "_in"
+		}
+	case schema.KindInt, schema.KindFloat:
+		names = []string{c.Name + "_min", c.Name + "_max"}
+	case schema.KindDate:
+		names = []string{c.Name + "_from", c.Name + "_to"}
+	}
+	for _, n := range names {
+		if containsColumn(reserved, n) {
+			return reserved
+		}
+	}
+
+	switch c.Kind() {
+	case schema.KindString:
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: names[0],
+			Type: parameters.ParameterTypeStringList,
+			Help: columnHelp(c, "Only rows where %s is one of these values"),
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: names[1],
+			Type: parameters.ParameterTypeString,
+			Help: columnHelp(c, "Only rows where %s matches this LIKE pattern"),
+		})
+		qb.printf("\n{{ if .%s }}  AND %s IN ({{ range $i, $v := .%s }}{{ if $i }}, {{ end }}'{{ sqlEscape $v }}'{{ end }}){{ end }}",
+			names[0], column, names[0])
+		qb.printf("\n{{ if .%s }}  AND %s LIKE '{{ sqlEscape .%s }}'{{ end }}", names[1], column, names[1])
+
+	case schema.KindInt, schema.KindFloat:
+		type_ := parameters.ParameterTypeInteger
+		if c.Kind() == schema.KindFloat {
+			type_ = parameters.ParameterTypeFloat
+		}
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: names[0],
+			Type: type_,
+			Help: columnHelp(c, "Only rows where %s is at least this value"),
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: names[1],
+			Type: type_,
+			Help: columnHelp(c, "Only rows where %s is at most this value"),
+		})
+		// 0 is a valid bound, so we check whether the flag was given
+		qb.printf("\n{{ if hasKey . \"%s\" }}  AND %s >= {{ .%s }}{{ end }}", names[0], column, names[0])
+		qb.printf("\n{{ if hasKey . \"%s\" }}  AND %s <= {{ .%s }}{{ end }}", names[1], column, names[1])
+
+	case schema.KindDate:
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: names[0],
+			Type: parameters.ParameterTypeDate,
+			Help: columnHelp(c, "Only rows where %s is on or after this date"),
+		})
+		qb.addFlag(&parameters.ParameterDefinition{
+			Name: names[1],
+			Type: parameters.ParameterTypeDate,
+			Help: columnHelp(c, "Only rows where %s is before this date"),
+		})
+		qb.printf("\n{{ if .%s }}  AND %s >= {{ sqlDate .%s }}{{ end }}", names[0], column, names[0])
+		qb.printf("\n{{ if .%s }}  AND %s < {{ sqlDate .%s }}{{ end }}", names[1], column, names[1])
+	}
+
+	return append(reserved, names...)
+}
+
+// columnHelp formats the help of a flag on column c, followed by the comment of the column if it has one.
+func columnHelp(c *schema.Column, format string) string {
+	ret := fmt.Sprintf(format, c.Name)
+	if c.Comment != "" {
+		ret += fmt.Sprintf(" (%s)", c.Comment)
+	}
+	return ret
+}
+
+// writeCommandFile writes the command into dir, as <name>.yaml, and returns the path of the file.
+// Existing files are only replaced if overwrite is set.
+func writeCommandFile(dir string, description *cmds2.SqlCommandDescription, overwrite bool) (string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, description.Name+".yaml")
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return "", errors.Wrap(os.ErrExist, path)
+		}
+		return "", err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	enc := yaml.NewEncoder(f)
+	err = enc.Encode(description)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not write %s", path)
+	}
+	return path, f.Close()
+}
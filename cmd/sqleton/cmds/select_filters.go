@@ -0,0 +1,195 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// selectFilter is a condition on a column, given with one of the structured filter flags
+// of select (--eq, --in, --like, --gt, --lt, --between, --is-null).
+type selectFilter struct {
+	Flag   string
+	Column string
+	Values []string
+}
+
+// parseFilters parses the structured filter flags of the settings.
+//
+// The flags are string lists, which split their values on commas: `--in status=draft,publish`
+// is received as `status=draft` and `publish`. Values that don't start with a column name
+// followed by `=` are thus joined back to the previous filter.
+func (s *SelectCommandSettings) parseFilters() ([]*selectFilter, error) {
+	ret := []*selectFilter{}
+
+	for _, flag := range []struct {
+		name   string
+		values []string
+	}{
+		{"eq", s.Eq},
+		{"in", s.In},
+		{"like", s.Like},
+		{"gt", s.Gt},
+		{"lt", s.Lt},
+		{"between", s.Between},
+	} {
+		var current *selectFilter
+		for _, v := range flag.values {
+			column, value, ok := strings.Cut(v, "=")
+			if ok && isColumnName(column) {
+				current = &selectFilter{Flag: flag.name, Column: column, Values: []string{value}}
+				ret = append(ret, current)
+				continue
+			}
+			if current == nil {
+				return nil, errors.Errorf("invalid --%s filter %s, use column=value", flag.name, v)
+			}
+			current.Values = append(current.Values, v)
+		}
+	}
+
+	for _, f := range ret {
+		switch f.Flag {
+		case "eq", "like", "gt", "lt":
+			// a comma in a single value
+			f.Values = []string{strings.Join(f.Values, ",")}
+		case "between":
+			if len(f.Values) != 2 {
+				return nil, errors.Errorf("invalid --between filter on %s, use column=from,to", f.Column)
+			}
+		}
+	}
+
+	for _, column := range s.IsNull {
+		if !isColumnName(column) {
+			return nil, errors.Errorf("invalid --is-null column %s", column)
+		}
+		ret = append(ret, &selectFilter{Flag: "is-null", Column: column})
+	}
+
+	return ret, nil
+}
+
+// isColumnName returns true if s looks like a (possibly table-qualified) column name.
+func isColumnName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r == '.' || r == '$' ||
+			r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// expr returns the condition of the filter, with its values added as arguments to cond.
+func (f *selectFilter) expr(cond *sqlbuilder.Cond) string {
+	switch f.Flag {
+	case "eq":
+		return cond.Equal(f.Column, f.Values[0])
+	case "in":
+		values := make([]interface{}, len(f.Values))
+		for i, v := range f.Values {
+			values[i] = v
+		}
+		return cond.In(f.Column, values...)
+	case "like":
+		return cond.Like(f.Column, f.Values[0])
+	case "gt":
+		return cond.GreaterThan(f.Column, f.Values[0])
+	case "lt":
+		return cond.LessThan(f.Column, f.Values[0])
+	case "between":
+		return cond.Between(f.Column, f.Values[0], f.Values[1])
+	case "is-null":
+		return cond.IsNull(f.Column)
+	}
+	panic(fmt.Sprintf("unknown filter %s", f.Flag))
+}
+
+// validateFilters checks that the filters are on columns of the table or of the joined tables,
+// and replaces their column names with the names of the table columns, so that only actual
+// column names end up in the query. When tables are joined, the columns are qualified.
+func validateFilters(ctx context.Context, db *sqlx.DB, table string, joins []*selectJoin, filters []*selectFilter) error {
+	if len(filters) == 0 {
+		return nil
+	}
+
+	_, tableName := schema.SplitTableName(table)
+	tables := append([]*selectJoin{{Table: table, Alias: tableName}}, joins...)
+	columns := map[string][]*schema.Column{}
+	listColumns := func(table string) ([]*schema.Column, error) {
+		if c, ok := columns[table]; ok {
+			return c, nil
+		}
+		c, err := schema.ListColumns(ctx, db, table)
+		if err != nil {
+			return nil, err
+		}
+		columns[table] = c
+		return c, nil
+	}
+
+	for _, f := range filters {
+		qualifier, name := schema.SplitTableName(f.Column)
+
+		candidates := tables
+		if qualifier != "" {
+			candidates = nil
+			for _, t := range tables {
+				if strings.EqualFold(qualifier, t.name()) || strings.EqualFold(qualifier, t.Table) {
+					candidates = append(candidates, t)
+				}
+			}
+			if len(candidates) == 0 {
+				return errors.Errorf("--%s filter on %s: %s is not a selected table", f.Flag, f.Column, qualifier)
+			}
+		}
+
+		found := false
+		names := []string{}
+		for _, t := range candidates {
+			tableColumns, err := listColumns(t.Table)
+			if err != nil {
+				return err
+			}
+			for _, c := range tableColumns {
+				names = append(names, t.name()+"."+c.Name)
+				if !found && strings.EqualFold(c.Name, name) {
+					f.Column = c.Name
+					if len(joins) > 0 {
+						f.Column = t.name() + "." + c.Name
+					}
+					found = true
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("--%s filter on unknown column %s, the columns are: %s",
+				f.Flag, f.Column, strings.Join(names, ", "))
+		}
+	}
+
+	return nil
+}
+
+// interpolateFilters returns the filters as a literal SQL condition, quoted for flavor.
+func interpolateFilters(filters []*selectFilter, flavor sqlbuilder.Flavor) (string, error) {
+	cond := &sqlbuilder.Cond{Args: &sqlbuilder.Args{}}
+	exprs := make([]string, len(filters))
+	for i, f := range filters {
+		exprs[i] = f.expr(cond)
+	}
+	query, args := cond.Args.CompileWithFlavor(strings.Join(exprs, " AND "), flavor)
+	return flavor.Interpolate(query, args)
+}
@@ -0,0 +1,89 @@
+package cmds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings SelectCommandSettings
+		expected []*selectFilter
+		err      string
+	}{
+		{
+			name: "in values split on commas",
+			// --in status=draft,publish
+			settings: SelectCommandSettings{In: []string{"status=draft", "publish"}},
+			expected: []*selectFilter{{Flag: "in", Column: "status", Values: []string{"draft", "publish"}}},
+		},
+		{
+			name: "several in filters",
+			// --in a=x,y --in b=z
+			settings: SelectCommandSettings{In: []string{"a=x", "y", "b=z"}},
+			expected: []*selectFilter{
+				{Flag: "in", Column: "a", Values: []string{"x", "y"}},
+				{Flag: "in", Column: "b", Values: []string{"z"}},
+			},
+		},
+		{
+			name: "eq value containing =",
+			// --eq a=b=c
+			settings: SelectCommandSettings{Eq: []string{"a=b=c"}},
+			expected: []*selectFilter{{Flag: "eq", Column: "a", Values: []string{"b=c"}}},
+		},
+		{
+			name: "eq value containing a comma",
+			// --eq title=hello,world
+			settings: SelectCommandSettings{Eq: []string{"title=hello", "world"}},
+			expected: []*selectFilter{{Flag: "eq", Column: "title", Values: []string{"hello,world"}}},
+		},
+		{
+			name: "in value containing = that is not a column",
+			// --in "a=x,y z=w"
+			settings: SelectCommandSettings{In: []string{"a=x", "y z=w"}},
+			expected: []*selectFilter{{Flag: "in", Column: "a", Values: []string{"x", "y z=w"}}},
+		},
+		{
+			name: "between",
+			// --between created=2023-01-01,2023-02-01
+			settings: SelectCommandSettings{Between: []string{"created=2023-01-01", "2023-02-01"}},
+			expected: []*selectFilter{{Flag: "between", Column: "created", Values: []string{"2023-01-01", "2023-02-01"}}},
+		},
+		{
+			name:     "between with a single value",
+			settings: SelectCommandSettings{Between: []string{"created=2023-01-01"}},
+			err:      "invalid --between filter on created, use column=from,to",
+		},
+		{
+			name:     "between with three values",
+			settings: SelectCommandSettings{Between: []string{"n=1", "2", "3"}},
+			err:      "invalid --between filter on n, use column=from,to",
+		},
+		{
+			name:     "value without column",
+			settings: SelectCommandSettings{Gt: []string{"10"}},
+			err:      "invalid --gt filter 10, use column=value",
+		},
+		{
+			name:     "is null",
+			settings: SelectCommandSettings{IsNull: []string{"deleted_at"}},
+			expected: []*selectFilter{{Flag: "is-null", Column: "deleted_at"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := tt.settings.parseFilters()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filters)
+		})
+	}
+}
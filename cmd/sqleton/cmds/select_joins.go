@@ -0,0 +1,215 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// selectJoin is a table joined with --join or --left-join, given as `table [[AS] alias] [ON condition]`.
+// Without condition, the tables are joined on the foreign key between them.
+type selectJoin struct {
+	Left  bool
+	Table string
+	Alias string
+	On    string
+}
+
+func parseJoin(spec string, left bool) (*selectJoin, error) {
+	ret := &selectJoin{Left: left}
+
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || !isColumnName(fields[0]) {
+		return nil, errors.Errorf("invalid join %s, use table [alias] [ON condition]", spec)
+	}
+	ret.Table = fields[0]
+	fields = fields[1:]
+
+	if len(fields) > 0 && strings.EqualFold(fields[0], "as") {
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return nil, errors.Errorf("invalid join %s, missing alias after AS", spec)
+		}
+	}
+	if len(fields) > 0 && !strings.EqualFold(fields[0], "on") {
+		if !isColumnName(fields[0]) {
+			return nil, errors.Errorf("invalid join %s, use table [alias] [ON condition]", spec)
+		}
+		ret.Alias = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) > 0 {
+		if !strings.EqualFold(fields[0], "on") || len(fields) == 1 {
+			return nil, errors.Errorf("invalid join %s, use table [alias] [ON condition]", spec)
+		}
+		ret.On = strings.Join(fields[1:], " ")
+	}
+
+	return ret, nil
+}
+
+// name is the name the columns of the joined table are qualified with.
+func (j *selectJoin) name() string {
+	if j.Alias != "" {
+		return j.Alias
+	}
+	_, name := schema.SplitTableName(j.Table)
+	return name
+}
+
+// table is the table as written in the FROM clause.
+func (j *selectJoin) table() string {
+	if j.Alias != "" {
+		return j.Table + " " + j.Alias
+	}
+	return j.Table
+}
+
+func (j *selectJoin) String() string {
+	ret := "JOIN " + j.table() + " ON " + j.On
+	if j.Left {
+		ret = "LEFT " + ret
+	}
+	return ret
+}
+
+func (s *SelectCommandSettings) parseJoins() ([]*selectJoin, error) {
+	ret := []*selectJoin{}
+	for _, spec := range s.Join {
+		j, err := parseJoin(spec, false)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, j)
+	}
+	for _, spec := range s.LeftJoin {
+		j, err := parseJoin(spec, true)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, j)
+	}
+	return ret, nil
+}
+
+// resolveJoins sets the condition of the joins given without one, from the foreign key between
+// the joined table and the selected table, or one of the tables joined before it.
+func resolveJoins(ctx context.Context, db *sqlx.DB, table string, joins []*selectJoin) error {
+	_, tableName := schema.SplitTableName(table)
+	joined := []*selectJoin{{Table: table, Alias: tableName}}
+	foreignKeys := map[string][]*schema.ForeignKey{}
+	listForeignKeys := func(table string) ([]*schema.ForeignKey, error) {
+		if fks, ok := foreignKeys[table]; ok {
+			return fks, nil
+		}
+		fks, err := schema.ListForeignKeys(ctx, db, table)
+		if err != nil {
+			return nil, err
+		}
+		foreignKeys[table] = fks
+		return fks, nil
+	}
+
+	for _, j := range joins {
+		if j.On != "" {
+			joined = append(joined, j)
+			continue
+		}
+
+		conditions := []string{}
+		_, jName := schema.SplitTableName(j.Table)
+		for _, other := range joined {
+			_, otherName := schema.SplitTableName(other.Table)
+
+			fks, err := listForeignKeys(other.Table)
+			if err != nil {
+				return err
+			}
+			for _, fk := range fks {
+				if strings.EqualFold(fk.ReferencedTable, jName) {
+					conditions = append(conditions, foreignKeyCondition(other.name(), fk.Columns, j.name(), fk.ReferencedColumns))
+				}
+			}
+
+			fks, err = listForeignKeys(j.Table)
+			if err != nil {
+				return err
+			}
+			for _, fk := range fks {
+				if strings.EqualFold(fk.ReferencedTable, otherName) {
+					conditions = append(conditions, foreignKeyCondition(j.name(), fk.Columns, other.name(), fk.ReferencedColumns))
+				}
+			}
+		}
+
+		switch len(conditions) {
+		case 0:
+			return errors.Errorf("no foreign key between %s and the other tables, use --join '%s ON ...'", j.Table, j.Table)
+		case 1:
+			j.On = conditions[0]
+		default:
+			return errors.Errorf("several foreign keys could join %s (%s), use --join '%s ON ...'",
+				j.Table, strings.Join(conditions, "; "), j.Table)
+		}
+		joined = append(joined, j)
+	}
+
+	return nil
+}
+
+func foreignKeyCondition(table string, columns []string, referencedTable string, referencedColumns []string) string {
+	conditions := make([]string, len(columns))
+	for i := range columns {
+		conditions[i] = fmt.Sprintf("%s.%s = %s.%s", table, columns[i], referencedTable, referencedColumns[i])
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// selectAggregate is an aggregate given with --agg as `function:column`.
+type selectAggregate struct {
+	Function string
+	Column   string
+}
+
+var aggregateFunctions = []string{"count", "sum", "avg", "min", "max"}
+
+func (s *SelectCommandSettings) parseAggregates() ([]*selectAggregate, error) {
+	ret := []*selectAggregate{}
+	for _, spec := range s.Agg {
+		function, column, ok := strings.Cut(spec, ":")
+		function = strings.ToLower(function)
+		if !ok {
+			return nil, errors.Errorf("invalid aggregate %s, use function:column", spec)
+		}
+		known := false
+		for _, f := range aggregateFunctions {
+			known = known || f == function
+		}
+		if !known {
+			return nil, errors.Errorf("unknown aggregate function %s, use one of %s",
+				function, strings.Join(aggregateFunctions, ", "))
+		}
+		if !isColumnName(column) && !(column == "*" && function == "count") {
+			return nil, errors.Errorf("invalid aggregate column %s", column)
+		}
+		ret = append(ret, &selectAggregate{Function: function, Column: column})
+	}
+	return ret, nil
+}
+
+func (a *selectAggregate) expr() string {
+	return fmt.Sprintf("%s(%s)", strings.ToUpper(a.Function), a.Column)
+}
+
+// alias is the name of the aggregate column, for example sum_amount for sum:orders.amount.
+func (a *selectAggregate) alias() string {
+	if a.Column == "*" {
+		return a.Function
+	}
+	_, column := schema.SplitTableName(a.Column)
+	return a.Function + "_" + column
+}
@@ -0,0 +1,150 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// runPages selects the rows of the table page by page, --limit rows at a time, with keyset
+// predicates on the --order-by columns (or the primary key of the table) instead of OFFSET.
+func (sc *SelectCommand) runPages(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	s *SelectCommandSettings,
+	gp middlewares.Processor,
+	h *history.Recorder,
+) error {
+	if s.Count {
+		return errors.New("--count can't be used with pagination")
+	}
+	if s.grouped() {
+		return errors.New("--group-by and --agg can't be used with pagination")
+	}
+	if s.Offset > 0 {
+		return errors.New("--offset can't be used with pagination")
+	}
+	if s.Limit <= 0 {
+		return errors.New("pagination needs a --limit")
+	}
+	if createQuery, _ := ps["create-query"].(string); createQuery != "" {
+		return errors.New("--create-query can't be used with pagination")
+	}
+
+	db, err := sc.dbConnectionFactory(parsedLayers)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.resolve(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	keys, err := pagination.ParseOrderBy(s.OrderBy)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		keys, err = primaryKeys(ctx, db, s.Table)
+		if err != nil {
+			return errors.Wrap(err, "use --order-by to set the pagination keys")
+		}
+	}
+	p := &pagination.Pagination{Keys: keys, PageSize: s.Limit}
+
+	printQuery, _ := ps["print-query"].(bool)
+	fetchSize, _ := ps["fetch-size"].(int)
+
+	cursor := s.PageAfter
+	for {
+		sb := s.newSelectBuilder()
+		if cursor != "" {
+			where, err := p.WhereArgs(cursor, sb.Var)
+			if err != nil {
+				return err
+			}
+			sb = sb.Where(where)
+		}
+		sb = sb.OrderBy(p.OrderBy()).Limit(s.Limit)
+		query, queryArgs := sb.BuildWithFlavor(builderFlavor(db))
+
+		if printQuery {
+			fmt.Println(query)
+			fmt.Println(queryArgs)
+			return &cmds.ExitWithoutGlazeError{}
+		}
+
+		if cursor == s.PageAfter {
+			// only the query of the first page is recorded in the history
+			h.AddQuery(query, queryArgs...)
+		}
+
+		recorder := pagination.NewRecorder(p, gp)
+		err = stream.RunQueryIntoGlaze(ctx, db, query, queryArgs, recorder, stream.WithFetchSize(fetchSize))
+		if err != nil {
+			return err
+		}
+		if recorder.Count < s.Limit {
+			return nil
+		}
+
+		cursor, err = recorder.Cursor()
+		if err != nil {
+			return err
+		}
+		if !s.AllPages {
+			_, _ = fmt.Fprintf(os.Stderr, "next page: --page-after %s\n", cursor)
+			return nil
+		}
+	}
+}
+
+func primaryKeys(ctx context.Context, db *sqlx.DB, table string) ([]*pagination.Key, error) {
+	columns, err := schema.ListColumns(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*pagination.Key{}
+	for _, c := range columns {
+		if c.PrimaryKey {
+			keys = append(keys, &pagination.Key{Column: c.Name})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("table %s has no primary key", table)
+	}
+	return keys, nil
+}
+
+// builderFlavor returns the sqlbuilder flavor matching the placeholders of the driver.
+func builderFlavor(db *sqlx.DB) sqlbuilder.Flavor {
+	switch db.DriverName() {
+	case "postgres":
+		return sqlbuilder.PostgreSQL
+	case "sqlite3", "sqlite":
+		return sqlbuilder.SQLite
+	default:
+		return sqlbuilder.MySQL
+	}
+}
@@ -0,0 +1,104 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// commandsByPath indexes the glaze commands by their full path, as in "mysql ps".
+func commandsByPath(commands []cmds.Command) map[string]cmds.GlazeCommand {
+	ret := map[string]cmds.GlazeCommand{}
+	for _, command := range commands {
+		glazeCommand, ok := command.(cmds.GlazeCommand)
+		if !ok {
+			continue
+		}
+		description := command.Description()
+		path := strings.Join(append(append([]string{}, description.Parents...), description.Name), " ")
+		ret[path] = glazeCommand
+	}
+	return ret
+}
+
+// findCommand looks up the longest command path that prefixes args, returning
+// the command and the remaining arguments.
+func findCommand(commands map[string]cmds.GlazeCommand, args []string) (cmds.GlazeCommand, []string, error) {
+	for i := len(args); i > 0; i-- {
+		if c, ok := commands[strings.Join(args[:i], " ")]; ok {
+			return c, args[i:], nil
+		}
+	}
+	return nil, nil, errors.Errorf("unknown command %s", strings.Join(args, " "))
+}
+
+// parseCommandArgs parses the flags and arguments of command out of args.
+//
+// The sql-connection and dbt layers are replaced by the ones in connectionLayers,
+// so that the command runs against the same connection as the command running it.
+// The returned cobra command can be used to check which flags were passed explicitly.
+func parseCommandArgs(
+	command cmds.GlazeCommand,
+	args []string,
+	connectionLayers map[string]*layers.ParsedParameterLayer,
+) (*cobra.Command, map[string]*layers.ParsedParameterLayer, map[string]interface{}, error) {
+	parser, err := cli.NewCobraParserFromCommandDescription(command.Description())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = parser.Cmd.ParseFlags(args)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	parsedLayers, ps, err := parser.Parse(parser.Cmd.Flags().Args())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, slug := range []string{"sql-connection", "dbt"} {
+		if l, ok := connectionLayers[slug]; ok {
+			parsedLayers[slug] = l
+			for k, v := range l.Parameters {
+				ps[k] = v
+			}
+		}
+	}
+
+	return parser.Cmd, parsedLayers, ps, nil
+}
+
+// openConnection opens connection, a connection name or database URL, or the
+// connection of the sql-connection and dbt layers if empty.
+func openConnection(
+	ctx context.Context,
+	dbConnectionFactory cmds2.DBConnectionFactory,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	connection string,
+) (*sqlx.DB, error) {
+	if connection == "" {
+		return dbConnectionFactory(parsedLayers)
+	}
+
+	layers_ := make([]*layers.ParsedParameterLayer, 0, len(parsedLayers))
+	for _, l := range parsedLayers {
+		layers_ = append(layers_, l)
+	}
+	config, err := sql2.NewConfigFromParsedLayers(layers_...)
+	if err != nil {
+		return nil, err
+	}
+	source, err := connections.ResolveOne(connection, connections.ConfigPath(), config.DbtProfilesPath)
+	if err != nil {
+		return nil, err
+	}
+	return connections.Open(ctx, source)
+}
@@ -13,12 +13,14 @@ import (
 	"github.com/go-go-golems/glazed/pkg/helpers/cast"
 	"github.com/go-go-golems/sqleton/cmd/sqleton/cmds"
 	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/history"
 	"github.com/pkg/profile"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
@@ -38,6 +40,11 @@ var rootCmd = &cobra.Command{
 		err := clay.InitLogger()
 		cobra.CheckErr(err)
 
+		if viper.GetBool("history") {
+			command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+			history.Enable(history.DefaultPath(), command, os.Args[1:])
+		}
+
 		memProfile, _ := cmd.Flags().GetBool("mem-profile")
 		if memProfile {
 			log.Info().Msg("Starting memory profiler")
@@ -115,6 +122,9 @@ func main() {
 
 	err := rootCmd.Execute()
 	cobra.CheckErr(err)
+
+	// stale cached results are output right away and refreshed in the background
+	cmds2.WaitForRevalidations()
 }
 
 var runCommandCmd = &cobra.Command{
@@ -203,7 +213,56 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	}
 	rootCmd.AddCommand(cobraQueryCommand)
 
+	loadCommand, err := cmds.NewLoadCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraLoadCommand, err := cli.BuildCobraCommandFromGlazeCommand(loadCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraLoadCommand)
+
+	dumpCommand, err := cmds.NewDumpCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraDumpCommand, err := cli.BuildCobraCommandFromGlazeCommand(dumpCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraDumpCommand)
+
+	profileCommand, err := cmds.NewProfileCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraProfileCommand, err := cli.BuildCobraCommandFromGlazeCommand(profileCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraProfileCommand)
+
 	rootCmd.AddCommand(cmds.MysqlCmd)
+	rootCmd.AddCommand(cmds.PgCmd)
+	rootCmd.AddCommand(cmds.GenerateCmd)
+	rootCmd.AddCommand(cmds.HistoryCmd)
+	rootCmd.AddCommand(cmds.CacheCmd)
 
 	repositories := viper.GetStringSlice("repositories")
 
@@ -260,6 +319,87 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	}
 	rootCmd.AddCommand(cobraServeCommand)
 
+	replCommand, err := cmds.NewReplCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		commands,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraReplCommand, err := cli.BuildCobraCommandFromBareCommand(replCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraReplCommand)
+
+	// select and query can be copied from too
+	copyCommand, err := cmds.NewCopyCommand(
+		append([]glazed_cmds.Command{selectCommand, queryCommand}, commands...),
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraCopyCommand, err := cli.BuildCobraCommandFromGlazeCommand(copyCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraCopyCommand)
+
+	diffResultsCommand, err := cmds.NewDiffResultsCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		commands,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraDiffResultsCommand, err := cli.BuildCobraCommandFromGlazeCommand(diffResultsCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraDiffResultsCommand)
+
+	scheduleCommand, err := cmds.NewScheduleCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		commands,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraScheduleCommand, err := cli.BuildCobraCommandFromGlazeCommand(scheduleCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraScheduleCommand)
+
+	checkCommand, err := cmds.NewCheckCommand(
+		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		commands,
+		glazed_cmds.WithLayers(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraCheckCommand, err := cli.BuildCobraCommandFromGlazeCommand(checkCommand)
+	if err != nil {
+		return err
+	}
+	cobraCheckCommand.SetFlagErrorFunc(cmds.CheckFlagError)
+	rootCmd.AddCommand(cobraCheckCommand)
+
 	queriesCommand, err := cmds.NewQueriesCommand(sqlCommands, aliases)
 	if err != nil {
 		return err
@@ -0,0 +1,436 @@
+package assertions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Assertion checks the rows returned by a query. It is one of
+//
+//	row_count == 0
+//	max(lag_seconds) < 30
+//	every row: status != 'error'
+//	any row: role == 'admin'
+//	no row: email is null
+//
+// The aggregates are count, sum, avg, min and max, count(*) being row_count.
+// The operators are ==, !=, <, <=, >, >=, is null and is not null, and the values
+// numbers, 'strings', true, false and null.
+type Assertion struct {
+	Expression string
+	quantifier string
+	aggregate  string
+	column     string
+	op         string
+	value      interface{}
+}
+
+const (
+	quantifierEvery = "every row"
+	quantifierAny   = "any row"
+	quantifierNo    = "no row"
+)
+
+var aggregates = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+var (
+	quantifierRegexp = regexp.MustCompile(`^\s*(every|any|no)\s+rows?\s*:\s*(.*)$`)
+	conditionRegexp  = regexp.MustCompile(
+		`^\s*([A-Za-z_][\w.]*|(\w+)\(\s*(\*|[A-Za-z_][\w.]*)\s*\))\s*(==|!=|<>|<=|>=|<|>|=|is\s+not\b|is\b)\s*(.*?)\s*$`,
+	)
+)
+
+// Parse parses expression into an Assertion.
+func Parse(expression string) (*Assertion, error) {
+	a := &Assertion{Expression: strings.TrimSpace(expression)}
+	condition := expression
+	if m := quantifierRegexp.FindStringSubmatch(expression); m != nil {
+		a.quantifier = m[1] + " row"
+		condition = m[2]
+	}
+
+	m := conditionRegexp.FindStringSubmatch(condition)
+	if m == nil {
+		return nil, errors.Errorf("invalid assertion %q", expression)
+	}
+	if m[2] != "" {
+		a.aggregate = strings.ToLower(m[2])
+		a.column = m[3]
+		if !aggregates[a.aggregate] {
+			return nil, errors.Errorf("invalid assertion %q: unknown aggregate %s", expression, m[2])
+		}
+		if a.column == "*" {
+			if a.aggregate != "count" {
+				return nil, errors.Errorf("invalid assertion %q: %s(*)", expression, a.aggregate)
+			}
+			a.aggregate, a.column = "", "row_count"
+		}
+	} else {
+		a.column = m[1]
+	}
+
+	a.op = strings.Join(strings.Fields(m[4]), " ")
+	switch a.op {
+	case "=":
+		a.op = "=="
+	case "<>":
+		a.op = "!="
+	}
+
+	var err error
+	a.value, err = parseValue(m[5])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid assertion %q", expression)
+	}
+	if a.op == "is" || a.op == "is not" {
+		if a.value != nil {
+			return nil, errors.Errorf("invalid assertion %q: %s must be followed by null", expression, a.op)
+		}
+		a.op = map[string]string{"is": "==", "is not": "!="}[a.op]
+	}
+
+	if a.quantifier != "" {
+		if a.aggregate != "" || a.column == "row_count" {
+			return nil, errors.Errorf("invalid assertion %q: %s applies to columns, not aggregates", expression, a.quantifier)
+		}
+	} else if a.aggregate == "" && a.column != "row_count" {
+		return nil, errors.Errorf(
+			"invalid assertion %q: use row_count, an aggregate such as max(%s), or every row:, any row: or no row:",
+			expression, a.column)
+	}
+
+	return a, nil
+}
+
+// Expressions is the assert section of a command.
+//
+// YAML reads an unquoted `every row: status != 'error'` as a map, which is read back
+// into the expression, so that the quantified assertions don't need quotes.
+type Expressions []string
+
+func (e *Expressions) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.SequenceNode {
+		return errors.Errorf("line %d: assert must be a list of assertions", value.Line)
+	}
+	ret := Expressions{}
+	for _, n := range value.Content {
+		switch {
+		case n.Kind == yaml.ScalarNode:
+			ret = append(ret, n.Value)
+		case n.Kind == yaml.MappingNode && len(n.Content) == 2 &&
+			n.Content[0].Kind == yaml.ScalarNode && n.Content[1].Kind == yaml.ScalarNode:
+			ret = append(ret, n.Content[0].Value+": "+n.Content[1].Value)
+		default:
+			return errors.Errorf("line %d: invalid assertion", n.Line)
+		}
+	}
+	*e = ret
+	return nil
+}
+
+// ParseAll parses expressions, returning the first error.
+func ParseAll(expressions []string) ([]*Assertion, error) {
+	ret := make([]*Assertion, 0, len(expressions))
+	for _, e := range expressions {
+		a, err := Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+func parseValue(s string) (interface{}, error) {
+	switch strings.ToLower(s) {
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return strings.ReplaceAll(s[1:len(s)-1], string(s[0])+string(s[0]), string(s[0])), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid value %s, use a number, a quoted string, true, false or null", s)
+	}
+	return f, nil
+}
+
+type Status string
+
+const (
+	StatusPass  Status = "pass"
+	StatusFail  Status = "fail"
+	StatusError Status = "error"
+)
+
+// Result is the outcome of checking an assertion.
+type Result struct {
+	Assertion string
+	Status    Status
+	// Actual is the value of the aggregate, or the number of rows that make a row assertion fail.
+	Actual  interface{}
+	Message string
+}
+
+// Check checks the assertion against rows.
+func (a *Assertion) Check(rows []types.Row) *Result {
+	r := &Result{Assertion: a.Expression}
+
+	if a.column != "row_count" && len(rows) > 0 {
+		if _, ok := rows[0].Get(a.column); !ok {
+			r.Status = StatusError
+			r.Message = fmt.Sprintf("unknown column %s", a.column)
+			return r
+		}
+	}
+
+	if a.quantifier != "" {
+		return a.checkRows(r, rows)
+	}
+
+	var actual interface{}
+	if a.column == "row_count" {
+		actual = len(rows)
+	} else {
+		var err error
+		actual, err = aggregate(a.aggregate, a.column, rows)
+		if err != nil {
+			r.Status = StatusError
+			r.Message = err.Error()
+			return r
+		}
+	}
+	r.Actual = actual
+	switch {
+	case compare(actual, a.op, a.value):
+		r.Status = StatusPass
+	case actual == nil:
+		// deliberately a failure: an aggregate over no rows, for example of an empty or stale table,
+		// checks nothing. every row: accepts no rows, for checks that should pass on empty results.
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("%s is null, %s has no values", a.lhs(), a.column)
+	default:
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("%s is %s", a.lhs(), formatValue(actual))
+	}
+	return r
+}
+
+func (a *Assertion) checkRows(r *Result, rows []types.Row) *Result {
+	matching := 0
+	var firstMatching, firstNotMatching types.Row
+	for _, row := range rows {
+		v, _ := row.Get(a.column)
+		if compare(v, a.op, a.value) {
+			matching++
+			if firstMatching == nil {
+				firstMatching = row
+			}
+		} else if firstNotMatching == nil {
+			firstNotMatching = row
+		}
+	}
+
+	switch a.quantifier {
+	case quantifierEvery:
+		r.Actual = len(rows) - matching
+		if firstNotMatching != nil {
+			r.Status = StatusFail
+			r.Message = fmt.Sprintf("%d of %d rows don't match, first: %s", len(rows)-matching, len(rows), formatRow(firstNotMatching))
+			return r
+		}
+	case quantifierAny:
+		r.Actual = matching
+		if matching == 0 {
+			r.Status = StatusFail
+			r.Message = fmt.Sprintf("none of %d rows match", len(rows))
+			return r
+		}
+	case quantifierNo:
+		r.Actual = matching
+		if matching > 0 {
+			r.Status = StatusFail
+			r.Message = fmt.Sprintf("%d of %d rows match, first: %s", matching, len(rows), formatRow(firstMatching))
+			return r
+		}
+	}
+	r.Status = StatusPass
+	return r
+}
+
+func (a *Assertion) lhs() string {
+	if a.aggregate == "" {
+		return a.column
+	}
+	return fmt.Sprintf("%s(%s)", a.aggregate, a.column)
+}
+
+// aggregate computes the aggregate of the column over rows, ignoring null values as SQL does.
+// sum and avg need numbers, min and max compare strings if the values aren't numbers.
+func aggregate(name string, column string, rows []types.Row) (interface{}, error) {
+	values := []interface{}{}
+	for _, row := range rows {
+		v, _ := row.Get(column)
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+	if name == "count" {
+		return len(values), nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	switch name {
+	case "sum", "avg":
+		sum := 0.0
+		for _, v := range values {
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, errors.Errorf("%s(%s): %v is not a number", name, column, v)
+			}
+			sum += f
+		}
+		if name == "avg" {
+			return sum / float64(len(values)), nil
+		}
+		return sum, nil
+	default:
+		ret := values[0]
+		for _, v := range values[1:] {
+			if (name == "max" && compare(v, ">", ret)) || (name == "min" && compare(v, "<", ret)) {
+				ret = v
+			}
+		}
+		return ret, nil
+	}
+}
+
+// compare compares a value of the rows to an expected value. null only equals null,
+// values are compared as numbers if the expected value is a number or both are numbers,
+// as strings otherwise.
+func compare(actual interface{}, op string, expected interface{}) bool {
+	if actual == nil || expected == nil {
+		switch op {
+		case "==":
+			return actual == nil && expected == nil
+		case "!=":
+			return (actual == nil) != (expected == nil)
+		default:
+			return false
+		}
+	}
+
+	_, expectedIsString := expected.(string)
+	_, actualIsString := actual.(string)
+	if !expectedIsString || !actualIsString {
+		a, okA := toFloat(actual)
+		e, okE := toFloat(expected)
+		if okA && okE {
+			return compareOrdered(a, op, e)
+		}
+	}
+	return compareOrdered(toString(actual), op, toString(expected))
+}
+
+func compareOrdered[T float64 | string](a T, op string, b T) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	default:
+		return false
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v_ := v.(type) {
+	case int:
+		return float64(v_), true
+	case int8:
+		return float64(v_), true
+	case int16:
+		return float64(v_), true
+	case int32:
+		return float64(v_), true
+	case int64:
+		return float64(v_), true
+	case uint:
+		return float64(v_), true
+	case uint8:
+		return float64(v_), true
+	case uint16:
+		return float64(v_), true
+	case uint32:
+		return float64(v_), true
+	case uint64:
+		return float64(v_), true
+	case float32:
+		return float64(v_), true
+	case float64:
+		return v_, true
+	case bool:
+		if v_ {
+			return 1, true
+		}
+		return 0, true
+	case []byte:
+		f, err := strconv.ParseFloat(string(v_), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v_, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toString(v interface{}) string {
+	switch v_ := v.(type) {
+	case string:
+		return v_
+	case []byte:
+		return string(v_)
+	case time.Time:
+		return v_.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	return toString(v)
+}
+
+func formatRow(row types.Row) string {
+	values := []string{}
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		values = append(values, fmt.Sprintf("%s=%s", pair.Key, formatValue(pair.Value)))
+	}
+	return strings.Join(values, " ")
+}
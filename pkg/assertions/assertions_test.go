@@ -0,0 +1,121 @@
+package assertions
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func testRows() []types.Row {
+	return []types.Row{
+		types.NewRow(types.MRP("id", int64(1)), types.MRP("status", "ok"), types.MRP("lag_seconds", 12.5), types.MRP("email", "a@x")),
+		types.NewRow(types.MRP("id", int64(2)), types.MRP("status", "error"), types.MRP("lag_seconds", int64(40)), types.MRP("email", nil)),
+		types.NewRow(types.MRP("id", int64(3)), types.MRP("status", "ok"), types.MRP("lag_seconds", nil), types.MRP("email", "c@x")),
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, expression := range []string{
+		"row_count == 0",
+		"count(*) > 2",
+		"max(lag_seconds) < 30",
+		"every row: status != 'error'",
+		"no row: email is null",
+		"any rows: email is not null",
+		"sum(amount) >= 1e3",
+	} {
+		_, err := Parse(expression)
+		assert.NoError(t, err, expression)
+	}
+
+	for _, expression := range []string{
+		"",
+		"status != 'error'",
+		"median(lag) < 3",
+		"sum(*) > 0",
+		"every row: max(lag) < 3",
+		"row_count == zero",
+		"email is 3",
+		"row_count ~ 3",
+	} {
+		_, err := Parse(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rows := testRows()
+	for expression, expected := range map[string]Status{
+		"row_count == 3":                     StatusPass,
+		"row_count == 0":                     StatusFail,
+		"count(*) = 3":                       StatusPass,
+		"count(email) == 2":                  StatusPass,
+		"max(lag_seconds) < 30":              StatusFail,
+		"max(lag_seconds) <= 40":             StatusPass,
+		"min(lag_seconds) == 12.5":           StatusPass,
+		"sum(lag_seconds) == 52.5":           StatusPass,
+		"avg(lag_seconds) > 26":              StatusPass,
+		"min(status) == 'error'":             StatusPass,
+		"sum(status) > 0":                    StatusError,
+		"max(nope) > 0":                      StatusError,
+		"every row: status != 'error'":       StatusFail,
+		"every row: id > 0":                  StatusPass,
+		"every row: lag_seconds < 60":        StatusFail,
+		"any row: status == 'error'":         StatusPass,
+		"any row: status == 'warning'":       StatusFail,
+		"no row: email is null":              StatusFail,
+		"no row: status = \"warning\"":       StatusPass,
+		"every row: status is not null":      StatusPass,
+		"every row: id != '4'":               StatusPass,
+		"every row: email != 'nobody@x.com'": StatusPass,
+	} {
+		a, err := Parse(expression)
+		require.NoError(t, err, expression)
+		r := a.Check(rows)
+		assert.Equal(t, expected, r.Status, "%s: %s", expression, r.Message)
+	}
+
+	a, err := Parse("every row: status != 'error'")
+	require.NoError(t, err)
+	r := a.Check(rows)
+	assert.Equal(t, 1, r.Actual)
+	assert.Equal(t, "1 of 3 rows don't match, first: id=2 status=error lag_seconds=40 email=null", r.Message)
+
+	a, err = Parse("max(lag_seconds) < 30")
+	require.NoError(t, err)
+	r = a.Check(rows)
+	assert.Equal(t, int64(40), r.Actual)
+	assert.Equal(t, "max(lag_seconds) is 40", r.Message)
+
+	// aggregates of no rows are null, and fail comparisons other than is null
+	r = a.Check(nil)
+	assert.Equal(t, StatusFail, r.Status)
+	assert.Equal(t, "max(lag_seconds) is null, lag_seconds has no values", r.Message)
+	a, err = Parse("max(lag_seconds) is null")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPass, a.Check(nil).Status)
+	// while every row: passes on no rows
+	a, err = Parse("every row: lag_seconds < 30")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPass, a.Check(nil).Status)
+}
+
+func TestExpressionsUnmarshalYAML(t *testing.T) {
+	s := struct {
+		Assert Expressions `yaml:"assert"`
+	}{}
+	err := yaml.Unmarshal([]byte(`
+assert:
+  - row_count == 0
+  - every row: status != 'error'
+  - "no row: email is null"
+`), &s)
+	require.NoError(t, err)
+	assert.Equal(t, Expressions{"row_count == 0", "every row: status != 'error'", "no row: email is null"}, s.Assert)
+
+	err = yaml.Unmarshal([]byte(`assert: row_count == 0`), &s)
+	assert.Error(t, err)
+}
@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DefaultTTL is used for commands without a cache section run with --cache.
+const DefaultTTL = 5 * time.Minute
+
+// DefaultPath returns the path of the cache database.
+func DefaultPath() string {
+	return os.ExpandEnv("$HOME/.sqleton/cache.db")
+}
+
+// Cache is the cache section of a command, which caches its results for TTL.
+//
+//	cache:
+//	  ttl: 10m
+//	  stale-while-revalidate: 1h
+//	  key-flags: [ tenant ]
+type Cache struct {
+	TTL string `yaml:"ttl"`
+	// StaleWhileRevalidate is how long expired results are still returned, while the query
+	// is rerun in the background to refresh them.
+	StaleWhileRevalidate string `yaml:"stale-while-revalidate,omitempty"`
+	// KeyFlags are flags that change the results without changing the query,
+	// whose values are added to the key of the cached results.
+	KeyFlags []string `yaml:"key-flags,omitempty"`
+}
+
+// Durations parses the TTL and StaleWhileRevalidate of the section.
+func (c *Cache) Durations() (time.Duration, time.Duration, error) {
+	ttl := DefaultTTL
+	var stale time.Duration
+	var err error
+	if c.TTL != "" {
+		ttl, err = time.ParseDuration(c.TTL)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "invalid cache ttl")
+		}
+	}
+	if c.StaleWhileRevalidate != "" {
+		stale, err = time.ParseDuration(c.StaleWhileRevalidate)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "invalid cache stale-while-revalidate")
+		}
+	}
+	return ttl, stale, nil
+}
+
+// Key returns the key of the results of query, run with args against connection.
+// flags are the values of the key flags of the command.
+func Key(connection string, query string, args []interface{}, flags map[string]interface{}) (string, error) {
+	// json sorts the keys of maps, so the key doesn't depend on the order of the flags
+	b, err := json.Marshal([]interface{}{connection, query, args, flags})
+	if err != nil {
+		return "", errors.Wrap(err, "could not compute cache key")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type Status string
+
+const (
+	StatusFresh   Status = "fresh"
+	StatusStale   Status = "stale"
+	StatusExpired Status = "expired"
+)
+
+// Entry is the cached results of a query.
+type Entry struct {
+	Key        string    `db:"key"`
+	Command    string    `db:"command"`
+	Connection string    `db:"connection"`
+	Query      string    `db:"query"`
+	CreatedAt  time.Time `db:"created_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	// StaleUntil is when the results can't be returned anymore, ExpiresAt
+	// plus the stale-while-revalidate duration.
+	StaleUntil time.Time `db:"stale_until"`
+	RowCount   int64     `db:"row_count"`
+	Size       int64     `db:"size"`
+	Rows       []types.Row
+}
+
+// Status returns whether the entry is fresh, stale (but still usable) or expired at now.
+func (e *Entry) Status(now time.Time) Status {
+	switch {
+	case now.Before(e.ExpiresAt):
+		return StatusFresh
+	case now.Before(e.StaleUntil):
+		return StatusStale
+	default:
+		return StatusExpired
+	}
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS entries (
+	key TEXT PRIMARY KEY,
+	command TEXT NOT NULL,
+	connection TEXT NOT NULL,
+	query TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	stale_until TIMESTAMP NOT NULL,
+	row_count INTEGER NOT NULL,
+	data BLOB NOT NULL
+);
+`
+
+// Store is a cache database, a sqlite file.
+type Store struct {
+	db *sqlx.DB
+}
+
+// Open opens the cache database at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	// the cache is written concurrently when serving, the busy timeout makes writers wait for each other
+	db, err := sqlx.Connect("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open cache database %s", path)
+	}
+	_, err = db.Exec(schema)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "could not create cache database %s", path)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the entry for key with its rows, or nil if there is none.
+// Expired entries are returned too, use Entry.Status to check them.
+func (s *Store) Get(ctx context.Context, key string) (*Entry, error) {
+	e, data, err := s.get(ctx, key, "data")
+	if err != nil || e == nil {
+		return nil, err
+	}
+	e.Rows, err = decodeRows(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decode cached rows of %s", key)
+	}
+	return e, nil
+}
+
+// Peek returns the entry for key without its rows, or nil if there is none.
+func (s *Store) Peek(ctx context.Context, key string) (*Entry, error) {
+	e, _, err := s.get(ctx, key, "x''")
+	return e, err
+}
+
+func (s *Store) get(ctx context.Context, key string, dataColumn string) (*Entry, []byte, error) {
+	row := struct {
+		Entry
+		Data []byte `db:"data"`
+	}{}
+	err := s.db.GetContext(ctx, &row, `
+SELECT key, command, connection, query, created_at, expires_at, stale_until, row_count,
+       length(data) AS size, `+dataColumn+` AS data
+FROM entries WHERE key = ?`, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not read cache")
+	}
+	return &row.Entry, row.Data, nil
+}
+
+// Put stores e, replacing the entry with the same key.
+func (s *Store) Put(ctx context.Context, e *Entry) error {
+	data, err := encodeRows(e.Rows)
+	if err != nil {
+		return errors.Wrap(err, "could not encode rows")
+	}
+	e.RowCount = int64(len(e.Rows))
+	e.Size = int64(len(data))
+	_, err = s.db.ExecContext(ctx, `
+INSERT OR REPLACE INTO entries (key, command, connection, query, created_at, expires_at, stale_until, row_count, data)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Key, e.Command, e.Connection, e.Query, e.CreatedAt.UTC(), e.ExpiresAt.UTC(), e.StaleUntil.UTC(), e.RowCount, data,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not write cache")
+	}
+	return nil
+}
+
+// List returns the entries, without their rows, sorted by command and creation time.
+func (s *Store) List(ctx context.Context) ([]*Entry, error) {
+	ret := []*Entry{}
+	err := s.db.SelectContext(ctx, &ret, `
+SELECT key, command, connection, query, created_at, expires_at, stale_until, row_count, length(data) AS size
+FROM entries ORDER BY command, created_at`)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list cache")
+	}
+	return ret, nil
+}
+
+type ClearOptions struct {
+	// Command only clears the entries of the commands containing it.
+	Command string
+	// ExpiredOnly only clears the entries that can't be used anymore.
+	ExpiredOnly bool
+}
+
+// Clear deletes the entries matching options and returns how many were deleted.
+func (s *Store) Clear(ctx context.Context, options ClearOptions) (int64, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if options.Command != "" {
+		where = append(where, "instr(command, ?) > 0")
+		args = append(args, options.Command)
+	}
+	if options.ExpiredOnly {
+		where = append(where, "stale_until <= ?")
+		args = append(args, time.Now().UTC())
+	}
+	res, err := s.db.ExecContext(ctx, "DELETE FROM entries WHERE "+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not clear cache")
+	}
+	return res.RowsAffected()
+}
+
+type encodedRows struct {
+	Columns [][]string
+	Values  [][]interface{}
+}
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+func encodeRows(rows []types.Row) ([]byte, error) {
+	r := encodedRows{}
+	for _, row := range rows {
+		columns := []string{}
+		values := []interface{}{}
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			columns = append(columns, pair.Key)
+			values = append(values, pair.Value)
+		}
+		r.Columns = append(r.Columns, columns)
+		r.Values = append(r.Values, values)
+	}
+
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRows(data []byte) ([]types.Row, error) {
+	r := encodedRows{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&r)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]types.Row, len(r.Columns))
+	for i, columns := range r.Columns {
+		row := types.NewRow()
+		for j, column := range columns {
+			row.Set(column, r.Values[i][j])
+		}
+		ret[i] = row
+	}
+	return ret, nil
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+	err = store.Put(ctx, &Entry{
+		Key:        "a",
+		Command:    "wp posts",
+		Connection: "sqlite:/tmp/x.db",
+		Query:      "SELECT 1",
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Minute),
+		StaleUntil: now.Add(time.Hour),
+		Rows: []types.Row{
+			types.NewRow(types.MRP("id", int64(1)), types.MRP("name", "x"), types.MRP("created", created)),
+			types.NewRow(types.MRP("id", int64(2)), types.MRP("name", nil), types.MRP("amount", 1.5)),
+		},
+	})
+	require.NoError(t, err)
+	err = store.Put(ctx, &Entry{
+		Key:        "b",
+		Command:    "query",
+		CreatedAt:  now.Add(-2 * time.Hour),
+		ExpiresAt:  now.Add(-time.Hour),
+		StaleUntil: now.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+
+	e, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, StatusFresh, e.Status(now))
+	assert.Equal(t, StatusStale, e.Status(now.Add(2*time.Minute)))
+	assert.Equal(t, StatusExpired, e.Status(now.Add(2*time.Hour)))
+	assert.Equal(t, int64(2), e.RowCount)
+	require.Len(t, e.Rows, 2)
+	v, _ := e.Rows[0].Get("created")
+	assert.True(t, created.Equal(v.(time.Time)))
+	v, ok := e.Rows[1].Get("name")
+	assert.True(t, ok)
+	assert.Nil(t, v)
+	v, _ = e.Rows[1].Get("amount")
+	assert.Equal(t, 1.5, v)
+
+	e, err = store.Peek(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, e.Rows)
+	assert.Equal(t, "wp posts", e.Command)
+
+	e, err = store.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+
+	entries, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "query", entries[0].Command)
+
+	n, err := store.Clear(ctx, ClearOptions{ExpiredOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = store.Clear(ctx, ClearOptions{Command: "posts"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestKey(t *testing.T) {
+	k1, err := Key("db", "SELECT 1", nil, map[string]interface{}{"a": 1, "b": "x"})
+	require.NoError(t, err)
+	k2, err := Key("db", "SELECT 1", nil, map[string]interface{}{"b": "x", "a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, k1, k2)
+	k3, err := Key("other", "SELECT 1", nil, map[string]interface{}{"b": "x", "a": 1})
+	require.NoError(t, err)
+	assert.NotEqual(t, k1, k3)
+}
+
+func TestDurations(t *testing.T) {
+	ttl, stale, err := (&Cache{}).Durations()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTTL, ttl)
+	assert.Equal(t, time.Duration(0), stale)
+
+	ttl, stale, err = (&Cache{TTL: "10m", StaleWhileRevalidate: "1h"}).Durations()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, ttl)
+	assert.Equal(t, time.Hour, stale)
+
+	_, _, err = (&Cache{TTL: "soon"}).Durations()
+	assert.Error(t, err)
+}
@@ -0,0 +1,250 @@
+package cmds
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/cache"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// cacheOptions are the cache settings of a run, from the cache section of the command and the cache flags.
+type cacheOptions struct {
+	ttl      time.Duration
+	stale    time.Duration
+	keyFlags []string
+}
+
+// cacheOptions returns nil if the results of the command are not cached.
+func (s *SqlCommand) cacheOptions(cs *flags.CacheSettings) (*cacheOptions, error) {
+	if cs.NoCache || (s.Cache == nil && !cs.Cache) {
+		return nil, nil
+	}
+
+	ret := &cacheOptions{ttl: cache.DefaultTTL}
+	if s.Cache != nil {
+		var err error
+		ret.ttl, ret.stale, err = s.Cache.Durations()
+		if err != nil {
+			return nil, err
+		}
+		ret.keyFlags = s.Cache.KeyFlags
+	}
+	if cs.TTL > 0 {
+		ret.ttl = cs.TTL
+	}
+	return ret, nil
+}
+
+func (s *SqlCommand) cacheKey(connection string, query string, ps map[string]interface{}, o *cacheOptions) (string, error) {
+	keyFlags := map[string]interface{}{}
+	for _, f := range o.keyFlags {
+		keyFlags[f] = ps[f]
+	}
+	return cache.Key(connection, query, []interface{}{}, keyFlags)
+}
+
+// revalidating holds the keys of the stale entries being refreshed, so that each is refreshed only once.
+var revalidating sync.Map
+var revalidations sync.WaitGroup
+
+// WaitForRevalidations waits for the stale cached results being refreshed in the background,
+// so that a command line run doesn't exit before they are.
+func WaitForRevalidations() {
+	revalidations.Wait()
+}
+
+// runCached outputs the cached results of the rendered query if they are fresh, or stale
+// and refreshed in the background. Otherwise, it runs the query and caches its results.
+func (s *SqlCommand) runCached(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	db *sqlx.DB,
+	query string,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+	o *cacheOptions,
+) error {
+	connection := connections.NameFromParsedLayers(parsedLayers)
+	key, err := s.cacheKey(connection, query, ps, o)
+	if err != nil {
+		return err
+	}
+
+	store, err := cache.Open(cache.DefaultPath())
+	if err != nil {
+		return err
+	}
+	defer func(store *cache.Store) {
+		_ = store.Close()
+	}(store)
+
+	e, err := store.Get(ctx, key)
+	if err != nil {
+		// the query is rerun and the broken entry replaced
+		log.Warn().Err(err).Msg("Could not read cached results")
+		e = nil
+	}
+	if e != nil {
+		status := e.Status(time.Now())
+		if status != cache.StatusExpired {
+			log.Debug().Str("key", key).Str("status", string(status)).Time("created_at", e.CreatedAt).Msg("Using cached results")
+			if status == cache.StatusStale {
+				if _, loaded := revalidating.LoadOrStore(key, true); !loaded {
+					revalidations.Add(1)
+					go s.revalidate(parsedLayers, query, connection, key, o)
+				}
+			}
+			for _, row := range e.Rows {
+				err = gp.AddRow(ctx, row)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	collector := &rowsCollector{Processor: gp}
+	fetchSize, _ := ps["fetch-size"].(int)
+	err = stream.RunQueryIntoGlaze(ctx, db, query, []interface{}{}, collector, stream.WithFetchSize(fetchSize))
+	if err != nil {
+		return errors.Wrapf(err, "Could not run query")
+	}
+
+	err = store.Put(ctx, s.newCacheEntry(key, connection, query, collector.rows, o))
+	if err != nil {
+		// the results were output, failing to cache them doesn't fail the command
+		log.Warn().Err(err).Msg("Could not cache results")
+	}
+	return nil
+}
+
+// revalidate reruns query on a new connection, as the one of the command is closed once
+// the stale results are output, and caches its results.
+func (s *SqlCommand) revalidate(
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	query string,
+	connection string,
+	key string,
+	o *cacheOptions,
+) {
+	defer revalidations.Done()
+	defer revalidating.Delete(key)
+
+	err := func() error {
+		ctx := context.Background()
+		db, err := s.dbConnectionFactory(parsedLayers)
+		if err != nil {
+			return err
+		}
+		defer func(db *sqlx.DB) {
+			_ = db.Close()
+		}(db)
+
+		collector := &rowsCollector{Processor: &nullProcessor{}}
+		err = stream.RunQueryIntoGlaze(ctx, db, query, []interface{}{}, collector)
+		if err != nil {
+			return err
+		}
+
+		store, err := cache.Open(cache.DefaultPath())
+		if err != nil {
+			return err
+		}
+		defer func(store *cache.Store) {
+			_ = store.Close()
+		}(store)
+		return store.Put(ctx, s.newCacheEntry(key, connection, query, collector.rows, o))
+	}()
+	if err != nil {
+		log.Warn().Err(err).Str("command", s.fullName()).Msg("Could not refresh cached results")
+	}
+}
+
+func (s *SqlCommand) newCacheEntry(key string, connection string, query string, rows []types.Row, o *cacheOptions) *cache.Entry {
+	now := time.Now()
+	return &cache.Entry{
+		Key:        key,
+		Command:    s.fullName(),
+		Connection: connection,
+		Query:      query,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(o.ttl),
+		StaleUntil: now.Add(o.ttl + o.stale),
+		Rows:       rows,
+	}
+}
+
+// cacheMetadata reports whether the cache holds results for query, for Metadata.
+func (s *SqlCommand) cacheMetadata(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	query string,
+	ps map[string]interface{},
+	o *cacheOptions,
+) (map[string]interface{}, error) {
+	key, err := s.cacheKey(connections.NameFromParsedLayers(parsedLayers), query, ps, o)
+	if err != nil {
+		return nil, err
+	}
+	store, err := cache.Open(cache.DefaultPath())
+	if err != nil {
+		return nil, err
+	}
+	defer func(store *cache.Store) {
+		_ = store.Close()
+	}(store)
+
+	e, err := store.Peek(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || e.Status(time.Now()) == cache.StatusExpired {
+		return map[string]interface{}{"cache": "miss"}, nil
+	}
+	status := "hit"
+	if e.Status(time.Now()) == cache.StatusStale {
+		status = "stale"
+	}
+	return map[string]interface{}{
+		"cache":            status,
+		"cached_at":        e.CreatedAt,
+		"cache_expires_at": e.ExpiresAt,
+	}, nil
+}
+
+// rowsCollector keeps a copy of the rows passed to the processor it wraps,
+// as the row middlewares of the processor can modify them.
+type rowsCollector struct {
+	middlewares.Processor
+	rows []types.Row
+}
+
+func (r *rowsCollector) AddRow(ctx context.Context, row types.Row) error {
+	row_ := types.NewRow()
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		row_.Set(pair.Key, pair.Value)
+	}
+	r.rows = append(r.rows, row_)
+	return r.Processor.AddRow(ctx, row)
+}
+
+type nullProcessor struct{}
+
+func (n *nullProcessor) AddRow(ctx context.Context, row types.Row) error {
+	return nil
+}
+
+func (n *nullProcessor) Close(ctx context.Context) error {
+	return nil
+}
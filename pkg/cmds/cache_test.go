@@ -0,0 +1,73 @@
+package cmds
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/sqleton/pkg/cache"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCached(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "test.db")
+	factory := func(_ map[string]*layers.ParsedParameterLayer) (*sqlx.DB, error) {
+		return sqlx.Connect("sqlite3", path)
+	}
+	db, err := factory(nil)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	_, err = db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY); INSERT INTO t VALUES (1), (2)")
+	require.NoError(t, err)
+
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(factory),
+		WithQuery("SELECT id FROM t ORDER BY id"),
+		WithCache(&cache.Cache{TTL: "1m", KeyFlags: []string{"tenant"}}),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	run := func(ps map[string]interface{}) int {
+		gp := middlewares.NewTableProcessor()
+		gp.AddTableMiddleware(&table.NullTableMiddleware{})
+		err := s.Run(ctx, map[string]*layers.ParsedParameterLayer{}, ps, gp)
+		require.NoError(t, err)
+		require.NoError(t, gp.Close(ctx))
+		return len(gp.GetTable().Rows)
+	}
+
+	assert.Equal(t, 2, run(map[string]interface{}{}))
+	_, err = db.Exec("INSERT INTO t VALUES (3)")
+	require.NoError(t, err)
+
+	// the cached rows are returned
+	assert.Equal(t, 2, run(map[string]interface{}{}))
+	metadata, err := s.Metadata(ctx, map[string]*layers.ParsedParameterLayer{}, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, "hit", metadata["cache"])
+
+	assert.Equal(t, 3, run(map[string]interface{}{"no-cache": true}))
+	// the key flags are part of the key
+	assert.Equal(t, 3, run(map[string]interface{}{"tenant": "b"}))
+
+	// stale results are returned and refreshed in the background
+	s.Cache = &cache.Cache{TTL: "1ns", StaleWhileRevalidate: "1h"}
+	assert.Equal(t, 3, run(map[string]interface{}{}))
+	_, err = db.Exec("INSERT INTO t VALUES (4)")
+	require.NoError(t, err)
+	assert.Equal(t, 3, run(map[string]interface{}{}))
+	metadata, err = s.Metadata(ctx, map[string]*layers.ParsedParameterLayer{}, map[string]interface{}{})
+	require.NoError(t, err)
+	WaitForRevalidations()
+	assert.Equal(t, "stale", metadata["cache"])
+	assert.Equal(t, 4, run(map[string]interface{}{}))
+}
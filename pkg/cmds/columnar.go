@@ -0,0 +1,73 @@
+package cmds
+
+import (
+	"context"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/columnar"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+)
+
+// runColumnar writes the results of the rendered query to a parquet file or an arrow IPC stream
+// instead of the glazed processor, with the column types of the result.
+//
+// The file is only moved into place once it is complete.
+func (s *SqlCommand) runColumnar(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	ps map[string]interface{},
+	ps_ *flags.PaginationSettings,
+	format string,
+	path string,
+) error {
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if path != "-" {
+		var err error
+		f, err = os.Create(path + ".tmp")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+		w = f
+	}
+
+	cw, err := columnar.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	if s.Pagination != nil {
+		err = s.runPages(ctx, db, ps, cw, ps_, true)
+	} else {
+		err = s.runQuery(ctx, db, query, ps, cw)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Could not run query")
+	}
+
+	err = cw.Close(ctx)
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+		err = os.Rename(f.Name(), path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return &cmds.ExitWithoutGlazeError{}
+}
@@ -0,0 +1,171 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	"strings"
+)
+
+type connectionResult struct {
+	query string
+	rows  []types.Row
+	err   error
+}
+
+// runConnections runs the query against each of the selected connections, with at most
+// cs.Parallelism of them running at the same time.
+//
+// Each row is prefixed with a _connection column. A connection that fails doesn't abort
+// the others, it is output as a row with _connection and _error columns instead.
+// Rows are output once all the connections are done, grouped by connection in the order they were selected.
+func (s *SqlCommand) runConnections(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+	cs *flags.ConnectionsSettings,
+	h *history.Recorder,
+) error {
+	layers_ := make([]*layers.ParsedParameterLayer, 0, len(parsedLayers))
+	for _, l := range parsedLayers {
+		layers_ = append(layers_, l)
+	}
+	config, err := sql2.NewConfigFromParsedLayers(layers_...)
+	if err != nil {
+		return err
+	}
+
+	sources, err := connections.Resolve(
+		cs.Connections, cs.AllDbtProfiles, cs.ProfileGlob,
+		connections.ConfigPath(), config.DbtProfilesPath,
+	)
+	if err != nil {
+		return err
+	}
+
+	printQuery, _ := ps["print-query"].(bool)
+
+	results := make([]*connectionResult, len(sources))
+	eg := errgroup.Group{}
+	eg.SetLimit(cs.Parallelism)
+	for i, source := range sources {
+		i, source := i, source
+		eg.Go(func() error {
+			results[i] = s.queryConnection(ctx, source, ps, printQuery)
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.Name
+		if results[i].err == nil && !printQuery {
+			h.AddQuery(fmt.Sprintf("-- %s\n%s", source.Name, results[i].query))
+		}
+	}
+	h.SetConnection(strings.Join(names, ","))
+
+	for i, source := range sources {
+		result := results[i]
+
+		if printQuery {
+			fmt.Printf("-- %s\n", source.Name)
+			if result.err != nil {
+				fmt.Printf("-- error: %s\n\n", result.err)
+			} else {
+				fmt.Printf("%s\n\n", result.query)
+			}
+			continue
+		}
+
+		if result.err != nil {
+			err = gp.AddRow(ctx, types.NewRow(
+				types.MRP("_connection", source.Name),
+				types.MRP("_error", result.err.Error()),
+			))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, row := range result.rows {
+			row_ := types.NewRow(types.MRP("_connection", source.Name))
+			for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+				row_.Set(pair.Key, pair.Value)
+			}
+			err = gp.AddRow(ctx, row_)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if printQuery {
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	return nil
+}
+
+// queryConnection renders and runs the query against a single connection, collecting its rows.
+func (s *SqlCommand) queryConnection(
+	ctx context.Context,
+	source *sql2.Source,
+	ps map[string]interface{},
+	renderOnly bool,
+) *connectionResult {
+	ret := &connectionResult{}
+
+	db, err := connections.Open(ctx, source)
+	if err != nil {
+		ret.err = err
+		return ret
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	// the query is rendered for every connection, as templates can query the database
+	ret.query, err = s.RenderQuery(ctx, ps, db)
+	if err != nil {
+		ret.err = errors.Wrap(err, "Could not generate query")
+		return ret
+	}
+	if renderOnly {
+		return ret
+	}
+
+	collector := middlewares.NewTableProcessor(
+		middlewares.WithTableMiddleware(&table.NullTableMiddleware{}),
+	)
+	// streamed as on a single connection, honoring --fetch-size
+	err = s.runQuery(ctx, db, ret.query, ps, collector)
+	if err == nil {
+		err = collector.Close(ctx)
+	}
+	if err != nil {
+		ret.err = errors.Wrap(err, "Could not run query")
+		return ret
+	}
+	ret.rows = collector.GetTable().Rows
+
+	return ret
+}
@@ -0,0 +1,168 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"os"
+	"strings"
+)
+
+// paginationParameters returns a copy of ps with the `pagination` template variable
+// used by queries declaring a pagination section:
+//
+//   - .pagination.where is the keyset predicate selecting the rows after cursor, empty for the first page
+//   - .pagination.order_by is the ORDER BY clause matching the pagination keys
+//   - .pagination.limit is the page size, 0 if the page size flag of the command disables pagination
+func (s *SqlCommand) paginationParameters(
+	ps map[string]interface{},
+	driver string,
+	cursor string,
+) (map[string]interface{}, error) {
+	where := ""
+	if cursor != "" {
+		var err error
+		where, err = s.Pagination.Where(cursor, driver)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make(map[string]interface{}, len(ps)+1)
+	for k, v := range ps {
+		ret[k] = v
+	}
+	ret["pagination"] = map[string]interface{}{
+		"where":    where,
+		"order_by": s.Pagination.OrderBy(),
+		"limit":    s.pageSize(ps),
+	}
+	return ret, nil
+}
+
+func (s *SqlCommand) pageSize(ps map[string]interface{}) int {
+	if pageSize, _ := ps["page-size"].(int); pageSize > 0 {
+		return pageSize
+	}
+	if s.Pagination.PageSizeFlag != "" {
+		pageSize, _ := ps[s.Pagination.PageSizeFlag].(int)
+		return pageSize
+	}
+	if s.Pagination.PageSize > 0 {
+		return s.Pagination.PageSize
+	}
+	return pagination.DefaultPageSize
+}
+
+// appliesPagination renders the query for the page following a placeholder cursor, and checks
+// that it contains the keyset predicate. Templates can leave .pagination.where out, for example
+// when the rows are ordered by another column, in which case the query can't be paged through.
+func (s *SqlCommand) appliesPagination(
+	ctx context.Context,
+	db *sqlx.DB,
+	ps map[string]interface{},
+) (bool, error) {
+	row := types.NewRow()
+	for _, k := range s.Pagination.Keys {
+		row.Set(k.Column, 0)
+	}
+	cursor, err := s.Pagination.EncodeCursor(row)
+	if err != nil {
+		return false, err
+	}
+	where, err := s.Pagination.Where(cursor, db.DriverName())
+	if err != nil {
+		return false, err
+	}
+	pageParameters, err := s.paginationParameters(ps, db.DriverName(), cursor)
+	if err != nil {
+		return false, err
+	}
+	query, err := s.RenderQuery(ctx, pageParameters, db)
+	if err != nil {
+		return false, errors.Wrapf(err, "Could not generate query")
+	}
+	return strings.Contains(query, where), nil
+}
+
+// runPages runs the query page by page, starting after --page-after.
+//
+// Without --all-pages, only one page is output, and if it is full and printNextPage is set,
+// the cursor of the next page is printed on stderr. With --all-pages, the query is rerun with
+// the cursor of the last row until a page is not full, streaming the rows of each page as they come.
+//
+// If the query doesn't apply the keyset predicate with the given flags, --page-after and --all-pages
+// are rejected, and the query is only run once.
+func (s *SqlCommand) runPages(
+	ctx context.Context,
+	db *sqlx.DB,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+	ps_ *flags.PaginationSettings,
+	printNextPage bool,
+) error {
+	pageSize := s.pageSize(ps)
+	cursor := ps_.PageAfter
+
+	if pageSize > 0 {
+		applies, err := s.appliesPagination(ctx, db, ps)
+		if err != nil {
+			return err
+		}
+		if !applies {
+			if ps_.AllPages || ps_.PageAfter != "" {
+				return errors.Errorf("--page-after and --all-pages can't be used with these flags, " +
+					"the query doesn't restrict the rows to the next page")
+			}
+			pageSize = 0
+		}
+	}
+
+	for {
+		pageParameters, err := s.paginationParameters(ps, db.DriverName(), cursor)
+		if err != nil {
+			return err
+		}
+		query, err := s.RenderQuery(ctx, pageParameters, db)
+		if err != nil {
+			return errors.Wrapf(err, "Could not generate query")
+		}
+
+		recorder := pagination.NewRecorder(s.Pagination, gp)
+		err = s.runQuery(ctx, db, query, pageParameters, recorder)
+		if err != nil {
+			return errors.Wrapf(err, "Could not run query")
+		}
+		if pageSize == 0 || recorder.Count < pageSize {
+			return nil
+		}
+
+		next, err := recorder.Cursor()
+		if err != nil {
+			if !ps_.AllPages && ps_.PageAfter == "" {
+				// the query doesn't necessarily return the keys, for example when grouping,
+				// this only matters when explicitly paging
+				log.Debug().Err(err).Msg("could not compute the cursor of the next page")
+				return nil
+			}
+			return err
+		}
+		if next == cursor {
+			return errors.New("the cursor of the next page is the cursor of the current page, " +
+				"the pagination keys don't match the order of the rows")
+		}
+		cursor = next
+		if !ps_.AllPages {
+			if printNextPage {
+				_, _ = fmt.Fprintf(os.Stderr, "next page: --page-after %s\n", cursor)
+			}
+			return nil
+		}
+	}
+}
@@ -12,8 +12,16 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
 	"github.com/go-go-golems/glazed/pkg/helpers/templating"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
 	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/assertions"
+	"github.com/go-go-golems/sqleton/pkg/cache"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/load"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
+	"github.com/go-go-golems/sqleton/pkg/stream"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -46,6 +54,16 @@ type SqlCommandDescription struct {
 
 	SubQueries map[string]string `yaml:"subqueries,omitempty"`
 	Query      string            `yaml:"query"`
+
+	// Keys lists the columns that identify a row of the result, used for example by --watch-diff
+	Keys []string `yaml:"keys,omitempty"`
+
+	Pagination *pagination.Pagination `yaml:"pagination,omitempty"`
+
+	Cache *cache.Cache `yaml:"cache,omitempty"`
+
+	// Assert lists assertions on the results, checked by sqleton check
+	Assert assertions.Expressions `yaml:"assert,omitempty"`
 }
 
 type DBConnectionFactory func(parsedLayers map[string]*layers.ParsedParameterLayer) (*sqlx.DB, error)
@@ -53,10 +71,16 @@ type DBConnectionFactory func(parsedLayers map[string]*layers.ParsedParameterLay
 // SqlCommand describes a command line command that runs a query
 type SqlCommand struct {
 	*cmds.CommandDescription
-	Query               string              `yaml:"query"`
-	SubQueries          map[string]string   `yaml:"subqueries,omitempty"`
-	dbConnectionFactory DBConnectionFactory `yaml:"-"`
-	renderedQuery       string
+	Query      string            `yaml:"query"`
+	SubQueries map[string]string `yaml:"subqueries,omitempty"`
+	Keys       []string          `yaml:"keys,omitempty"`
+	// Pagination enables keyset pagination, see paginationParameters
+	Pagination *pagination.Pagination `yaml:"pagination,omitempty"`
+	// Cache caches the results of the command, see runCached
+	Cache *cache.Cache `yaml:"cache,omitempty"`
+	// Assert lists assertions on the results, see assertions.Parse
+	Assert              assertions.Expressions `yaml:"assert,omitempty"`
+	dbConnectionFactory DBConnectionFactory    `yaml:"-"`
 }
 
 func (s *SqlCommand) Metadata(ctx context.Context, parsedLayers map[string]*layers.ParsedParameterLayer, ps map[string]interface{}) (map[string]interface{}, error) {
@@ -78,9 +102,34 @@ func (s *SqlCommand) Metadata(ctx context.Context, parsedLayers map[string]*laye
 		return nil, errors.Wrapf(err, "Could not generate query")
 	}
 
-	return map[string]interface{}{
+	ret := map[string]interface{}{
 		"query": query,
-	}, nil
+	}
+
+	cacheSettings, err := flags.NewCacheSettingsFromParameters(ps)
+	if err != nil {
+		return nil, err
+	}
+	cacheOptions, err := s.cacheOptions(cacheSettings)
+	if err != nil {
+		return nil, err
+	}
+	if cacheOptions != nil && s.Pagination == nil {
+		cacheMetadata, err := s.cacheMetadata(ctx, parsedLayers, query, ps, cacheOptions)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range cacheMetadata {
+			ret[k] = v
+		}
+	}
+
+	return ret, nil
+}
+
+// fullName is the name of the command prefixed by its parents, as it is run on the command line.
+func (s *SqlCommand) fullName() string {
+	return strings.Join(append(append([]string{}, s.Parents...), s.Name), " ")
 }
 
 func (s *SqlCommand) String() string {
@@ -116,6 +165,30 @@ func WithSubQueries(subQueries map[string]string) SqlCommandOption {
 	}
 }
 
+func WithKeys(keys []string) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.Keys = keys
+	}
+}
+
+func WithPagination(pagination *pagination.Pagination) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.Pagination = pagination
+	}
+}
+
+func WithCache(cache *cache.Cache) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.Cache = cache
+	}
+}
+
+func WithAssert(assert assertions.Expressions) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.Assert = assert
+	}
+}
+
 func NewSqlCommand(
 	description *cmds.CommandDescription,
 	options ...SqlCommandOption,
@@ -136,8 +209,33 @@ func NewSqlCommand(
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create SQL helpers parameter layer")
 	}
+	watchParameterLayer, err := flags.NewWatchParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create watch parameter layer")
+	}
+	connectionsParameterLayer, err := flags.NewConnectionsParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create connections parameter layer")
+	}
+	scratchParameterLayer, err := flags.NewScratchParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create scratch parameter layer")
+	}
+	columnarParameterLayer, err := flags.NewColumnarParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create columnar parameter layer")
+	}
+	cacheParameterLayer, err := flags.NewCacheParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create cache parameter layer")
+	}
 	description.Layers = append(description.Layers,
 		sqlHelpersParameterLayer,
+		watchParameterLayer,
+		connectionsParameterLayer,
+		scratchParameterLayer,
+		columnarParameterLayer,
+		cacheParameterLayer,
 		glazedParameterLayer,
 		sqlConnectionParameterLayer,
 		dbtParameterLayer,
@@ -152,6 +250,29 @@ func NewSqlCommand(
 		option(ret)
 	}
 
+	if ret.Cache != nil {
+		_, _, err = ret.Cache.Durations()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = assertions.ParseAll(ret.Assert)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Pagination != nil {
+		if len(ret.Pagination.Keys) == 0 {
+			return nil, errors.New("pagination section without keys")
+		}
+		paginationParameterLayer, err := flags.NewPaginationParameterLayer()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create pagination parameter layer")
+		}
+		description.Layers = append(description.Layers, paginationParameterLayer)
+	}
+
 	return ret, nil
 }
 
@@ -160,13 +281,93 @@ func (s *SqlCommand) Run(
 	parsedLayers map[string]*layers.ParsedParameterLayer,
 	ps map[string]interface{},
 	gp middlewares.Processor,
-) error {
+) (err error) {
 	if s.dbConnectionFactory == nil {
 		return fmt.Errorf("dbConnectionFactory is not set")
 	}
 
-	// at this point, the factory can probably be passed the sql-connection parsed layer
-	db, err := s.dbConnectionFactory(parsedLayers)
+	h := history.Start(s.fullName(), parsedLayers)
+	defer func() {
+		h.Finish(err)
+	}()
+	gp = h.Processor(gp)
+
+	watchSettings, err := flags.NewWatchSettingsFromParameters(ps)
+	if err != nil {
+		return err
+	}
+
+	connectionsSettings, err := flags.NewConnectionsSettingsFromParameters(ps)
+	if err != nil {
+		return err
+	}
+	scratchSettings, err := flags.NewScratchSettingsFromParameters(ps)
+	if err != nil {
+		return err
+	}
+	paginationSettings, err := flags.NewPaginationSettingsFromParameters(ps)
+	if err != nil {
+		return err
+	}
+	columnarSettings, err := flags.NewColumnarSettingsFromParameters(ps)
+	if err != nil {
+		return err
+	}
+	columnarFormat, columnarFile, err := columnarSettings.Format()
+	if err != nil {
+		return err
+	}
+	cacheSettings, err := flags.NewCacheSettingsFromParameters(ps)
+	if err != nil {
+		return err
+	}
+	if cacheSettings.Cache {
+		switch {
+		case watchSettings.Interval > 0:
+			return errors.New("--cache can't be used with --watch")
+		case columnarFormat != "":
+			return errors.Errorf("--cache can't be used with --%s-file", columnarFormat)
+		case connectionsSettings.Enabled():
+			return errors.New("--cache can't be used when querying multiple connections")
+		case scratchSettings.Enabled():
+			return errors.New("--cache can't be used with --scratch")
+		case s.Pagination != nil:
+			return errors.New("--cache can't be used with paginated commands")
+		}
+	}
+	if watchSettings.WatchDiff && watchSettings.Interval == 0 {
+		return errors.New("--watch-diff can only be used with --watch")
+	}
+	if paginationSettings.AllPages && watchSettings.Interval > 0 {
+		return errors.New("--all-pages can't be used with --watch")
+	}
+	if columnarFormat != "" && watchSettings.Interval > 0 {
+		return errors.Errorf("--%s-file can't be used with --watch", columnarFormat)
+	}
+	if connectionsSettings.Enabled() {
+		if paginationSettings.AllPages {
+			return errors.New("--all-pages can't be used when querying multiple connections")
+		}
+		if watchSettings.Interval > 0 {
+			return errors.New("--watch can't be used when querying multiple connections")
+		}
+		if scratchSettings.Enabled() {
+			return errors.New("--scratch can't be used when querying multiple connections")
+		}
+		if columnarFormat != "" {
+			return errors.Errorf("--%s-file can't be used when querying multiple connections", columnarFormat)
+		}
+		return s.runConnections(ctx, parsedLayers, ps, gp, connectionsSettings, h)
+	}
+
+	var db *sqlx.DB
+	if scratchSettings.Enabled() {
+		h.SetConnection("scratch:" + strings.Join(scratchSettings.Files, ","))
+		db, err = load.OpenScratch(ctx, scratchSettings.Files)
+	} else {
+		// at this point, the factory can probably be passed the sql-connection parsed layer
+		db, err = s.dbConnectionFactory(parsedLayers)
+	}
 	if err != nil {
 		return err
 	}
@@ -179,18 +380,41 @@ func (s *SqlCommand) Run(
 		return errors.Wrapf(err, "Could not ping database")
 	}
 
-	s.renderedQuery, err = s.RenderQuery(ctx, ps, db)
+	query, err := s.RenderQuery(ctx, ps, db)
 	if err != nil {
 		return errors.Wrapf(err, "Could not generate query")
 	}
 
 	printQuery, _ := ps["print-query"].(bool)
 	if printQuery {
-		fmt.Println(s.renderedQuery)
+		fmt.Println(query)
 		return &cmds.ExitWithoutGlazeError{}
 	}
+	h.AddQuery(query)
+
+	if watchSettings.Interval > 0 {
+		return s.runWatch(ctx, db, query, ps, watchSettings)
+	}
+
+	if columnarFormat != "" {
+		return s.runColumnar(ctx, db, query, ps, paginationSettings, columnarFormat, columnarFile)
+	}
+
+	if s.Pagination != nil {
+		return s.runPages(ctx, db, ps, gp, paginationSettings, true)
+	}
+
+	if !scratchSettings.Enabled() {
+		cacheOptions, err := s.cacheOptions(cacheSettings)
+		if err != nil {
+			return err
+		}
+		if cacheOptions != nil {
+			return s.runCached(ctx, parsedLayers, db, query, ps, gp, cacheOptions)
+		}
+	}
 
-	err = s.RunQueryIntoGlaze(ctx, db, ps, gp)
+	err = s.runQuery(ctx, db, query, ps, gp)
 	if err != nil {
 		return errors.Wrapf(err, "Could not run query")
 	}
@@ -241,6 +465,19 @@ func (s *SqlCommand) RenderQuery(
 	ps map[string]interface{},
 	db *sqlx.DB,
 ) (string, error) {
+	if _, ok := ps["pagination"]; s.Pagination != nil && !ok {
+		pageAfter, _ := ps["page-after"].(string)
+		driver := ""
+		if db != nil {
+			driver = db.DriverName()
+		}
+		var err error
+		ps, err = s.paginationParameters(ps, driver, pageAfter)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	t2 := sql2.CreateTemplate(ctx, s.SubQueries, ps, db)
 
 	t, err := t2.Parse(s.Query)
@@ -258,13 +495,33 @@ func (s *SqlCommand) RenderQuery(
 	return ret, nil
 }
 
+// RunQueryIntoGlaze renders the query with ps and streams its rows into gp.
 func (s *SqlCommand) RunQueryIntoGlaze(
 	ctx context.Context,
 	db *sqlx.DB,
 	ps map[string]interface{},
 	gp middlewares.Processor) error {
 
-	return sql2.RunQueryIntoGlaze(ctx, db, s.renderedQuery, []interface{}{}, gp)
+	query, err := s.RenderQuery(ctx, ps, db)
+	if err != nil {
+		return errors.Wrapf(err, "Could not generate query")
+	}
+	return s.runQuery(ctx, db, query, ps, gp)
+}
+
+// runQuery streams the rows of the rendered query into gp.
+//
+// The rendered query is passed along rather than stored on the command, as the same command
+// can be run concurrently, for example by the jobs of sqleton schedule.
+func (s *SqlCommand) runQuery(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	fetchSize, _ := ps["fetch-size"].(int)
+	return stream.RunQueryIntoGlaze(ctx, db, query, []interface{}{}, gp, stream.WithFetchSize(fetchSize))
 }
 
 type SqlCommandLoader struct {
@@ -304,6 +561,10 @@ func (scl *SqlCommandLoader) LoadCommandFromYAML(
 		WithDbConnectionFactory(scl.DBConnectionFactory),
 		WithQuery(scd.Query),
 		WithSubQueries(scd.SubQueries),
+		WithKeys(scd.Keys),
+		WithPagination(scd.Pagination),
+		WithCache(scd.Cache),
+		WithAssert(scd.Assert),
 	)
 	if err != nil {
 		return nil, err
@@ -319,3 +580,49 @@ func (scl *SqlCommandLoader) LoadCommandFromYAML(
 
 	return []cmds.Command{sq}, nil
 }
+
+// Rows renders and runs the query against db, and returns all its rows.
+// Paginated queries are run page by page, as with --all-pages, unless their page size
+// is a flag of the command, which then limits the rows as in a single run.
+func (s *SqlCommand) Rows(
+	ctx context.Context,
+	db *sqlx.DB,
+	ps map[string]interface{},
+) ([]types.Row, error) {
+	collector := middlewares.NewTableProcessor(
+		middlewares.WithTableMiddleware(&table.NullTableMiddleware{}),
+	)
+
+	if s.Pagination != nil {
+		paginationSettings, err := flags.NewPaginationSettingsFromParameters(ps)
+		if err != nil {
+			return nil, err
+		}
+		// commands with a page size flag use it as a limit, the others return all the pages
+		if s.Pagination.PageSizeFlag == "" && !paginationSettings.AllPages {
+			paginationSettings.AllPages, err = s.appliesPagination(ctx, db, ps)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = s.runPages(ctx, db, ps, collector, paginationSettings, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		query, err := s.RenderQuery(ctx, ps, db)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not generate query")
+		}
+		err = s.runQuery(ctx, db, query, ps, collector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not run query")
+		}
+	}
+
+	err := collector.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return collector.GetTable().Rows, nil
+}
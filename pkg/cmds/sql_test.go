@@ -2,6 +2,7 @@ package cmds
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
@@ -9,9 +10,11 @@ import (
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/middlewares/table"
 	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/pagination"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 
 	// sqlite
@@ -436,3 +439,159 @@ func TestMapSubQuery(t *testing.T) {
 	assert.Equal(t, "test1", name)
 
 }
+
+func TestPaginationAllPages(t *testing.T) {
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery(`SELECT id, name FROM test2
+{{ if .pagination.where }}WHERE {{ .pagination.where }}{{ end }}
+ORDER BY {{ .pagination.order_by }} LIMIT {{ .pagination.limit }}`),
+		WithPagination(&pagination.Pagination{
+			Keys:     []*pagination.Key{{Column: "id", Order: "desc"}},
+			PageSize: 2,
+		}),
+	)
+	require.NoError(t, err)
+
+	query, err := s.RenderQuery(context.Background(), map[string]interface{}{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT id, name FROM test2\nORDER BY id DESC LIMIT 2", query)
+
+	gp := middlewares.NewTableProcessor()
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+	ctx := context.Background()
+	err = s.Run(ctx, map[string]*layers.ParsedParameterLayer{}, map[string]interface{}{"all-pages": true}, gp)
+	require.NoError(t, err)
+	require.NoError(t, gp.Close(ctx))
+
+	ids := []interface{}{}
+	for _, row := range gp.GetTable().Rows {
+		id, _ := row.Get("id")
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []interface{}{int64(3), int64(2), int64(1)}, ids)
+}
+
+func TestRowsAllPages(t *testing.T) {
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery(`SELECT id, name FROM test2
+{{ if .pagination.where }}WHERE {{ .pagination.where }}{{ end }}
+ORDER BY {{ .pagination.order_by }} LIMIT {{ .pagination.limit }}`),
+		WithPagination(&pagination.Pagination{
+			Keys:     []*pagination.Key{{Column: "id"}},
+			PageSize: 2,
+		}),
+	)
+	require.NoError(t, err)
+
+	db, err := createDB(nil)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	rows, err := s.Rows(context.Background(), db, map[string]interface{}{})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	name, _ := rows[2].Get("name")
+	assert.Equal(t, "test2_3", name)
+}
+
+func TestWatchDiffWithoutWatch(t *testing.T) {
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery("SELECT * FROM test"),
+	)
+	require.NoError(t, err)
+
+	gp := middlewares.NewTableProcessor()
+	err = s.Run(context.Background(), map[string]*layers.ParsedParameterLayer{}, map[string]interface{}{"watch-diff": true}, gp)
+	assert.EqualError(t, err, "--watch-diff can only be used with --watch")
+}
+
+func TestPaginationNotApplied(t *testing.T) {
+	// like wp ls-posts, the keyset predicate is only applied when not ordering by another column
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery(`SELECT id, name FROM test2
+{{ if and .pagination.where (not .order_by) }}WHERE {{ .pagination.where }}{{ end }}
+ORDER BY {{ if .order_by }}{{ .order_by }}{{ else }}{{ .pagination.order_by }}{{ end }}
+LIMIT {{ .pagination.limit }}`),
+		WithPagination(&pagination.Pagination{
+			Keys:         []*pagination.Key{{Column: "id", Order: "desc"}},
+			PageSizeFlag: "limit",
+		}),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	run := func(ps map[string]interface{}) ([]types.Row, error) {
+		gp := middlewares.NewTableProcessor()
+		gp.AddTableMiddleware(&table.NullTableMiddleware{})
+		err := s.Run(ctx, map[string]*layers.ParsedParameterLayer{}, ps, gp)
+		if err != nil {
+			return nil, err
+		}
+		require.NoError(t, gp.Close(ctx))
+		return gp.GetTable().Rows, nil
+	}
+
+	rows, err := run(map[string]interface{}{"limit": 2, "order_by": "", "all-pages": true})
+	require.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	_, err = run(map[string]interface{}{"limit": 2, "order_by": "id", "all-pages": true})
+	assert.ErrorContains(t, err, "can't be used with these flags")
+
+	_, err = run(map[string]interface{}{"limit": 2, "order_by": "id", "page-after": "WzJd"})
+	assert.ErrorContains(t, err, "can't be used with these flags")
+
+	rows, err = run(map[string]interface{}{"limit": 2, "order_by": "id"})
+	require.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	db, err := createDB(nil)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	// the page size flag is the limit of the user, Rows doesn't fetch all the pages
+	for _, orderBy := range []string{"", "id"} {
+		rows, err = s.Rows(ctx, db, map[string]interface{}{"limit": 2, "order_by": orderBy})
+		require.NoError(t, err)
+		assert.Len(t, rows, 2)
+	}
+}
+
+func TestRowsConcurrent(t *testing.T) {
+	// scheduled jobs run the same command concurrently, with different flags
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery("SELECT name FROM test WHERE id = {{ .id }}"),
+	)
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		id := i%3 + 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := createDB(nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = db.Close() }()
+
+			rows, err := s.Rows(context.Background(), db, map[string]interface{}{"id": id})
+			if assert.NoError(t, err) && assert.Len(t, rows, 1) {
+				name, _ := rows[0].Get("name")
+				assert.Equal(t, fmt.Sprintf("test%d", id), name)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,119 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/diff"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-isatty"
+	"os"
+	"strings"
+	"time"
+)
+
+// runWatch reruns the rendered query every interval until the context is canceled.
+//
+// Because the glazed processor passed to Run can only output its rows once, every
+// run gets its own processor, created from the glazed flags in ps.
+// When outputting to a terminal, the screen is cleared before each run so that the table is
+// redrawn in place. In diff mode, only the rows that changed since the previous run are output,
+// with additional _change, _time and _changed_fields columns, which is suitable for streaming into logs.
+func (s *SqlCommand) runWatch(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	ps map[string]interface{},
+	ws *flags.WatchSettings,
+) error {
+	keys := ws.WatchKeys
+	if len(keys) == 0 {
+		keys = s.Keys
+	}
+	fetchSize, _ := ps["fetch-size"].(int)
+	redraw := !ws.WatchDiff && isatty.IsTerminal(os.Stdout.Fd())
+
+	ticker := time.NewTicker(ws.Interval)
+	defer ticker.Stop()
+
+	var previous []types.Row
+	for {
+		collector := middlewares.NewTableProcessor(
+			middlewares.WithTableMiddleware(&table.NullTableMiddleware{}),
+		)
+		err := stream.RunQueryIntoGlaze(ctx, db, query, []interface{}{}, collector, stream.WithFetchSize(fetchSize))
+		if err != nil {
+			if ctx.Err() != nil {
+				return &cmds.ExitWithoutGlazeError{}
+			}
+			return err
+		}
+		err = collector.Close(ctx)
+		if err != nil {
+			return err
+		}
+		rows := collector.GetTable().Rows
+
+		gp, err := settings.SetupTableProcessor(ps)
+		if err != nil {
+			return err
+		}
+		_, err = settings.SetupProcessorOutput(gp, ps, os.Stdout)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if redraw {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("Every %s: %s\t%s\n\n", ws.Interval, s.Name, now.Format(time.RFC1123))
+		}
+
+		if ws.WatchDiff {
+			for _, change := range diff.Rows(previous, rows, keys) {
+				row_ := types.NewRow(
+					types.MRP("_change", string(change.Type)),
+					types.MRP("_time", now.Format(time.RFC3339)),
+				)
+				values := change.After
+				if values == nil {
+					values = change.Before
+				}
+				for pair := values.Oldest(); pair != nil; pair = pair.Next() {
+					row_.Set(pair.Key, pair.Value)
+				}
+				row_.Set("_changed_fields", strings.Join(change.ChangedFields(), ","))
+
+				err = gp.AddRow(ctx, row_)
+				if err != nil {
+					return err
+				}
+			}
+			previous = rows
+		} else {
+			for _, row_ := range rows {
+				err = gp.AddRow(ctx, row_)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = gp.Close(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return &cmds.ExitWithoutGlazeError{}
+		case <-ticker.C:
+		}
+	}
+}
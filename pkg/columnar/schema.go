@@ -0,0 +1,145 @@
+package columnar
+
+import (
+	"database/sql"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Column describes the result column a field of the arrow schema is derived from.
+type Column struct {
+	Name             string
+	DatabaseTypeName string
+	ScanType         reflect.Type
+	Precision        int64
+	Scale            int64
+	HasDecimalSize   bool
+}
+
+// ColumnsFromColumnTypes converts the column types returned by the driver.
+func ColumnsFromColumnTypes(columnTypes []*sql.ColumnType) []*Column {
+	ret := make([]*Column, len(columnTypes))
+	for i, ct := range columnTypes {
+		c := &Column{
+			Name:             ct.Name(),
+			DatabaseTypeName: strings.ToUpper(ct.DatabaseTypeName()),
+			ScanType:         ct.ScanType(),
+		}
+		c.Precision, c.Scale, c.HasDecimalSize = ct.DecimalSize()
+		ret[i] = c
+	}
+	return ret
+}
+
+// decimalSizeRegexp matches the precision and scale of declared types like DECIMAL(10,2),
+// which is what sqlite returns as type name.
+var decimalSizeRegexp = regexp.MustCompile(`\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)`)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte{})
+)
+
+// DataType returns the arrow type for values of the column, and false if neither the
+// database type name nor the scan type of the column tell.
+//
+// Decimals without a known precision, or too large for 128 bits, are returned as strings
+// so that they don't lose precision.
+func (c *Column) DataType() (arrow.DataType, bool) {
+	name := c.DatabaseTypeName
+	base := name
+	if i := strings.IndexByte(base, '('); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	unsigned := strings.Contains(base, "UNSIGNED")
+	base = strings.TrimSpace(strings.Replace(base, "UNSIGNED", "", 1))
+
+	switch base {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT",
+		"INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL", "YEAR":
+		if unsigned && base == "BIGINT" {
+			return arrow.PrimitiveTypes.Uint64, true
+		}
+		return arrow.PrimitiveTypes.Int64, true
+	case "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "DOUBLE PRECISION", "REAL":
+		return arrow.PrimitiveTypes.Float64, true
+	case "DECIMAL", "NUMERIC":
+		precision, scale, ok := c.Precision, c.Scale, c.HasDecimalSize
+		if !ok {
+			precision, scale, ok = parseDecimalSize(name)
+		}
+		if !ok || precision <= 0 || precision > 38 {
+			return arrow.BinaryTypes.String, true
+		}
+		return &arrow.Decimal128Type{Precision: int32(precision), Scale: int32(scale)}, true
+	case "BOOL", "BOOLEAN":
+		return arrow.FixedWidthTypes.Boolean, true
+	case "DATE":
+		return arrow.FixedWidthTypes.Date32, true
+	case "TIMESTAMP", "DATETIME":
+		return &arrow.TimestampType{Unit: arrow.Microsecond}, true
+	case "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE":
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, true
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BYTEA", "BINARY", "VARBINARY":
+		return arrow.BinaryTypes.Binary, true
+	case "":
+	default:
+		return arrow.BinaryTypes.String, true
+	}
+
+	return dataTypeOf(c.ScanType)
+}
+
+// dataTypeOf returns the arrow type for values of type t.
+func dataTypeOf(t reflect.Type) (arrow.DataType, bool) {
+	if t == nil {
+		return nil, false
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &arrow.TimestampType{Unit: arrow.Microsecond}, true
+	case bytesType:
+		return arrow.BinaryTypes.Binary, true
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return arrow.PrimitiveTypes.Int64, true
+	case reflect.Uint, reflect.Uint64:
+		return arrow.PrimitiveTypes.Uint64, true
+	case reflect.Float32, reflect.Float64:
+		return arrow.PrimitiveTypes.Float64, true
+	case reflect.Bool:
+		return arrow.FixedWidthTypes.Boolean, true
+	case reflect.String:
+		return arrow.BinaryTypes.String, true
+	}
+	return nil, false
+}
+
+func parseDecimalSize(name string) (int64, int64, bool) {
+	m := decimalSizeRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return 0, 0, false
+	}
+	precision, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	var scale int64
+	if m[2] != "" {
+		scale, err = strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return precision, scale, true
+}
@@ -0,0 +1,379 @@
+package columnar
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatParquet = "parquet"
+	FormatArrow   = "arrow"
+)
+
+// Formats lists the formats a Writer can write.
+var Formats = []string{FormatParquet, FormatArrow}
+
+// DefaultBatchSize is the number of rows written at once, as a parquet row group or an arrow record batch.
+const DefaultBatchSize = 65536
+
+// recordWriter is implemented by the arrow ipc and the parquet writers.
+type recordWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
+// Writer writes rows into a parquet file or an arrow IPC stream.
+//
+// The schema is derived from the column types of the result, passed with SetColumnTypes
+// before the first row. Columns whose type is not known to the driver, such as expressions
+// in sqlite, are typed after the value in the first row, and are strings if that is NULL.
+type Writer struct {
+	format    string
+	w         io.Writer
+	batchSize int
+
+	columns []*Column
+	schema  *arrow.Schema
+	builder *array.RecordBuilder
+	writer  recordWriter
+	rows    int
+}
+
+var _ middlewares.Processor = (*Writer)(nil)
+
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	switch format {
+	case FormatParquet, FormatArrow:
+	default:
+		return nil, errors.Errorf("unknown format %s, use one of %s", format, strings.Join(Formats, ", "))
+	}
+	return &Writer{
+		format:    format,
+		w:         w,
+		batchSize: DefaultBatchSize,
+	}, nil
+}
+
+// SetColumnTypes sets the columns the schema is derived from.
+// It is called once per query, so only the first call is taken into account.
+func (w *Writer) SetColumnTypes(columnTypes []*sql.ColumnType) error {
+	if w.columns == nil {
+		w.columns = ColumnsFromColumnTypes(columnTypes)
+	}
+	return nil
+}
+
+func (w *Writer) AddRow(ctx context.Context, row types.Row) error {
+	if w.schema == nil {
+		err := w.start(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, field := range w.schema.Fields() {
+		v, _ := row.Get(field.Name)
+		err := appendValue(w.builder.Field(i), v)
+		if err != nil {
+			return errors.Wrapf(err, "could not convert value of column %s", field.Name)
+		}
+	}
+	w.rows++
+
+	if w.rows >= w.batchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the remaining rows and the end of the file. It doesn't close the underlying writer.
+func (w *Writer) Close(ctx context.Context) error {
+	if w.schema == nil {
+		err := w.start(nil)
+		if err != nil {
+			return err
+		}
+	}
+	defer w.builder.Release()
+
+	err := w.flush()
+	if err != nil {
+		return err
+	}
+	return w.writer.Close()
+}
+
+// start derives the schema from the columns and the first row, and writes the start of the file.
+func (w *Writer) start(row types.Row) error {
+	columns := w.columns
+	if columns == nil && row != nil {
+		// the rows didn't come with column types, so we type everything after the first row
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			columns = append(columns, &Column{Name: pair.Key})
+		}
+	}
+
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		dt, ok := c.DataType()
+		if !ok && row != nil {
+			v, _ := row.Get(c.Name)
+			if v != nil {
+				dt, ok = dataTypeOf(reflect.TypeOf(v))
+			}
+		}
+		if !ok {
+			dt = arrow.BinaryTypes.String
+		}
+		fields[i] = arrow.Field{Name: c.Name, Type: dt, Nullable: true}
+	}
+	w.schema = arrow.NewSchema(fields, nil)
+	w.builder = array.NewRecordBuilder(memory.DefaultAllocator, w.schema)
+
+	var err error
+	switch w.format {
+	case FormatArrow:
+		w.writer = ipc.NewWriter(w.w, ipc.WithSchema(w.schema))
+	case FormatParquet:
+		w.writer, err = pqarrow.NewFileWriter(
+			w.schema,
+			// the parquet writer closes its sink if it can, which is up to the caller of NewWriter
+			struct{ io.Writer }{w.w},
+			parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy)),
+			pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()),
+		)
+		if err != nil {
+			return errors.Wrap(err, "could not create parquet writer")
+		}
+	}
+	return nil
+}
+
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	rec := w.builder.NewRecord()
+	defer rec.Release()
+	w.rows = 0
+
+	err := w.writer.Write(rec)
+	if err != nil {
+		return errors.Wrapf(err, "could not write %s", w.format)
+	}
+	return nil
+}
+
+// appendValue converts v to the type of the builder. The drivers don't all return the same
+// types for a given column type: sqlite stores booleans as integers, and decimals are read as strings.
+func appendValue(b array.Builder, v interface{}) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		i, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		b.Append(i)
+	case *array.Uint64Builder:
+		s := fmt.Sprint(v)
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return errors.Errorf("%s is not an unsigned integer", s)
+		}
+		b.Append(i)
+	case *array.Float64Builder:
+		f, err := toFloat64(v)
+		if err != nil {
+			return err
+		}
+		b.Append(f)
+	case *array.Decimal128Builder:
+		dt := b.Type().(*arrow.Decimal128Type)
+		n, err := toDecimal128(v, dt.Precision, dt.Scale)
+		if err != nil {
+			return err
+		}
+		b.Append(n)
+	case *array.BooleanBuilder:
+		switch v_ := v.(type) {
+		case bool:
+			b.Append(v_)
+		default:
+			i, err := toInt64(v)
+			if err != nil {
+				return errors.Errorf("%v is not a boolean", v)
+			}
+			b.Append(i != 0)
+		}
+	case *array.Date32Builder:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		b.Append(arrow.Date32FromTime(t))
+	case *array.TimestampBuilder:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		if b.Type().(*arrow.TimestampType).TimeZone == "" {
+			// timestamps without time zone keep the wall clock time
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		b.Append(arrow.Timestamp(t.UnixMicro()))
+	case *array.BinaryBuilder:
+		switch v_ := v.(type) {
+		case []byte:
+			b.Append(v_)
+		case string:
+			b.AppendString(v_)
+		default:
+			b.AppendString(fmt.Sprint(v))
+		}
+	case *array.StringBuilder:
+		switch v_ := v.(type) {
+		case string:
+			b.Append(v_)
+		case []byte:
+			b.Append(string(v_))
+		case time.Time:
+			b.Append(v_.Format(time.RFC3339Nano))
+		default:
+			b.Append(fmt.Sprint(v))
+		}
+	default:
+		return errors.Errorf("unsupported column type %s", b.Type())
+	}
+	return nil
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch v_ := v.(type) {
+	case int64:
+		return v_, nil
+	case int:
+		return int64(v_), nil
+	case int32:
+		return int64(v_), nil
+	case int16:
+		return int64(v_), nil
+	case int8:
+		return int64(v_), nil
+	case uint32:
+		return int64(v_), nil
+	case uint16:
+		return int64(v_), nil
+	case uint8:
+		return int64(v_), nil
+	case bool:
+		if v_ {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		if v_ == float64(int64(v_)) {
+			return int64(v_), nil
+		}
+	case string:
+		i, err := strconv.ParseInt(v_, 10, 64)
+		if err == nil {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("%v is not an integer", v)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch v_ := v.(type) {
+	case float64:
+		return v_, nil
+	case float32:
+		return float64(v_), nil
+	case string:
+		f, err := strconv.ParseFloat(v_, 64)
+		if err == nil {
+			return f, nil
+		}
+	default:
+		i, err := toInt64(v)
+		if err == nil {
+			return float64(i), nil
+		}
+	}
+	return 0, errors.Errorf("%v is not a number", v)
+}
+
+func toDecimal128(v interface{}, precision, scale int32) (decimal128.Num, error) {
+	var s string
+	switch v_ := v.(type) {
+	case float64:
+		// sqlite stores decimals as floats, the shortest representation is what was inserted
+		s = strconv.FormatFloat(v_, 'f', -1, 64)
+	case float32:
+		s = strconv.FormatFloat(float64(v_), 'f', -1, 32)
+	default:
+		s = strings.TrimSpace(fmt.Sprint(v))
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return decimal128.Num{}, errors.Errorf("%s is not a decimal", s)
+	}
+	// decimal128.FromString goes through a float for values with a fractional part,
+	// so we scale the exact value ourselves
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !r.IsInt() {
+		return decimal128.Num{}, errors.Errorf("%s has more than %d decimals", s, scale)
+	}
+	n := decimal128.FromBigInt(r.Num())
+	if !n.FitsInPrecision(precision) {
+		return decimal128.Num{}, errors.Errorf("%s doesn't fit in a decimal(%d,%d)", s, precision, scale)
+	}
+	return n, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch v_ := v.(type) {
+	case time.Time:
+		return v_, nil
+	case string:
+		for _, layout := range timeLayouts {
+			t, err := time.Parse(layout, v_)
+			if err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, errors.Errorf("%v is not a date", v)
+}
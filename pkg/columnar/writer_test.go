@@ -0,0 +1,146 @@
+package columnar
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet/file"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const testQuery = `SELECT id, amount, created, day, ok, name, data, id * 2 AS doubled FROM t ORDER BY id`
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (
+		id INTEGER PRIMARY KEY, amount DECIMAL(13,2), created DATETIME, day DATE, ok BOOLEAN, name TEXT, data BLOB
+	)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO t VALUES
+		(1, '12345678901.23', '2023-05-01 10:11:12.123456', '2023-05-01', 1, 'a', x'0102'),
+		(2, NULL, NULL, NULL, NULL, NULL, NULL)`)
+	require.NoError(t, err)
+	return db
+}
+
+func writeTestQuery(t *testing.T, format string) []byte {
+	db := openTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, format)
+	require.NoError(t, err)
+	ctx := context.Background()
+	err = stream.RunQueryIntoGlaze(ctx, db, testQuery, nil, w)
+	require.NoError(t, err)
+	require.NoError(t, w.Close(ctx))
+	return buf.Bytes()
+}
+
+func checkRecord(t *testing.T, rec arrow.Record) {
+	schema := rec.Schema()
+	require.Equal(t, 8, len(schema.Fields()))
+	assert.Equal(t, arrow.PrimitiveTypes.Int64, schema.Field(0).Type)
+	assert.Equal(t, &arrow.Decimal128Type{Precision: 13, Scale: 2}, schema.Field(1).Type)
+	assert.Equal(t, arrow.TIMESTAMP, schema.Field(2).Type.ID())
+	assert.Equal(t, arrow.FixedWidthTypes.Date32, schema.Field(3).Type)
+	assert.Equal(t, arrow.FixedWidthTypes.Boolean, schema.Field(4).Type)
+	assert.Equal(t, arrow.BinaryTypes.String, schema.Field(5).Type)
+	assert.Equal(t, arrow.BinaryTypes.Binary, schema.Field(6).Type)
+	// expressions have no declared type in sqlite and are typed after the first value
+	assert.Equal(t, arrow.PrimitiveTypes.Int64, schema.Field(7).Type)
+
+	require.Equal(t, int64(2), rec.NumRows())
+	amount := rec.Column(1).(*array.Decimal128)
+	assert.Equal(t, "12345678901.23", amount.Value(0).ToString(2))
+	created := rec.Column(2).(*array.Timestamp)
+	assert.Equal(t, "2023-05-01 10:11:12.123456", created.Value(0).ToTime(arrow.Microsecond).Format("2006-01-02 15:04:05.999999"))
+	assert.True(t, rec.Column(4).(*array.Boolean).Value(0))
+	assert.Equal(t, []byte{1, 2}, rec.Column(6).(*array.Binary).Value(0))
+	for i := 1; i < 7; i++ {
+		assert.True(t, rec.Column(i).IsNull(1), "column %d", i)
+	}
+}
+
+func TestWriteArrow(t *testing.T) {
+	b := writeTestQuery(t, FormatArrow)
+
+	r, err := ipc.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	defer r.Release()
+	require.True(t, r.Next())
+	checkRecord(t, r.Record())
+	assert.False(t, r.Next())
+}
+
+func TestWriteParquet(t *testing.T) {
+	b := writeTestQuery(t, FormatParquet)
+
+	pf, err := file.NewParquetReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	require.NoError(t, err)
+	tbl, err := fr.ReadTable(context.Background())
+	require.NoError(t, err)
+	defer tbl.Release()
+
+	tr := array.NewTableReader(tbl, 0)
+	defer tr.Release()
+	require.True(t, tr.Next())
+	checkRecord(t, tr.Record())
+}
+
+func TestWriteEmpty(t *testing.T) {
+	db := openTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, FormatArrow)
+	require.NoError(t, err)
+	ctx := context.Background()
+	err = stream.RunQueryIntoGlaze(ctx, db, `SELECT id, amount FROM t WHERE id > 10`, nil, w)
+	require.NoError(t, err)
+	require.NoError(t, w.Close(ctx))
+
+	r, err := ipc.NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	defer r.Release()
+	assert.Equal(t, []string{"id", "amount"}, []string{r.Schema().Field(0).Name, r.Schema().Field(1).Name})
+	assert.False(t, r.Next())
+}
+
+func TestDataType(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected arrow.DataType
+	}{
+		{"BIGINT UNSIGNED", arrow.PrimitiveTypes.Uint64},
+		{"NUMERIC(40,2)", arrow.BinaryTypes.String},
+		{"NUMERIC", arrow.BinaryTypes.String},
+		{"VARCHAR(255)", arrow.BinaryTypes.String},
+		{"TIMESTAMPTZ", &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}},
+	}
+	for _, tt := range tests {
+		dt, ok := (&Column{DatabaseTypeName: tt.name}).DataType()
+		assert.True(t, ok, tt.name)
+		assert.Equal(t, tt.expected, dt, tt.name)
+	}
+
+	_, ok := (&Column{}).DataType()
+	assert.False(t, ok)
+}
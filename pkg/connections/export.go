@@ -0,0 +1,443 @@
+package connections
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportFormats lists the formats supported by Export.
+var ExportFormats = []string{
+	"mycnf",
+	"pgpass",
+	"pg-service",
+	"dbt",
+	"jdbc",
+	"sqlalchemy",
+	"dbeaver",
+	"datagrip",
+}
+
+// Export writes the connection settings of source in the given format.
+//
+// name is used for the section, service or profile name in formats that have one.
+func Export(w io.Writer, format string, name string, source *sql.Source) error {
+	if name == "" {
+		name = "sqleton"
+	}
+
+	switch format {
+	case "mycnf":
+		return exportMyCnf(w, name, source)
+	case "pgpass":
+		return exportPgPass(w, source)
+	case "pg-service":
+		return exportPgService(w, name, source)
+	case "dbt":
+		return exportDbt(w, name, source)
+	case "jdbc":
+		u, err := JdbcURL(source, true)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, u)
+		return err
+	case "sqlalchemy":
+		u, err := SqlAlchemyURL(source)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, u)
+		return err
+	case "dbeaver":
+		return exportDbeaver(w, name, source)
+	case "datagrip":
+		return exportDatagrip(w, name, source)
+	default:
+		return errors.Errorf("unknown format %s, supported formats are: %s",
+			format, strings.Join(ExportFormats, ", "))
+	}
+}
+
+func isSqlite(source *sql.Source) bool {
+	return source.Type == "sqlite" || source.Type == "sqlite3"
+}
+
+func checkType(source *sql.Source, format string, types ...string) error {
+	for _, t := range types {
+		if source.Type == t {
+			return nil
+		}
+	}
+	return errors.Errorf("%s only supports %s connections, not %s",
+		format, strings.Join(types, " and "), source.Type)
+}
+
+// myCnfQuote quotes an option value, because passwords may contain characters like # or ;
+func myCnfQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// exportMyCnf writes option groups that can be selected with `mysql --defaults-group-suffix=_NAME`.
+// The database goes into the mysql group only, as other clients like mysqldump don't accept it.
+func exportMyCnf(w io.Writer, name string, source *sql.Source) error {
+	if err := checkType(source, "mycnf", "mysql"); err != nil {
+		return err
+	}
+
+	suffix := "_" + name
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "[client%s]\n", suffix)
+	if source.Hostname != "" {
+		fmt.Fprintf(sb, "host=%s\n", source.Hostname)
+	}
+	if source.Port != 0 {
+		fmt.Fprintf(sb, "port=%d\n", source.Port)
+	}
+	if source.Username != "" {
+		fmt.Fprintf(sb, "user=%s\n", source.Username)
+	}
+	if source.Password != "" {
+		fmt.Fprintf(sb, "password=%s\n", myCnfQuote(source.Password))
+	}
+	if source.Database != "" {
+		fmt.Fprintf(sb, "\n[mysql%s]\ndatabase=%s\n", suffix, source.Database)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func pgPassEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `:`, `\:`)
+}
+
+func exportPgPass(w io.Writer, source *sql.Source) error {
+	if err := checkType(source, "pgpass", "postgres"); err != nil {
+		return err
+	}
+
+	fields := []string{source.Hostname, "*", source.Database, source.Username, source.Password}
+	if source.Port != 0 {
+		fields[1] = fmt.Sprintf("%d", source.Port)
+	}
+	for i, f := range fields[:4] {
+		if f == "" {
+			fields[i] = "*"
+		} else if f != "*" {
+			fields[i] = pgPassEscape(f)
+		}
+	}
+	fields[4] = pgPassEscape(fields[4])
+
+	_, err := fmt.Fprintln(w, strings.Join(fields, ":"))
+	return err
+}
+
+func exportPgService(w io.Writer, name string, source *sql.Source) error {
+	if err := checkType(source, "pg-service", "postgres"); err != nil {
+		return err
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "[%s]\n", name)
+	if source.Hostname != "" {
+		fmt.Fprintf(sb, "host=%s\n", source.Hostname)
+	}
+	if source.Port != 0 {
+		fmt.Fprintf(sb, "port=%d\n", source.Port)
+	}
+	if source.Database != "" {
+		fmt.Fprintf(sb, "dbname=%s\n", source.Database)
+	}
+	if source.Username != "" {
+		fmt.Fprintf(sb, "user=%s\n", source.Username)
+	}
+	if source.Password != "" {
+		fmt.Fprintf(sb, "password=%s\n", source.Password)
+	}
+	if source.Schema != "" {
+		fmt.Fprintf(sb, "options=-csearch_path=%s\n", source.Schema)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// exportDbt writes a profiles.yml block using the keys of the respective dbt adapter
+// (dbt-postgres, dbt-mysql and dbt-sqlite).
+func exportDbt(w io.Writer, name string, source *sql.Source) error {
+	output := yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value interface{}) {
+		var v yaml.Node
+		_ = v.Encode(value)
+		output.Content = append(output.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &v)
+	}
+
+	switch {
+	case source.Type == "postgres":
+		add("type", "postgres")
+		add("host", source.Hostname)
+		add("port", source.Port)
+		add("user", source.Username)
+		add("password", source.Password)
+		add("dbname", source.Database)
+		schema := source.Schema
+		if schema == "" {
+			schema = "public"
+		}
+		add("schema", schema)
+	case source.Type == "mysql":
+		// in dbt-mysql, the schema is the mysql database
+		add("type", "mysql")
+		add("server", source.Hostname)
+		add("port", source.Port)
+		add("username", source.Username)
+		add("password", source.Password)
+		add("schema", source.Database)
+	case isSqlite(source):
+		// dbt-sqlite requires a database key, but ignores its value
+		add("type", "sqlite")
+		add("database", "database")
+		add("schema", "main")
+		add("schemas_and_paths", map[string]string{"main": source.Database})
+		add("schema_directory", filepath.Dir(source.Database))
+	default:
+		return errors.Errorf("dbt export doesn't support %s connections", source.Type)
+	}
+	add("threads", 1)
+
+	// the profile name can contain a target, as in sqleton's profile.target naming
+	profile, target := name, "dev"
+	if idx := strings.LastIndex(name, "."); idx > 0 {
+		profile, target = name[:idx], name[idx+1:]
+	}
+
+	doc := map[string]interface{}{
+		profile: map[string]interface{}{
+			"target": target,
+			"outputs": map[string]interface{}{
+				target: &output,
+			},
+		},
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err := encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// JdbcURL returns the JDBC URL for source. The password is only included if withPassword is set.
+func JdbcURL(source *sql.Source, withPassword bool) (string, error) {
+	if isSqlite(source) {
+		return "jdbc:sqlite:" + source.Database, nil
+	}
+
+	var scheme string
+	switch source.Type {
+	case "mysql":
+		scheme = "mysql"
+	case "postgres":
+		scheme = "postgresql"
+	default:
+		return "", errors.Errorf("JDBC URLs are not supported for %s connections", source.Type)
+	}
+
+	host := source.Hostname
+	if source.Port != 0 {
+		host = fmt.Sprintf("%s:%d", host, source.Port)
+	}
+
+	values := url.Values{}
+	if source.Username != "" {
+		values.Set("user", source.Username)
+	}
+	if withPassword && source.Password != "" {
+		values.Set("password", source.Password)
+	}
+	if source.Type == "postgres" && source.Schema != "" {
+		values.Set("currentSchema", source.Schema)
+	}
+
+	u := fmt.Sprintf("jdbc:%s://%s/%s", scheme, host, url.PathEscape(source.Database))
+	if len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	return u, nil
+}
+
+// SqlAlchemyURL returns the SQLAlchemy database URL for source,
+// using the pymysql and psycopg2 drivers.
+func SqlAlchemyURL(source *sql.Source) (string, error) {
+	if isSqlite(source) {
+		// sqlite:/// followed by the path, which makes four slashes for absolute paths
+		return "sqlite:///" + source.Database, nil
+	}
+
+	u := &url.URL{}
+	switch source.Type {
+	case "mysql":
+		u.Scheme = "mysql+pymysql"
+	case "postgres":
+		u.Scheme = "postgresql+psycopg2"
+	default:
+		return "", errors.Errorf("SQLAlchemy URLs are not supported for %s connections", source.Type)
+	}
+
+	if source.Password != "" {
+		u.User = url.UserPassword(source.Username, source.Password)
+	} else if source.Username != "" {
+		u.User = url.User(source.Username)
+	}
+	u.Host = source.Hostname
+	if source.Port != 0 {
+		u.Host = fmt.Sprintf("%s:%d", source.Hostname, source.Port)
+	}
+	u.Path = "/" + source.Database
+	if source.Type == "postgres" && source.Schema != "" {
+		u.RawQuery = url.Values{"options": []string{"-csearch_path=" + source.Schema}}.Encode()
+	}
+
+	return u.String(), nil
+}
+
+func jdbcDriver(source *sql.Source) (string, string) {
+	switch {
+	case source.Type == "mysql":
+		return "mysql", "com.mysql.cj.jdbc.Driver"
+	case source.Type == "postgres":
+		return "postgresql", "org.postgresql.Driver"
+	case isSqlite(source):
+		return "sqlite", "org.sqlite.JDBC"
+	default:
+		return "", ""
+	}
+}
+
+type dbeaverConnection struct {
+	Host     string `xml:"host,attr,omitempty"`
+	Port     string `xml:"port,attr,omitempty"`
+	Database string `xml:"database,attr,omitempty"`
+	URL      string `xml:"url,attr"`
+	User     string `xml:"user,attr,omitempty"`
+	Password string `xml:"password,attr,omitempty"`
+	Type     string `xml:"type,attr"`
+}
+
+type dbeaverDataSource struct {
+	XMLName      xml.Name          `xml:"data-source"`
+	ID           string            `xml:"id,attr"`
+	Provider     string            `xml:"provider,attr"`
+	Driver       string            `xml:"driver,attr"`
+	Name         string            `xml:"name,attr"`
+	SavePassword bool              `xml:"save-password,attr"`
+	Connection   dbeaverConnection `xml:"connection"`
+}
+
+// exportDbeaver writes a data-source element for DBeaver's data-sources.xml.
+func exportDbeaver(w io.Writer, name string, source *sql.Source) error {
+	var provider, driver string
+	switch {
+	case source.Type == "mysql":
+		provider, driver = "mysql", "mysql8"
+	case source.Type == "postgres":
+		provider, driver = "postgresql", "postgres-jdbc"
+	case isSqlite(source):
+		provider, driver = "generic", "sqlite_jdbc"
+	default:
+		return errors.Errorf("dbeaver export doesn't support %s connections", source.Type)
+	}
+
+	jdbcURL, err := JdbcURL(source, false)
+	if err != nil {
+		return err
+	}
+
+	ds := dbeaverDataSource{
+		ID:           fmt.Sprintf("%s-%s", provider, uuid.NewString()),
+		Provider:     provider,
+		Driver:       driver,
+		Name:         name,
+		SavePassword: source.Password != "",
+		Connection: dbeaverConnection{
+			Host:     source.Hostname,
+			Database: source.Database,
+			URL:      jdbcURL,
+			User:     source.Username,
+			Password: source.Password,
+			Type:     "dev",
+		},
+	}
+	if source.Port != 0 {
+		ds.Connection.Port = fmt.Sprintf("%d", source.Port)
+	}
+
+	return writeXML(w, ds)
+}
+
+type datagripDataSource struct {
+	XMLName     xml.Name `xml:"data-source"`
+	Source      string   `xml:"source,attr"`
+	Name        string   `xml:"name,attr"`
+	UUID        string   `xml:"uuid,attr"`
+	DriverRef   string   `xml:"driver-ref"`
+	Synchronize bool     `xml:"synchronize"`
+	JdbcDriver  string   `xml:"jdbc-driver"`
+	JdbcURL     string   `xml:"jdbc-url"`
+	WorkingDir  string   `xml:"working-dir"`
+	UserName    string   `xml:"user-name,omitempty"`
+}
+
+// exportDatagrip writes a data-source element for DataGrip's .idea/dataSources.xml.
+// DataGrip keeps passwords in its own credential store, so the password is not exported.
+func exportDatagrip(w io.Writer, name string, source *sql.Source) error {
+	driverRef, jdbcDriverClass := jdbcDriver(source)
+	if driverRef == "" {
+		return errors.Errorf("datagrip export doesn't support %s connections", source.Type)
+	}
+
+	jdbcURL, err := JdbcURL(source, false)
+	if err != nil {
+		return err
+	}
+
+	ds := datagripDataSource{
+		Source:      "LOCAL",
+		Name:        name,
+		UUID:        uuid.NewString(),
+		DriverRef:   driverRef,
+		Synchronize: true,
+		JdbcDriver:  jdbcDriverClass,
+		JdbcURL:     jdbcURL,
+		WorkingDir:  "$ProjectFileDir$",
+		UserName:    source.Username,
+	}
+
+	return writeXML(w, ds)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
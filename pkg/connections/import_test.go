@@ -0,0 +1,165 @@
+package connections
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestImportMyCnf(t *testing.T) {
+	path := writeFile(t, t.TempDir(), ".my.cnf", `
+[client]
+user=root
+password="se#cr\"et"
+
+[client_prod]
+host=prod.db
+port=3307
+[mysql_prod]
+database=shop
+
+[mysqld]
+datadir=/var/lib/mysql
+`)
+	imported, err := ImportFile(path, "")
+	require.NoError(t, err)
+	require.Len(t, imported, 3)
+
+	assert.NotEmpty(t, imported[0].SkipReason)
+
+	assert.Equal(t, "mysql", imported[1].Source.Name)
+	assert.Equal(t, `se#cr"et`, imported[1].Source.Password)
+	assert.Equal(t, "localhost", imported[1].Source.Hostname)
+
+	assert.Equal(t, "prod", imported[2].Source.Name)
+	assert.Equal(t, 3307, imported[2].Source.Port)
+	assert.Equal(t, "shop", imported[2].Source.Database)
+}
+
+func TestImportPgPass(t *testing.T) {
+	path := writeFile(t, t.TempDir(), ".pgpass", "db.local:*:app:bob:p\\:ss\n*:*:*:postgres:x\n")
+	imported, err := ImportFile(path, "")
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+
+	assert.Equal(t, "app", imported[0].Source.Name)
+	assert.Equal(t, 5432, imported[0].Source.Port)
+	assert.Equal(t, "p:ss", imported[0].Source.Password)
+	assert.Empty(t, imported[0].SkipReason)
+	assert.NotEmpty(t, imported[1].SkipReason)
+}
+
+func TestImportPgPassSameDatabase(t *testing.T) {
+	path := writeFile(t, t.TempDir(), ".pgpass",
+		"db1.local:*:app:bob:x\ndb2.local:*:app:bob:y\ndb2.local:6432:app:bob:z\n")
+	imported, err := ImportFile(path, "")
+	require.NoError(t, err)
+	require.Len(t, imported, 3)
+
+	assert.Equal(t, "app", imported[0].Source.Name)
+	assert.Equal(t, "app_db2.local", imported[1].Source.Name)
+	assert.Equal(t, "app_2", imported[2].Source.Name)
+
+	// names stay unique when merging the connections of several files
+	other := []*Imported{{Source: &sql.Source{Name: "app", Hostname: "db3.local"}}}
+	merged := append(imported, other...)
+	DisambiguateNames(merged)
+	assert.Equal(t, "app", merged[0].Source.Name)
+	assert.Equal(t, "app_db3.local", merged[3].Source.Name)
+}
+
+func TestImportEnvAndCompose(t *testing.T) {
+	dir := t.TempDir()
+	env := writeFile(t, dir, "myapp/.env", "DATABASE_URL=postgres://u:p@localhost:5433/myapp\nOTHER=1\n")
+	imported, err := ImportFile(env, "")
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+	assert.Equal(t, "myapp", imported[0].Source.Name)
+	assert.Equal(t, 5433, imported[0].Source.Port)
+
+	compose := writeFile(t, dir, "myapp/docker-compose.yml", `
+services:
+  db:
+    image: mysql:8
+    environment:
+      MYSQL_ROOT_PASSWORD: rootpw
+      MYSQL_DATABASE: ttc
+    ports:
+      - "3336:3306"
+  web:
+    image: nginx
+`)
+	imported, err = ImportFile(compose, "")
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+	assert.Equal(t, &sql.Source{
+		Name: "db", Type: "mysql", Hostname: "localhost", Port: 3336,
+		Username: "root", Password: "rootpw", Database: "ttc",
+	}, imported[0].Source)
+	assert.NotEmpty(t, imported[1].SkipReason)
+}
+
+func TestParseDatabaseURL(t *testing.T) {
+	s, err := ParseDatabaseURL("mysql+pymysql://a:b%40c@h/db")
+	require.NoError(t, err)
+	assert.Equal(t, "mysql", s.Type)
+	assert.Equal(t, 3306, s.Port)
+	assert.Equal(t, "b@c", s.Password)
+
+	s, err = ParseDatabaseURL("sqlite:////tmp/test.db")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/test.db", s.Database)
+
+	_, err = ParseDatabaseURL("redis://localhost")
+	assert.Error(t, err)
+}
+
+func TestConfigConnectionsRoundTrip(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.yaml", "repositories:\n  - /tmp/queries # local queries\n")
+
+	err := SaveConfigConnections(path, map[string]*sql.Source{
+		"prod": {Type: "mysql", Hostname: "prod.db", Port: 3306, Username: "app"},
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# local queries")
+
+	connections, err := LoadConfigConnections(path)
+	require.NoError(t, err)
+	require.Contains(t, connections, "prod")
+	assert.Equal(t, "prod", connections["prod"].Name)
+	assert.Equal(t, "prod.db", connections["prod"].Hostname)
+}
+
+func TestSaveConfigConnectionsRestrictsMode(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.yaml", "repositories: []\n")
+	require.NoError(t, os.Chmod(path, 0644))
+
+	err := SaveConfigConnections(path, map[string]*sql.Source{
+		"prod": {Type: "mysql", Hostname: "prod.db", Username: "app", Password: "secret"},
+	})
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
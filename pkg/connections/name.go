@@ -0,0 +1,50 @@
+package connections
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+)
+
+// NameFromParsedLayers returns the Name of the connection configured by the connection flags,
+// or an empty string if they can't be parsed.
+func NameFromParsedLayers(parsedLayers map[string]*layers.ParsedParameterLayer) string {
+	layers_ := make([]*layers.ParsedParameterLayer, 0, len(parsedLayers))
+	for _, l := range parsedLayers {
+		layers_ = append(layers_, l)
+	}
+	config, err := sql.NewConfigFromParsedLayers(layers_...)
+	if err != nil {
+		return ""
+	}
+	return Name(config)
+}
+
+// Name describes the connection of config, without its password, for example in the history.
+func Name(config *sql.DatabaseConfig) string {
+	switch {
+	case config.UseDbtProfiles && config.DbtProfile != "":
+		return config.DbtProfile
+	case config.DSN != "":
+		return fmt.Sprintf("%s:%s", config.Driver, RedactDSN(config.DSN))
+	case config.Type == "sqlite" || config.Type == "sqlite3":
+		return fmt.Sprintf("sqlite:%s", config.Database)
+	default:
+		return fmt.Sprintf("%s://%s@%s:%d/%s", config.Type, config.User, config.Host, config.Port, config.Database)
+	}
+}
+
+var mysqlPasswordRegexp = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+var keywordPasswordRegexp = regexp.MustCompile(`password=\S*`)
+
+// RedactDSN replaces the password in dsn, a URL or a mysql or postgres connection string, with xxxxx.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	dsn = mysqlPasswordRegexp.ReplaceAllString(dsn, "${1}:xxxxx@")
+	return keywordPasswordRegexp.ReplaceAllString(dsn, "password=xxxxx")
+}
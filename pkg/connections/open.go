@@ -0,0 +1,51 @@
+package connections
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Driver returns the database/sql driver name to use for the source.
+func Driver(source *sql.Source) string {
+	if source.Type == "sqlite" {
+		return "sqlite3"
+	}
+	return source.Type
+}
+
+// Open connects to the source and pings it.
+func Open(ctx context.Context, source *sql.Source) (*sqlx.DB, error) {
+	db, err := sqlx.ConnectContext(ctx, Driver(source), source.ToConnectionString())
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not connect to %s", source.Name)
+	}
+	return db, nil
+}
+
+// IsDatabaseURL returns true if s looks like a database URL rather than a connection name.
+func IsDatabaseURL(s string) bool {
+	return strings.Contains(s, "://") || strings.HasPrefix(s, "sqlite:") || strings.HasPrefix(s, "file:")
+}
+
+// ResolveOne returns the source for a single connection, given either as a database URL
+// or as the name of a connection, looked up as in Resolve.
+func ResolveOne(nameOrURL string, configPath string, dbtProfilesPath string) (*sql.Source, error) {
+	if IsDatabaseURL(nameOrURL) {
+		source, err := ParseDatabaseURL(nameOrURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse database URL")
+		}
+		source.Name = source.Type
+		return source, nil
+	}
+
+	sources, err := Resolve([]string{nameOrURL}, false, "", configPath, dbtProfilesPath)
+	if err != nil {
+		return nil, err
+	}
+	return sources[0], nil
+}
@@ -0,0 +1,102 @@
+package connections
+
+import (
+	"path"
+	"sort"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// ConfigPath returns the path of the config file sqleton was started with,
+// or the default config path if none was found.
+func ConfigPath() string {
+	if f := viper.ConfigFileUsed(); f != "" {
+		return f
+	}
+	return DefaultConfigPath()
+}
+
+// Resolve returns the sources for the given connection names, looked up first in the named
+// connections of the config file at configPath, then in the dbt profiles file at dbtProfilesPath.
+//
+// If all is set, every dbt profile is returned in addition to the named ones.
+// If glob is not empty, every named connection and dbt profile matching it is returned
+// (in the same way as with all, but filtered).
+// Sources are returned in the order they were named, followed by the matching ones sorted by name.
+func Resolve(names []string, all bool, glob string, configPath string, dbtProfilesPath string) ([]*sql.Source, error) {
+	configured, err := LoadConfigConnections(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dbtSources := map[string]*sql.Source{}
+	needsDbt := all || glob != ""
+	for _, name := range names {
+		if _, ok := configured[name]; !ok {
+			needsDbt = true
+		}
+	}
+	if needsDbt {
+		sources, err := sql.ParseDbtProfiles(dbtProfilesPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read dbt profiles")
+		}
+		for _, s := range sources {
+			dbtSources[s.Name] = s
+		}
+	}
+
+	var ret []*sql.Source
+	seen := map[string]bool{}
+	add := func(s *sql.Source) {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			ret = append(ret, s)
+		}
+	}
+
+	for _, name := range names {
+		if s, ok := configured[name]; ok {
+			add(s)
+		} else if s, ok := dbtSources[name]; ok {
+			add(s)
+		} else {
+			return nil, errors.Errorf("unknown connection %s", name)
+		}
+	}
+
+	var candidates []*sql.Source
+	if glob != "" {
+		for _, s := range configured {
+			candidates = append(candidates, s)
+		}
+	}
+	if all || glob != "" {
+		for _, s := range dbtSources {
+			candidates = append(candidates, s)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	for _, s := range candidates {
+		if glob != "" {
+			ok, err := path.Match(glob, s.Name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid profile glob %s", glob)
+			}
+			if !ok {
+				continue
+			}
+		}
+		add(s)
+	}
+
+	if len(ret) == 0 {
+		return nil, errors.New("no connection matched")
+	}
+
+	return ret, nil
+}
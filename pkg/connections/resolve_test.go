@@ -0,0 +1,59 @@
+package connections
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sourceNames(sources []*sql.Source) []string {
+	var ret []string
+	for _, s := range sources {
+		ret = append(ret, s.Name)
+	}
+	return ret
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeFile(t, dir, "config.yaml", `
+connections:
+  local:
+    type: sqlite
+    database: /tmp/local.db
+`)
+	dbtPath := writeFile(t, dir, "profiles.yml", `
+shop:
+  target: eu
+  outputs:
+    eu:
+      type: mysql
+      server: eu.db
+    us:
+      type: mysql
+      server: us.db
+analytics:
+  target: prod
+  outputs:
+    prod:
+      type: postgres
+      server: pg.db
+`)
+
+	sources, err := Resolve([]string{"local", "analytics.prod"}, false, "", configPath, dbtPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"local", "analytics.prod"}, sourceNames(sources))
+
+	sources, err = Resolve(nil, true, "shop.*", configPath, dbtPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop.eu", "shop.us"}, sourceNames(sources))
+
+	sources, err = Resolve([]string{"shop.us"}, true, "", configPath, dbtPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop.us", "analytics.prod", "shop.eu"}, sourceNames(sources))
+
+	_, err = Resolve([]string{"missing"}, false, "", configPath, dbtPath)
+	assert.Error(t, err)
+}
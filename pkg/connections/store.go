@@ -0,0 +1,195 @@
+package connections
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigKey is the key under which named connections are stored in the sqleton config file.
+const ConfigKey = "connections"
+
+// configConnection uses the same keys as the dbt profiles parsed into sql.Source.
+type configConnection struct {
+	Type     string `yaml:"type"`
+	Hostname string `yaml:"server,omitempty"`
+	Port     int    `yaml:"port,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Schema   string `yaml:"schema,omitempty"`
+	Database string `yaml:"database,omitempty"`
+}
+
+// DefaultConfigPath returns the path of the config file sqleton reads by default.
+func DefaultConfigPath() string {
+	return os.ExpandEnv("$HOME/.sqleton/config.yaml")
+}
+
+func readConfig(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			data = nil
+		} else {
+			return nil, err
+		}
+	}
+
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", path)
+	}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.Errorf("%s is not a YAML mapping", path)
+	}
+
+	return doc, nil
+}
+
+// LoadConfigConnections returns the named connections stored in the config file at path.
+// A missing file results in no connections.
+func LoadConfigConnections(path string) (map[string]*sql.Source, error) {
+	doc, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]*sql.Source{}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != ConfigKey {
+			continue
+		}
+		connections := map[string]*sql.Source{}
+		err = root.Content[i+1].Decode(&connections)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse %s in %s", ConfigKey, path)
+		}
+		for name, s := range connections {
+			if s == nil {
+				continue
+			}
+			s.Name = name
+			ret[name] = s
+		}
+	}
+
+	return ret, nil
+}
+
+// SaveConfigConnections replaces the named connections in the config file at path,
+// leaving the rest of the file untouched. The file is created if it doesn't exist.
+// As it contains passwords, it is only readable by the current user: the content is written
+// to a new file, created with mode 0600, that then replaces the config file, so that an existing
+// file readable by others doesn't keep its mode.
+func SaveConfigConnections(path string, connections map[string]*sql.Source) error {
+	doc, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	stored := map[string]*configConnection{}
+	for name, s := range connections {
+		stored[name] = &configConnection{
+			Type:     s.Type,
+			Hostname: s.Hostname,
+			Port:     s.Port,
+			Username: s.Username,
+			Password: s.Password,
+			Schema:   s.Schema,
+			Database: s.Database,
+		}
+	}
+	value := &yaml.Node{}
+	err = value.Encode(stored)
+	if err != nil {
+		return err
+	}
+
+	root := doc.Content[0]
+	found := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == ConfigKey {
+			root.Content[i+1] = value
+			found = true
+			break
+		}
+	}
+	if !found {
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: ConfigKey},
+			value,
+		)
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return err
+	}
+
+	// a symlinked config file is replaced where it points to, keeping the link
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file with mode 0600
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	_, err = f.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// SameSource returns true if both sources point to the same database with the same credentials.
+func SameSource(a, b *sql.Source) bool {
+	return a.Type == b.Type &&
+		a.Hostname == b.Hostname &&
+		a.Port == b.Port &&
+		a.Username == b.Username &&
+		a.Password == b.Password &&
+		a.Schema == b.Schema &&
+		a.Database == b.Database
+}
+
+// SortedNames returns the names of the connections in alphabetical order.
+func SortedNames(connections map[string]*sql.Source) []string {
+	names := make([]string, 0, len(connections))
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,126 @@
+package diff
+
+import (
+	"fmt"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"reflect"
+	"strings"
+)
+
+type ChangeType string
+
+const (
+	ChangeTypeAdded   ChangeType = "added"
+	ChangeTypeRemoved ChangeType = "removed"
+	ChangeTypeChanged ChangeType = "changed"
+)
+
+// RowChange describes how a single row (identified by its key) differs between two result sets.
+// Before is nil for added rows, After is nil for removed rows.
+type RowChange struct {
+	Type   ChangeType
+	Key    string
+	Before types.Row
+	After  types.Row
+}
+
+// ChangedFields returns the names of the fields whose values differ between Before and After,
+// in the order of After (followed by the fields that only exist in Before).
+func (c *RowChange) ChangedFields() []string {
+	if c.Before == nil || c.After == nil {
+		return nil
+	}
+
+	ret := []string{}
+	for pair := c.After.Oldest(); pair != nil; pair = pair.Next() {
+		before, ok := c.Before.Get(pair.Key)
+		if !ok || !valuesEqual(before, pair.Value) {
+			ret = append(ret, pair.Key)
+		}
+	}
+	for pair := c.Before.Oldest(); pair != nil; pair = pair.Next() {
+		if _, ok := c.After.Get(pair.Key); !ok {
+			ret = append(ret, pair.Key)
+		}
+	}
+	return ret
+}
+
+// RowKey computes the identity of row out of the given key columns.
+// If no key columns are given, the whole row is used as key.
+func RowKey(row types.Row, keys []string) string {
+	parts := []string{}
+	if len(keys) == 0 {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			parts = append(parts, fmt.Sprintf("%s=%v", pair.Key, pair.Value))
+		}
+	} else {
+		for _, k := range keys {
+			v, _ := row.Get(k)
+			parts = append(parts, fmt.Sprintf("%v", v))
+		}
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	// drivers are not consistent about the types they return for the same column (int64 vs []byte vs string)
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+func rowsEqual(a, b types.Row) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for pair := a.Oldest(); pair != nil; pair = pair.Next() {
+		v, ok := b.Get(pair.Key)
+		if !ok || !valuesEqual(pair.Value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rows matches the rows of before and after by their key columns and returns the list
+// of added, removed and changed rows. Added and changed rows are returned in the order of after,
+// followed by the removed rows in the order of before.
+//
+// Keys are expected to be unique, rows sharing the same key are collapsed into one.
+func Rows(before []types.Row, after []types.Row, keys []string) []*RowChange {
+	beforeByKey := map[string]types.Row{}
+	for _, row := range before {
+		beforeByKey[RowKey(row, keys)] = row
+	}
+
+	ret := []*RowChange{}
+	seen := map[string]bool{}
+	for _, row := range after {
+		key := RowKey(row, keys)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		previous, ok := beforeByKey[key]
+		if !ok {
+			ret = append(ret, &RowChange{Type: ChangeTypeAdded, Key: key, After: row})
+		} else if !rowsEqual(previous, row) {
+			ret = append(ret, &RowChange{Type: ChangeTypeChanged, Key: key, Before: previous, After: row})
+		}
+	}
+
+	removed := map[string]bool{}
+	for _, row := range before {
+		key := RowKey(row, keys)
+		if seen[key] || removed[key] {
+			continue
+		}
+		removed[key] = true
+		ret = append(ret, &RowChange{Type: ChangeTypeRemoved, Key: key, Before: beforeByKey[key]})
+	}
+
+	return ret
+}
@@ -0,0 +1,50 @@
+package diff
+
+import (
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func row(id int64, name string) types.Row {
+	return types.NewRow(types.MRP("id", id), types.MRP("name", name))
+}
+
+func TestRowsByKey(t *testing.T) {
+	before := []types.Row{row(1, "a"), row(2, "b"), row(3, "c")}
+	after := []types.Row{row(1, "a"), row(3, "cc"), row(4, "d")}
+
+	changes := Rows(before, after, []string{"id"})
+	require.Len(t, changes, 3)
+
+	assert.Equal(t, ChangeTypeChanged, changes[0].Type)
+	assert.Equal(t, []string{"name"}, changes[0].ChangedFields())
+	v, _ := changes[0].Before.Get("name")
+	assert.Equal(t, "c", v)
+
+	assert.Equal(t, ChangeTypeAdded, changes[1].Type)
+	assert.Nil(t, changes[1].Before)
+
+	assert.Equal(t, ChangeTypeRemoved, changes[2].Type)
+	v, _ = changes[2].Before.Get("id")
+	assert.Equal(t, int64(2), v)
+}
+
+func TestRowsWithoutKeys(t *testing.T) {
+	before := []types.Row{row(1, "a"), row(2, "b")}
+	after := []types.Row{row(1, "a"), row(2, "bb")}
+
+	// without keys, a modified row shows up as a removal and an addition
+	changes := Rows(before, after, nil)
+	require.Len(t, changes, 2)
+	assert.Equal(t, ChangeTypeAdded, changes[0].Type)
+	assert.Equal(t, ChangeTypeRemoved, changes[1].Type)
+}
+
+func TestRowsCompareAcrossDriverTypes(t *testing.T) {
+	before := []types.Row{types.NewRow(types.MRP("id", int64(1)), types.MRP("n", "10"))}
+	after := []types.Row{types.NewRow(types.MRP("id", int64(1)), types.MRP("n", int64(10)))}
+
+	assert.Empty(t, Rows(before, after, []string{"id"}))
+}
@@ -0,0 +1,75 @@
+package dump
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	_, err := ReadManifest(dir)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	m := &Manifest{
+		Table:     "posts",
+		Format:    "csv",
+		ChunkSize: 10,
+		Keys:      []string{"id"},
+		StartedAt: time.Now(),
+	}
+	assert.Equal(t, "", m.Cursor())
+	assert.Equal(t, "posts-000002.csv", m.ChunkFile(2))
+
+	m.Chunks = append(m.Chunks, &Chunk{Index: 0, Rows: 10, Cursor: "abc"})
+	require.NoError(t, m.Write(dir))
+
+	m2, err := ReadManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", m2.Cursor())
+	assert.Equal(t, 10, m2.Rows())
+	assert.False(t, m2.Complete())
+
+	assert.NoError(t, m2.CheckResume(m))
+	other := *m
+	other.Keys = []string{"id", "created"}
+	assert.Error(t, m2.CheckResume(&other))
+}
+
+func TestChunkWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posts-000000.csv")
+	w, err := NewChunkWriter(path, "csv", []string{"id"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, w.AddRow(ctx, types.NewRow(types.MRP("id", i), types.MRP("title", "post"))))
+	}
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, w.Close(ctx))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "id,title\n1,post\n2,post\n3,post\n", string(data))
+	sum := sha256.Sum256(data)
+	assert.Equal(t, hex.EncodeToString(sum[:]), w.SHA256())
+	assert.Equal(t, 3, w.Rows)
+	assert.Equal(t, []interface{}{1}, w.First())
+	assert.Equal(t, []interface{}{3}, w.Last())
+
+	w, err = NewChunkWriter(path+"2", "csv", []string{"missing"})
+	require.NoError(t, err)
+	assert.Error(t, w.AddRow(ctx, types.NewRow(types.MRP("id", 1))))
+	w.Abort()
+	_, err = os.Stat(path + "2.tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
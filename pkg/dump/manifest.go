@@ -0,0 +1,118 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestFile is the name of the manifest in the output directory of a dump.
+const ManifestFile = "manifest.json"
+
+// Manifest records the chunks written by a dump, so that an interrupted dump can be resumed
+// after the last complete chunk.
+type Manifest struct {
+	Table       string     `json:"table"`
+	Format      string     `json:"format"`
+	ChunkSize   int        `json:"chunk_size"`
+	Keys        []string   `json:"keys"`
+	Columns     []string   `json:"columns,omitempty"`
+	Where       string     `json:"where,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Chunks      []*Chunk   `json:"chunks"`
+}
+
+// Chunk is a file of the dump, holding the rows with keys between From and To included.
+type Chunk struct {
+	Index  int           `json:"index"`
+	File   string        `json:"file"`
+	From   []interface{} `json:"from"`
+	To     []interface{} `json:"to"`
+	Rows   int           `json:"rows"`
+	SHA256 string        `json:"sha256"`
+	// Cursor points after the last row of the chunk, see pagination.Pagination
+	Cursor string `json:"cursor"`
+}
+
+func (m *Manifest) Complete() bool {
+	return m.CompletedAt != nil
+}
+
+// Cursor returns the cursor after the last chunk, empty if there are no chunks yet.
+func (m *Manifest) Cursor() string {
+	if len(m.Chunks) == 0 {
+		return ""
+	}
+	return m.Chunks[len(m.Chunks)-1].Cursor
+}
+
+// Rows returns the number of rows of all the chunks.
+func (m *Manifest) Rows() int {
+	ret := 0
+	for _, c := range m.Chunks {
+		ret += c.Rows
+	}
+	return ret
+}
+
+// CheckResume returns an error if a dump with the settings of other can't be resumed from m.
+func (m *Manifest) CheckResume(other *Manifest) error {
+	mismatch := func(name string, a, b interface{}) error {
+		return errors.Errorf("can't resume a dump with %s %v, the manifest has %v", name, b, a)
+	}
+	switch {
+	case m.Table != other.Table:
+		return mismatch("table", m.Table, other.Table)
+	case m.Format != other.Format:
+		return mismatch("format", m.Format, other.Format)
+	case m.ChunkSize != other.ChunkSize:
+		return mismatch("chunk size", m.ChunkSize, other.ChunkSize)
+	case strings.Join(m.Keys, ",") != strings.Join(other.Keys, ","):
+		return mismatch("keys", m.Keys, other.Keys)
+	case strings.Join(m.Columns, ",") != strings.Join(other.Columns, ","):
+		return mismatch("columns", m.Columns, other.Columns)
+	case m.Where != other.Where:
+		return mismatch("where", m.Where, other.Where)
+	}
+	return nil
+}
+
+// ChunkFile returns the name of the file of the chunk with the given index.
+func (m *Manifest) ChunkFile(index int) string {
+	return fmt.Sprintf("%s-%06d.%s", m.Table, index, Extension(m.Format))
+}
+
+// ReadManifest reads the manifest of the dump in dir.
+// The error satisfies errors.Is(err, os.ErrNotExist) if there is none.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	ret := &Manifest{}
+	err = json.Unmarshal(data, ret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", filepath.Join(dir, ManifestFile))
+	}
+	return ret, nil
+}
+
+// Write atomically replaces the manifest of the dump in dir.
+func (m *Manifest) Write(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, ManifestFile)
+	err = os.WriteFile(path+".tmp", append(data, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
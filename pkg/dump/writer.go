@@ -0,0 +1,188 @@
+package dump
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/formatters"
+	"github.com/go-go-golems/glazed/pkg/formatters/csv"
+	"github.com/go-go-golems/glazed/pkg/formatters/json"
+	"github.com/go-go-golems/glazed/pkg/formatters/yaml"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/columnar"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/pkg/errors"
+)
+
+// Formats lists the formats chunks can be written in.
+var Formats = []string{"csv", "tsv", "json", "yaml", columnar.FormatParquet, columnar.FormatArrow}
+
+// Extension returns the file extension of the format.
+func Extension(format string) string {
+	return format
+}
+
+// newProcessor returns a processor writing rows to w with the glazed output formatter of format.
+// Row formatters write the rows as they come, the others once the processor is closed.
+// Parquet and arrow chunks are typed after the column types of the result.
+func newProcessor(format string, w io.Writer) (middlewares.Processor, error) {
+	var of formatters.OutputFormatter
+	switch format {
+	case columnar.FormatParquet, columnar.FormatArrow:
+		return columnar.NewWriter(w, format)
+	case "csv":
+		of = csv.NewCSVOutputFormatter()
+	case "tsv":
+		of = csv.NewTSVOutputFormatter()
+	case "json":
+		of = json.NewOutputFormatter()
+	case "yaml":
+		of = yaml.NewOutputFormatter()
+	default:
+		return nil, errors.Errorf("unknown format %s, use one of %s", format, strings.Join(Formats, ", "))
+	}
+
+	gp := middlewares.NewTableProcessor()
+	switch of_ := of.(type) {
+	case formatters.RowOutputFormatter:
+		err := of_.RegisterRowMiddlewares(gp)
+		if err != nil {
+			return nil, err
+		}
+		gp.AddRowMiddleware(row.NewOutputMiddleware(of_, w))
+	case formatters.TableOutputFormatter:
+		err := of_.RegisterTableMiddlewares(gp)
+		if err != nil {
+			return nil, err
+		}
+		gp.AddTableMiddleware(table.NewOutputMiddleware(of_, w))
+	}
+	return gp, nil
+}
+
+// ChunkWriter writes the rows of a chunk into a file, keeping track of the number of rows,
+// the keys of the first and last row and the checksum of the file.
+//
+// The rows are written to a temporary file, which is renamed once the writer is closed,
+// so that a chunk file is always complete.
+type ChunkWriter struct {
+	path string
+	keys []string
+	file *os.File
+	hash hash.Hash
+	gp   middlewares.Processor
+
+	Rows  int
+	first types.Row
+	last  types.Row
+}
+
+var _ middlewares.Processor = (*ChunkWriter)(nil)
+
+func NewChunkWriter(path string, format string, keys []string) (*ChunkWriter, error) {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	ret := &ChunkWriter{
+		path: path,
+		keys: keys,
+		file: f,
+		hash: sha256.New(),
+	}
+	ret.gp, err = newProcessor(format, io.MultiWriter(f, ret.hash))
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (w *ChunkWriter) AddRow(ctx context.Context, row types.Row) error {
+	// the formatters might modify the row, so we keep a copy of the keys
+	keys := types.NewRow()
+	for _, k := range w.keys {
+		v, ok := row.Get(k)
+		if !ok {
+			return errors.Errorf("key %s is not a column of the result", k)
+		}
+		keys.Set(k, v)
+	}
+	if w.first == nil {
+		w.first = keys
+	}
+	w.last = keys
+	w.Rows++
+
+	return w.gp.AddRow(ctx, row)
+}
+
+func (w *ChunkWriter) SetColumnTypes(columnTypes []*sql.ColumnType) error {
+	if cts, ok := w.gp.(stream.ColumnTypesSetter); ok {
+		return cts.SetColumnTypes(columnTypes)
+	}
+	return nil
+}
+
+// Close writes the end of the file and moves it into place.
+func (w *ChunkWriter) Close(ctx context.Context) error {
+	err := w.gp.Close(ctx)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if err2 := w.file.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(w.file.Name())
+		return err
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// Abort removes the temporary file.
+func (w *ChunkWriter) Abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+// SHA256 returns the hex encoded checksum of the file, once closed.
+func (w *ChunkWriter) SHA256() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// First returns the key values of the first row.
+func (w *ChunkWriter) First() []interface{} {
+	return values(w.first)
+}
+
+// Last returns the key values of the last row.
+func (w *ChunkWriter) Last() []interface{} {
+	return values(w.last)
+}
+
+// LastRow returns the keys of the last row, as a row.
+func (w *ChunkWriter) LastRow() types.Row {
+	return w.last
+}
+
+func values(row types.Row) []interface{} {
+	ret := []interface{}{}
+	if row == nil {
+		return ret
+	}
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		ret = append(ret, pair.Value)
+	}
+	return ret
+}
@@ -0,0 +1,54 @@
+package flags
+
+import (
+	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"time"
+)
+
+//go:embed "cache.yaml"
+var cacheFlagsYaml []byte
+
+type CacheSettings struct {
+	Cache    bool   `glazed.parameter:"cache"`
+	CacheTTL string `glazed.parameter:"cache-ttl"`
+	NoCache  bool   `glazed.parameter:"no-cache"`
+
+	// TTL is the parsed value of CacheTTL, 0 if not set
+	TTL time.Duration
+}
+
+func NewCacheParameterLayer(
+	options ...layers.ParameterLayerOptions,
+) (*layers.ParameterLayerImpl, error) {
+	ret, err := layers.NewParameterLayerFromYAML(cacheFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize cache parameter layer")
+	}
+	return ret, nil
+}
+
+func NewCacheSettingsFromParameters(ps map[string]interface{}) (*CacheSettings, error) {
+	s := &CacheSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize cache settings")
+	}
+
+	if s.Cache && s.NoCache {
+		return nil, errors.New("--cache and --no-cache can't be used together")
+	}
+	if s.CacheTTL != "" {
+		s.TTL, err = time.ParseDuration(s.CacheTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid cache ttl %s", s.CacheTTL)
+		}
+		if s.TTL <= 0 {
+			return nil, errors.Errorf("Cache ttl must be positive, got %s", s.CacheTTL)
+		}
+	}
+
+	return s, nil
+}
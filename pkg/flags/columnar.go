@@ -0,0 +1,50 @@
+package flags
+
+import (
+	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+)
+
+//go:embed "columnar.yaml"
+var columnarFlagsYaml []byte
+
+type ColumnarSettings struct {
+	ParquetFile string `glazed.parameter:"parquet-file"`
+	ArrowFile   string `glazed.parameter:"arrow-file"`
+}
+
+// Format returns the columnar format to write and the file to write it to,
+// or empty strings if the results go to the glazed output.
+func (s *ColumnarSettings) Format() (string, string, error) {
+	if s.ParquetFile != "" && s.ArrowFile != "" {
+		return "", "", errors.New("--parquet-file and --arrow-file can't be used together")
+	}
+	if s.ParquetFile != "" {
+		return "parquet", s.ParquetFile, nil
+	}
+	if s.ArrowFile != "" {
+		return "arrow", s.ArrowFile, nil
+	}
+	return "", "", nil
+}
+
+func NewColumnarParameterLayer(
+	options ...layers.ParameterLayerOptions,
+) (*layers.ParameterLayerImpl, error) {
+	ret, err := layers.NewParameterLayerFromYAML(columnarFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize columnar parameter layer")
+	}
+	return ret, nil
+}
+
+func NewColumnarSettingsFromParameters(ps map[string]interface{}) (*ColumnarSettings, error) {
+	s := &ColumnarSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize columnar settings")
+	}
+	return s, nil
+}
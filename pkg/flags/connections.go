@@ -0,0 +1,46 @@
+package flags
+
+import (
+	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+)
+
+//go:embed "connections.yaml"
+var connectionsFlagsYaml []byte
+
+type ConnectionsSettings struct {
+	Connections    []string `glazed.parameter:"connections"`
+	AllDbtProfiles bool     `glazed.parameter:"all-dbt-profiles"`
+	ProfileGlob    string   `glazed.parameter:"profile-glob"`
+	Parallelism    int      `glazed.parameter:"parallelism"`
+}
+
+// Enabled returns true if the query should be run against several connections
+// instead of the one configured by the sql-connection and dbt flags.
+func (c *ConnectionsSettings) Enabled() bool {
+	return len(c.Connections) > 0 || c.AllDbtProfiles || c.ProfileGlob != ""
+}
+
+func NewConnectionsParameterLayer(
+	options ...layers.ParameterLayerOptions,
+) (*layers.ParameterLayerImpl, error) {
+	ret, err := layers.NewParameterLayerFromYAML(connectionsFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize connections parameter layer")
+	}
+	return ret, nil
+}
+
+func NewConnectionsSettingsFromParameters(ps map[string]interface{}) (*ConnectionsSettings, error) {
+	s := &ConnectionsSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize connections settings")
+	}
+	if s.Parallelism < 1 {
+		s.Parallelism = 1
+	}
+	return s, nil
+}
@@ -0,0 +1,39 @@
+package flags
+
+import (
+	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+)
+
+//go:embed "pagination.yaml"
+var paginationFlagsYaml []byte
+
+type PaginationSettings struct {
+	PageAfter string `glazed.parameter:"page-after"`
+	PageSize  int    `glazed.parameter:"page-size"`
+	AllPages  bool   `glazed.parameter:"all-pages"`
+}
+
+func NewPaginationParameterLayer(
+	options ...layers.ParameterLayerOptions,
+) (*layers.ParameterLayerImpl, error) {
+	ret, err := layers.NewParameterLayerFromYAML(paginationFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize pagination parameter layer")
+	}
+	return ret, nil
+}
+
+func NewPaginationSettingsFromParameters(ps map[string]interface{}) (*PaginationSettings, error) {
+	s := &PaginationSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize pagination settings")
+	}
+	if s.PageSize < 0 {
+		return nil, errors.Errorf("Page size must be positive, got %d", s.PageSize)
+	}
+	return s, nil
+}
@@ -0,0 +1,40 @@
+package flags
+
+import (
+	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+)
+
+//go:embed "scratch.yaml"
+var scratchFlagsYaml []byte
+
+type ScratchSettings struct {
+	Files []string `glazed.parameter:"scratch"`
+}
+
+// Enabled returns true if the query should be run against a scratch database
+// instead of the one configured by the sql-connection and dbt flags.
+func (s *ScratchSettings) Enabled() bool {
+	return len(s.Files) > 0
+}
+
+func NewScratchParameterLayer(
+	options ...layers.ParameterLayerOptions,
+) (*layers.ParameterLayerImpl, error) {
+	ret, err := layers.NewParameterLayerFromYAML(scratchFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize scratch parameter layer")
+	}
+	return ret, nil
+}
+
+func NewScratchSettingsFromParameters(ps map[string]interface{}) (*ScratchSettings, error) {
+	s := &ScratchSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize scratch settings")
+	}
+	return s, nil
+}
@@ -0,0 +1,51 @@
+package flags
+
+import (
+	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"time"
+)
+
+//go:embed "watch.yaml"
+var watchFlagsYaml []byte
+
+type WatchSettings struct {
+	Watch     string   `glazed.parameter:"watch"`
+	WatchDiff bool     `glazed.parameter:"watch-diff"`
+	WatchKeys []string `glazed.parameter:"watch-keys"`
+
+	// Interval is the parsed value of Watch, 0 if watching is disabled
+	Interval time.Duration
+}
+
+func NewWatchParameterLayer(
+	options ...layers.ParameterLayerOptions,
+) (*layers.ParameterLayerImpl, error) {
+	ret, err := layers.NewParameterLayerFromYAML(watchFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize watch parameter layer")
+	}
+	return ret, nil
+}
+
+func NewWatchSettingsFromParameters(ps map[string]interface{}) (*WatchSettings, error) {
+	s := &WatchSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize watch settings")
+	}
+
+	if s.Watch != "" {
+		s.Interval, err = time.ParseDuration(s.Watch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid watch interval %s", s.Watch)
+		}
+		if s.Interval <= 0 {
+			return nil, errors.Errorf("Watch interval must be positive, got %s", s.Watch)
+		}
+	}
+
+	return s, nil
+}
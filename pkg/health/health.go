@@ -0,0 +1,284 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Report is the result of checking a database connection.
+//
+// Values that don't apply to a database (say, TLS for sqlite) or that could
+// not be queried are left empty (or nil, for the booleans), and the reason
+// is added to Warnings.
+type Report struct {
+	Driver          string
+	ConnectLatency  time.Duration
+	PingLatency     time.Duration
+	ServerVersion   string
+	CurrentUser     string
+	CurrentDatabase string
+	CurrentSchema   string
+	Timezone        string
+	Charset         string
+	ReadOnly        *bool
+	TLS             *bool
+	// ProbeSchema is the schema the permission probes were run against.
+	ProbeSchema string
+	CanSelect   *bool
+	CanInsert   *bool
+	CanCreate   *bool
+	Warnings    []string
+	// Error is set if the connection could not be established at all.
+	Error error
+}
+
+// Check connects to the database and collects information about the server,
+// the session and the permissions of the current user on probeSchema.
+// If probeSchema is empty, the current schema (or database, for mysql) is probed.
+//
+// Check only returns an error if the context is canceled, connection errors
+// are reported in Report.Error so that several connections can be checked in a row.
+func Check(ctx context.Context, driver string, dsn string, probeSchema string) (*Report, error) {
+	r := &Report{Driver: driver}
+
+	start := time.Now()
+	db, err := sqlx.Open(driver, dsn)
+	if err == nil {
+		defer func(db *sqlx.DB) {
+			_ = db.Close()
+		}(db)
+		// session variables are per connection, make sure all queries run on the same one
+		db.SetMaxOpenConns(1)
+		err = db.PingContext(ctx)
+	}
+	r.ConnectLatency = time.Since(start)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		r.Error = err
+		return r, nil
+	}
+
+	start = time.Now()
+	err = db.PingContext(ctx)
+	r.PingLatency = time.Since(start)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		r.Error = err
+		return r, nil
+	}
+
+	switch driver {
+	case "mysql":
+		checkMysql(ctx, db, r, probeSchema)
+	case "postgres", "pgx":
+		checkPostgres(ctx, db, r, probeSchema)
+	case "sqlite3", "sqlite":
+		checkSqlite(ctx, db, r)
+	default:
+		r.Warnings = append(r.Warnings, fmt.Sprintf("no health checks for driver %s", driver))
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return r, nil
+}
+
+// probe runs a query returning a single row, and records a warning if it fails.
+func (r *Report) probe(ctx context.Context, db *sqlx.DB, what string, query string, args []interface{}, dest ...*string) bool {
+	values := make([]sql.NullString, len(dest))
+	ptrs := make([]interface{}, len(dest))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	err := db.QueryRowxContext(ctx, query, args...).Scan(ptrs...)
+	if err != nil {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("could not get %s: %s", what, err))
+		return false
+	}
+	for i, v := range values {
+		*dest[i] = v.String
+	}
+	return true
+}
+
+// probeBool is like probe for a single boolean value.
+func (r *Report) probeBool(ctx context.Context, db *sqlx.DB, what string, query string, args ...interface{}) *bool {
+	var s string
+	if !r.probe(ctx, db, what, query, args, &s) {
+		return nil
+	}
+	b, err := parseBool(s)
+	if err != nil {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("could not get %s: %s", what, err))
+		return nil
+	}
+	return &b
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no", "":
+		return false, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i != 0, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.Errorf("not a boolean: %s", s)
+	}
+	return b, nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func checkMysql(ctx context.Context, db *sqlx.DB, r *Report, probeSchema string) {
+	r.probe(ctx, db, "server version", "SELECT VERSION()", nil, &r.ServerVersion)
+	r.probe(ctx, db, "current user", "SELECT CURRENT_USER()", nil, &r.CurrentUser)
+	r.probe(ctx, db, "current database", "SELECT DATABASE()", nil, &r.CurrentDatabase)
+	r.CurrentSchema = r.CurrentDatabase
+	r.probe(ctx, db, "timezone",
+		"SELECT IF(@@session.time_zone = 'SYSTEM', @@system_time_zone, @@session.time_zone)", nil,
+		&r.Timezone)
+	r.probe(ctx, db, "character set", "SELECT @@character_set_connection", nil, &r.Charset)
+	r.ReadOnly = r.probeBool(ctx, db, "read-only status", "SELECT @@global.read_only")
+
+	var name, cipher string
+	if r.probe(ctx, db, "TLS status", "SHOW SESSION STATUS LIKE 'Ssl_cipher'", nil, &name, &cipher) {
+		r.TLS = boolPtr(cipher != "")
+	}
+
+	r.ProbeSchema = probeSchema
+	if r.ProbeSchema == "" {
+		r.ProbeSchema = r.CurrentDatabase
+	}
+	if r.ProbeSchema == "" {
+		r.Warnings = append(r.Warnings, "no database selected, skipping permission probes")
+		return
+	}
+
+	// CURRENT_USER() returns user@host, while the privilege tables use 'user'@'host'
+	idx := strings.LastIndex(r.CurrentUser, "@")
+	if idx < 0 {
+		r.Warnings = append(r.Warnings, "could not determine grantee, skipping permission probes")
+		return
+	}
+	grantee := fmt.Sprintf("'%s'@'%s'", r.CurrentUser[:idx], r.CurrentUser[idx+1:])
+
+	// privileges can be granted globally, on the schema (possibly using wildcards) or on single tables
+	query := `
+SELECT
+  COALESCE(SUM(PRIVILEGE_TYPE = 'SELECT'), 0) > 0,
+  COALESCE(SUM(PRIVILEGE_TYPE = 'INSERT'), 0) > 0,
+  COALESCE(SUM(PRIVILEGE_TYPE = 'CREATE'), 0) > 0
+FROM (
+  SELECT PRIVILEGE_TYPE FROM information_schema.USER_PRIVILEGES WHERE GRANTEE = ?
+  UNION ALL
+  SELECT PRIVILEGE_TYPE FROM information_schema.SCHEMA_PRIVILEGES WHERE GRANTEE = ? AND ? LIKE TABLE_SCHEMA
+  UNION ALL
+  SELECT PRIVILEGE_TYPE FROM information_schema.TABLE_PRIVILEGES WHERE GRANTEE = ? AND TABLE_SCHEMA = ?
+) p`
+	r.probePermissions(ctx, db, query, grantee, grantee, r.ProbeSchema, grantee, r.ProbeSchema)
+}
+
+func checkPostgres(ctx context.Context, db *sqlx.DB, r *Report, probeSchema string) {
+	r.probe(ctx, db, "server version", "SHOW server_version", nil, &r.ServerVersion)
+	r.probe(ctx, db, "current user", "SELECT current_user", nil, &r.CurrentUser)
+	r.probe(ctx, db, "current database", "SELECT current_database()", nil, &r.CurrentDatabase)
+	r.probe(ctx, db, "current schema", "SELECT current_schema()", nil, &r.CurrentSchema)
+	r.probe(ctx, db, "timezone", "SHOW TimeZone", nil, &r.Timezone)
+	r.probe(ctx, db, "character set", "SHOW server_encoding", nil, &r.Charset)
+	r.ReadOnly = r.probeBool(ctx, db, "read-only status",
+		"SELECT current_setting('transaction_read_only') = 'on' OR pg_is_in_recovery()")
+	r.TLS = r.probeBool(ctx, db, "TLS status",
+		"SELECT COALESCE((SELECT ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()), false)")
+
+	r.ProbeSchema = probeSchema
+	if r.ProbeSchema == "" {
+		r.ProbeSchema = r.CurrentSchema
+	}
+	if r.ProbeSchema == "" {
+		r.Warnings = append(r.Warnings, "no current schema, skipping permission probes")
+		return
+	}
+
+	exists := r.probeBool(ctx, db, "schema",
+		"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)", r.ProbeSchema)
+	if exists == nil {
+		return
+	}
+	if !*exists {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("schema %s does not exist", r.ProbeSchema))
+		r.CanSelect, r.CanInsert, r.CanCreate = boolPtr(false), boolPtr(false), boolPtr(false)
+		return
+	}
+
+	query := `
+SELECT
+  has_schema_privilege($1::text, 'USAGE')
+    AND COALESCE(bool_or(has_table_privilege(c.oid, 'SELECT')), false),
+  has_schema_privilege($1::text, 'USAGE')
+    AND COALESCE(bool_or(has_table_privilege(c.oid, 'INSERT')), false),
+  has_schema_privilege($1::text, 'CREATE')
+FROM pg_namespace n
+LEFT JOIN pg_class c ON c.relnamespace = n.oid AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+WHERE n.nspname = $1`
+	r.probePermissions(ctx, db, query, r.ProbeSchema)
+}
+
+func checkSqlite(ctx context.Context, db *sqlx.DB, r *Report) {
+	r.probe(ctx, db, "server version", "SELECT sqlite_version()", nil, &r.ServerVersion)
+	r.probe(ctx, db, "current database",
+		"SELECT file FROM pragma_database_list WHERE name = 'main'", nil, &r.CurrentDatabase)
+	r.CurrentSchema = "main"
+	r.probe(ctx, db, "character set", "PRAGMA encoding", nil, &r.Charset)
+	r.ReadOnly = r.probeBool(ctx, db, "read-only status", "PRAGMA query_only")
+
+	// there are no users nor grants, being able to read the catalog is as good as it gets
+	r.ProbeSchema = r.CurrentSchema
+	var count string
+	r.CanSelect = boolPtr(r.probe(ctx, db, "select permission", "SELECT COUNT(*) FROM sqlite_master", nil, &count))
+	if r.ReadOnly != nil {
+		r.CanInsert = boolPtr(!*r.ReadOnly)
+		r.CanCreate = boolPtr(!*r.ReadOnly)
+	}
+}
+
+func (r *Report) probePermissions(ctx context.Context, db *sqlx.DB, query string, args ...interface{}) {
+	var canSelect, canInsert, canCreate string
+	if !r.probe(ctx, db, "permissions", query, args, &canSelect, &canInsert, &canCreate) {
+		return
+	}
+	for _, p := range []struct {
+		value string
+		dest  **bool
+	}{
+		{canSelect, &r.CanSelect},
+		{canInsert, &r.CanInsert},
+		{canCreate, &r.CanCreate},
+	} {
+		b, err := parseBool(p.value)
+		if err != nil {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("could not get permissions: %s", err))
+			continue
+		}
+		*p.dest = boolPtr(b)
+	}
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCheckSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	r, err := Check(context.Background(), "sqlite3", path, "")
+	require.NoError(t, err)
+	require.NoError(t, r.Error)
+	assert.NotEmpty(t, r.ServerVersion)
+	assert.Equal(t, path, r.CurrentDatabase)
+	assert.Equal(t, "main", r.CurrentSchema)
+	assert.Equal(t, "UTF-8", r.Charset)
+	require.NotNil(t, r.ReadOnly)
+	assert.False(t, *r.ReadOnly)
+	require.NotNil(t, r.CanInsert)
+	assert.True(t, *r.CanInsert)
+	assert.Nil(t, r.TLS)
+	assert.Empty(t, r.Warnings)
+}
+
+func TestCheckConnectionError(t *testing.T) {
+	r, err := Check(context.Background(), "sqlite3", filepath.Join(t.TempDir(), "missing", "test.db"), "")
+	require.NoError(t, err)
+	assert.Error(t, r.Error)
+}
+
+func TestParseBool(t *testing.T) {
+	for s, expected := range map[string]bool{"on": true, "off": false, "1": true, "0": false, "true": true, "f": false} {
+		b, err := parseBool(s)
+		require.NoError(t, err)
+		assert.Equal(t, expected, b, s)
+	}
+	_, err := parseBool("maybe")
+	assert.Error(t, err)
+}
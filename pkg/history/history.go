@@ -0,0 +1,199 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DefaultPath returns the path of the history database.
+func DefaultPath() string {
+	return os.ExpandEnv("$HOME/.sqleton/history.db")
+}
+
+// Entry is a single execution of a query command.
+type Entry struct {
+	ID         int64
+	StartedAt  time.Time
+	Command    string
+	Args       []string
+	Query      string
+	QueryArgs  []interface{}
+	Connection string
+	Duration   time.Duration
+	Rows       int64
+	Error      string
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at TIMESTAMP NOT NULL,
+	command TEXT NOT NULL,
+	args TEXT NOT NULL,
+	query TEXT NOT NULL,
+	query_args TEXT NOT NULL,
+	connection TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	error TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_started_at ON history (started_at);
+`
+
+// Store is a history database, a sqlite file.
+type Store struct {
+	db *sqlx.DB
+}
+
+// Open opens the history database at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Connect("sqlite3", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open history database %s", path)
+	}
+	_, err = db.Exec(schema)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "could not create history database %s", path)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add stores e and sets its ID.
+func (s *Store) Add(ctx context.Context, e *Entry) error {
+	args, err := json.Marshal(e.Args)
+	if err != nil {
+		return err
+	}
+	queryArgs, err := json.Marshal(e.QueryArgs)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+INSERT INTO history (started_at, command, args, query, query_args, connection, duration_ms, rows, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.StartedAt, e.Command, string(args), e.Query, string(queryArgs), e.Connection,
+		e.Duration.Milliseconds(), e.Rows, e.Error,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not add history entry")
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+type ListOptions struct {
+	// Limit is the maximum number of entries to return, the most recent ones, 0 for all.
+	Limit int
+	// Command only returns the entries whose command contains it.
+	Command string
+	// ErrorsOnly only returns the entries that failed.
+	ErrorsOnly bool
+}
+
+// List returns the entries matching options, most recent first.
+func (s *Store) List(ctx context.Context, options ListOptions) ([]*Entry, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if options.Command != "" {
+		where = append(where, "instr(command, ?) > 0")
+		args = append(args, options.Command)
+	}
+	if options.ErrorsOnly {
+		where = append(where, "error != ''")
+	}
+	query := "SELECT * FROM history WHERE " + strings.Join(where, " AND ") + " ORDER BY id DESC"
+	if options.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, options.Limit)
+	}
+
+	rows, err := s.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list history")
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ret := []*Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+	return ret, rows.Err()
+}
+
+// Get returns the entry with the given id.
+func (s *Store) Get(ctx context.Context, id int64) (*Entry, error) {
+	row := s.db.QueryRowxContext(ctx, "SELECT * FROM history WHERE id = ?", id)
+	e, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Errorf("no history entry %d", id)
+	}
+	return e, err
+}
+
+type entryRow struct {
+	ID         int64     `db:"id"`
+	StartedAt  time.Time `db:"started_at"`
+	Command    string    `db:"command"`
+	Args       string    `db:"args"`
+	Query      string    `db:"query"`
+	QueryArgs  string    `db:"query_args"`
+	Connection string    `db:"connection"`
+	DurationMs int64     `db:"duration_ms"`
+	Rows       int64     `db:"rows"`
+	Error      string    `db:"error"`
+}
+
+func scanEntry(s interface{ StructScan(interface{}) error }) (*Entry, error) {
+	r := &entryRow{}
+	err := s.StructScan(r)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		ID:         r.ID,
+		StartedAt:  r.StartedAt,
+		Command:    r.Command,
+		Query:      r.Query,
+		Connection: r.Connection,
+		Duration:   time.Duration(r.DurationMs) * time.Millisecond,
+		Rows:       r.Rows,
+		Error:      r.Error,
+	}
+	err = json.Unmarshal([]byte(r.Args), &e.Args)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse the arguments of history entry %d", r.ID)
+	}
+	err = json.Unmarshal([]byte(r.QueryArgs), &e.QueryArgs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse the query arguments of history entry %d", r.ID)
+	}
+	return e, nil
+}
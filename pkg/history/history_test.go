@@ -0,0 +1,122 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "sub", "history.db"))
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	for i, command := range []string{"query", "wp posts", "query"} {
+		e := &Entry{
+			StartedAt: time.Now(),
+			Command:   command,
+			Args:      []string{command, "--limit", "10"},
+			Query:     "SELECT 1",
+			QueryArgs: []interface{}{"a"},
+			Duration:  1500 * time.Millisecond,
+			Rows:      int64(i),
+		}
+		if i == 1 {
+			e.Error = "no such table"
+		}
+		require.NoError(t, store.Add(ctx, e))
+		assert.Equal(t, int64(i+1), e.ID)
+	}
+
+	entries, err := store.List(ctx, ListOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(3), entries[0].ID)
+	assert.Equal(t, []string{"query", "--limit", "10"}, entries[0].Args)
+	assert.Equal(t, []interface{}{"a"}, entries[0].QueryArgs)
+	assert.Equal(t, 1500*time.Millisecond, entries[0].Duration)
+
+	entries, err = store.List(ctx, ListOptions{Command: "posts"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "wp posts", entries[0].Command)
+
+	entries, err = store.List(ctx, ListOptions{ErrorsOnly: true})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "no such table", entries[0].Error)
+
+	e, err := store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), e.Rows)
+	_, err = store.Get(ctx, 42)
+	assert.Error(t, err)
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	ctx := context.Background()
+	parsedLayers := map[string]*layers.ParsedParameterLayer{}
+
+	// history is disabled
+	assert.Nil(t, Start("query", parsedLayers))
+
+	Enable(path, "wp posts", []string{"wp", "posts", "--password", "secret"})
+	// a command run by the invoked one isn't recorded
+	assert.Nil(t, Start("query", parsedLayers))
+
+	r := Start("wp posts", parsedLayers)
+	require.NotNil(t, r)
+	// only the first run is recorded
+	assert.Nil(t, Start("wp posts", parsedLayers))
+
+	collector := middlewares.NewTableProcessor(
+		middlewares.WithTableMiddleware(&table.NullTableMiddleware{}),
+	)
+	gp := r.Processor(collector)
+	r.AddQuery("SELECT 1")
+	r.AddQuery("SELECT ?", 2)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, gp.AddRow(ctx, types.NewRow(types.MRP("a", i))))
+	}
+	r.Finish(errors.New("failed"))
+
+	store, err := Open(path)
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	e, err := store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "wp posts", e.Command)
+	assert.Equal(t, []string{"wp", "posts", "--password", "xxxxx"}, e.Args)
+	assert.Equal(t, "SELECT 1;\n\nSELECT ?", e.Query)
+	assert.Equal(t, []interface{}{float64(2)}, e.QueryArgs)
+	assert.Equal(t, int64(3), e.Rows)
+	assert.Equal(t, "failed", e.Error)
+
+	// a nil recorder does nothing
+	var nilRecorder *Recorder
+	assert.Equal(t, middlewares.Processor(collector), nilRecorder.Processor(collector))
+	nilRecorder.AddQuery("SELECT 1")
+	nilRecorder.Finish(nil)
+}
+
+func TestRedactArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"query", "--password", "xxxxx", "--password=xxxxx", "--dsn", "root:xxxxx@tcp(h)/db", "select 1"},
+		redactArgs([]string{"query", "--password", "secret", "--password=secret", "--dsn", "root:secret@tcp(h)/db", "select 1"}),
+	)
+	assert.Equal(t,
+		[]string{"query", "-p", "xxxxx", "-pxxxxx", "-pxxxxx", "--port", "3306", "select 1"},
+		redactArgs([]string{"query", "-p", "secret", "-psecret", "-p=secret", "--port", "3306", "select 1"}),
+	)
+}
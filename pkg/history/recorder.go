@@ -0,0 +1,169 @@
+package history
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/connections"
+	"github.com/rs/zerolog/log"
+)
+
+type invocation struct {
+	command string
+	args    []string
+	path    string
+}
+
+// current is the command line invocation to record, set by Enable.
+var current *invocation
+
+// Enable records the next run of command, the path of the command invoked on the command line
+// (for example "query" or "wp posts"), with its command line arguments, into the database at path.
+//
+// Only that command is recorded, not the commands it runs itself (as the repl or serve do).
+func Enable(path string, command string, args []string) {
+	current = &invocation{
+		command: command,
+		args:    append([]string{}, args...),
+		path:    path,
+	}
+}
+
+// Recorder collects the execution of a command into an Entry.
+//
+// A nil Recorder records nothing, so that commands don't have to check if history is enabled.
+type Recorder struct {
+	path    string
+	entry   *Entry
+	rows    int64
+	started time.Time
+}
+
+// Start returns a Recorder for command if it is the command to record, and nil otherwise.
+func Start(command string, parsedLayers map[string]*layers.ParsedParameterLayer) *Recorder {
+	if current == nil || current.command != command {
+		return nil
+	}
+	i := current
+	current = nil
+
+	return &Recorder{
+		path:    i.path,
+		started: time.Now(),
+		entry: &Entry{
+			StartedAt:  time.Now(),
+			Command:    command,
+			Args:       redactArgs(i.args),
+			Connection: connections.NameFromParsedLayers(parsedLayers),
+		},
+	}
+}
+
+// AddQuery records a query run by the command. Commands that run several queries,
+// as run with several files, record all of them.
+func (r *Recorder) AddQuery(query string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	if r.entry.Query != "" {
+		r.entry.Query += ";\n\n"
+	}
+	r.entry.Query += query
+	r.entry.QueryArgs = append(r.entry.QueryArgs, args...)
+}
+
+// SetConnection overrides the connection computed from the connection flags,
+// for example when the command ran against a scratch database.
+func (r *Recorder) SetConnection(connection string) {
+	if r == nil {
+		return
+	}
+	r.entry.Connection = connection
+}
+
+// Processor wraps gp to count the rows output by the command.
+func (r *Recorder) Processor(gp middlewares.Processor) middlewares.Processor {
+	if r == nil {
+		return gp
+	}
+	return &countingProcessor{Processor: gp, rows: &r.rows}
+}
+
+// Finish stores the entry, with err as the error of the command, unless the command
+// neither ran a query nor failed (as with --print-query).
+// Failing to store it is logged, as it shouldn't fail the command itself.
+func (r *Recorder) Finish(err error) {
+	if r == nil {
+		return
+	}
+	if _, ok := err.(*cmds.ExitWithoutGlazeError); ok {
+		err = nil
+	}
+	if err == nil && r.entry.Query == "" {
+		return
+	}
+
+	r.entry.Duration = time.Since(r.started)
+	r.entry.Rows = atomic.LoadInt64(&r.rows)
+	if err != nil {
+		r.entry.Error = err.Error()
+	}
+
+	store, err := Open(r.path)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not record history")
+		return
+	}
+	defer func(store *Store) {
+		_ = store.Close()
+	}(store)
+
+	err = store.Add(context.Background(), r.entry)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not record history")
+	}
+}
+
+type countingProcessor struct {
+	middlewares.Processor
+	rows *int64
+}
+
+func (c *countingProcessor) AddRow(ctx context.Context, row types.Row) error {
+	atomic.AddInt64(c.rows, 1)
+	return c.Processor.AddRow(ctx, row)
+}
+
+// redactArgs hides the values of --password, its -p shorthand, and --dsn.
+func redactArgs(args []string) []string {
+	ret := make([]string, len(args))
+	redactNext := ""
+	for i, arg := range args {
+		switch {
+		case redactNext == "--password" || redactNext == "-p":
+			ret[i] = "xxxxx"
+		case redactNext == "--dsn":
+			ret[i] = connections.RedactDSN(arg)
+		case strings.HasPrefix(arg, "--password="):
+			ret[i] = "--password=xxxxx"
+		case strings.HasPrefix(arg, "-p") && arg != "-p":
+			// -psecret and -p=secret
+			ret[i] = "-pxxxxx"
+		case strings.HasPrefix(arg, "--dsn="):
+			ret[i] = "--dsn=" + connections.RedactDSN(strings.TrimPrefix(arg, "--dsn="))
+		default:
+			ret[i] = arg
+		}
+		redactNext = ""
+		if arg == "--password" || arg == "-p" || arg == "--dsn" {
+			redactNext = arg
+		}
+	}
+	return ret
+}
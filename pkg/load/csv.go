@@ -0,0 +1,71 @@
+package load
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+)
+
+// readCSV reads a delimited file whose first line is the header.
+func readCSV(ctx context.Context, path string, delimiter rune, options Options, gp middlewares.Processor) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	r := csv.NewReader(f)
+	r.Comma = delimiter
+	if options.Delimiter != 0 {
+		r.Comma = options.Delimiter
+	}
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = false
+	if r.Comma == '\t' {
+		r.LazyQuotes = true
+	}
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// strip the byte order mark excel likes to add
+	if len(header) > 0 {
+		header[0] = trimBOM(header[0])
+	}
+
+	t := newTextTable(header, options, gp)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = t.add(ctx, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.flush(ctx)
+}
+
+func trimBOM(s string) string {
+	if len(s) >= 3 && s[:3] == "\xef\xbb\xbf" {
+		return s[3:]
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// converter parses a string cell, returning false if it can't.
+type converter func(s string) (interface{}, bool)
+
+// converters are tried in order, the first one accepting all the sampled values of a column is used.
+var converters = []converter{
+	parseInt,
+	parseFloat,
+	parseBool,
+	parseTime,
+}
+
+// hasLeadingZero is true for numbers like 007 or 0123, which are most likely identifiers.
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0' && s[1] != '.'
+}
+
+func parseInt(s string) (interface{}, bool) {
+	if hasLeadingZero(s) {
+		return nil, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	return v, err == nil
+}
+
+func parseFloat(s string) (interface{}, bool) {
+	if hasLeadingZero(s) {
+		return nil, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+func parseBool(s string) (interface{}, bool) {
+	switch strings.ToLower(s) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return nil, false
+}
+
+func parseTime(s string) (interface{}, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func inferConverter(sample [][]string, column int) converter {
+	for _, c := range converters {
+		ok := true
+		seen := false
+		for _, record := range sample {
+			if column >= len(record) || record[column] == "" {
+				continue
+			}
+			seen = true
+			if _, ok = c(record[column]); !ok {
+				break
+			}
+		}
+		if ok && seen {
+			return c
+		}
+	}
+	return nil
+}
+
+// textTable turns records of strings into rows.
+//
+// The first records are buffered to infer the type of each column. Empty cells in
+// columns that are not strings are NULL, and values that can't be converted are kept as strings.
+type textTable struct {
+	gp         middlewares.Processor
+	options    Options
+	header     []string
+	sample     [][]string
+	converters []converter
+	inferred   bool
+}
+
+func newTextTable(header []string, options Options, gp middlewares.Processor) *textTable {
+	return &textTable{
+		gp:      gp,
+		options: options,
+		header:  normalizeHeader(header),
+	}
+}
+
+// normalizeHeader names the unnamed columns and makes the names unique.
+func normalizeHeader(header []string) []string {
+	ret := make([]string, len(header))
+	seen := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			h = fmt.Sprintf("column_%d", i+1)
+		}
+		seen[h]++
+		if seen[h] > 1 {
+			h = fmt.Sprintf("%s_%d", h, seen[h])
+		}
+		ret[i] = h
+	}
+	return ret
+}
+
+func (t *textTable) add(ctx context.Context, record []string) error {
+	if t.inferred {
+		return t.gp.AddRow(ctx, t.row(record))
+	}
+
+	t.sample = append(t.sample, record)
+	if len(t.sample) >= t.options.SampleSize {
+		return t.flush(ctx)
+	}
+	return nil
+}
+
+// flush infers the column types out of the buffered records, and outputs them.
+func (t *textTable) flush(ctx context.Context) error {
+	if t.inferred {
+		return nil
+	}
+
+	t.converters = make([]converter, len(t.header))
+	if !t.options.NoInfer {
+		for i := range t.header {
+			t.converters[i] = inferConverter(t.sample, i)
+		}
+	}
+	t.inferred = true
+
+	for _, record := range t.sample {
+		err := t.gp.AddRow(ctx, t.row(record))
+		if err != nil {
+			return err
+		}
+	}
+	t.sample = nil
+	return nil
+}
+
+func (t *textTable) row(record []string) types.Row {
+	row := types.NewRow()
+	for i, h := range t.header {
+		if i >= len(record) {
+			row.Set(h, nil)
+			continue
+		}
+		s := record[i]
+		c := t.converters[i]
+		if c == nil {
+			row.Set(h, s)
+			continue
+		}
+		if s == "" {
+			row.Set(h, nil)
+			continue
+		}
+		if v, ok := c(s); ok {
+			row.Set(h, v)
+		} else {
+			row.Set(h, s)
+		}
+	}
+	return row
+}
@@ -0,0 +1,139 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// readJSONLines reads a file with one JSON object per line.
+func readJSONLines(ctx context.Context, path string, gp middlewares.Processor) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		row, err := jsonRow(data)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", line)
+		}
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readJSON reads a file containing an array of JSON objects, one object at a time.
+func readJSON(ctx context.Context, path string, gp middlewares.Processor) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("expected an array of objects")
+	}
+
+	for decoder.More() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var data json.RawMessage
+		err = decoder.Decode(&data)
+		if err != nil {
+			return err
+		}
+		row, err := jsonRow(data)
+		if err != nil {
+			return err
+		}
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonRow decodes an object into a row, keeping the order of its keys.
+// Integers are kept as int64, nested objects and arrays are kept as JSON strings.
+func jsonRow(data []byte) (types.Row, error) {
+	fields := orderedmap.New[string, json.RawMessage]()
+	err := json.Unmarshal(data, fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "expected a JSON object")
+	}
+
+	row := types.NewRow()
+	for pair := fields.Oldest(); pair != nil; pair = pair.Next() {
+		v, err := jsonValue(pair.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not decode %s", pair.Key)
+		}
+		row.Set(pair.Key, v)
+	}
+	return row, nil
+}
+
+func jsonValue(data json.RawMessage) (interface{}, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	switch data[0] {
+	case '{', '[':
+		buf := &bytes.Buffer{}
+		err := json.Compact(buf, data)
+		if err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	err := decoder.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	}
+	return v, nil
+}
@@ -0,0 +1,103 @@
+package load
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/pkg/errors"
+)
+
+// Formats lists the file formats that can be loaded.
+var Formats = []string{"csv", "tsv", "jsonl", "json", "xlsx", "parquet"}
+
+// Options configures how files are read.
+type Options struct {
+	// Format is detected from the file extension if empty.
+	Format string
+	// Delimiter overrides the field delimiter of csv files.
+	Delimiter rune
+	// Sheet is the xlsx sheet to read, the first one if empty.
+	Sheet string
+	// SampleSize is the number of rows used to infer the column types of csv and xlsx files.
+	SampleSize int
+	// NoInfer keeps the values of csv and xlsx files as strings.
+	NoInfer bool
+}
+
+// DetectFormat returns the format of the file out of its extension.
+func DetectFormat(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".csv":
+		return "csv", nil
+	case ".tsv", ".tab":
+		return "tsv", nil
+	case ".jsonl", ".ndjson":
+		return "jsonl", nil
+	case ".json":
+		return "json", nil
+	case ".xlsx":
+		return "xlsx", nil
+	case ".parquet", ".pq":
+		return "parquet", nil
+	default:
+		return "", errors.Errorf("could not detect the format of %s, use one of %s", path, strings.Join(Formats, ", "))
+	}
+}
+
+var nonIdentifier = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// TableName returns the table name a file is loaded into by default:
+// its base name without extension, with anything but letters, digits and underscores replaced.
+func TableName(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.Trim(nonIdentifier.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		return "data"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "t_" + name
+	}
+	return name
+}
+
+// ReadFile reads the rows of the file into gp, without closing it.
+func ReadFile(ctx context.Context, path string, options Options, gp middlewares.Processor) error {
+	format := options.Format
+	if format == "" {
+		var err error
+		format, err = DetectFormat(path)
+		if err != nil {
+			return err
+		}
+	}
+	if options.SampleSize <= 0 {
+		options.SampleSize = 1000
+	}
+
+	var err error
+	switch format {
+	case "csv":
+		err = readCSV(ctx, path, ',', options, gp)
+	case "tsv":
+		err = readCSV(ctx, path, '\t', options, gp)
+	case "jsonl":
+		err = readJSONLines(ctx, path, gp)
+	case "json":
+		err = readJSON(ctx, path, gp)
+	case "xlsx":
+		err = readXLSX(ctx, path, options, gp)
+	case "parquet":
+		err = readParquet(ctx, path, gp)
+	default:
+		return errors.Errorf("unknown format %s, use one of %s", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not read %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package load
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func readRows(t *testing.T, path string, options Options) []types.Row {
+	collector := middlewares.NewTableProcessor(
+		middlewares.WithTableMiddleware(&table.NullTableMiddleware{}),
+	)
+	require.NoError(t, ReadFile(context.Background(), path, options, collector))
+	require.NoError(t, collector.Close(context.Background()))
+	return collector.GetTable().Rows
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func get(row types.Row, key string) interface{} {
+	v, _ := row.Get(key)
+	return v
+}
+
+func TestTableName(t *testing.T) {
+	assert.Equal(t, "orders", TableName("/tmp/orders.csv"))
+	assert.Equal(t, "sales_2023_q1", TableName("sales 2023-q1.parquet"))
+	assert.Equal(t, "t_2023", TableName("2023.json"))
+}
+
+func TestReadCSV(t *testing.T) {
+	path := writeFile(t, "orders.csv", "\xef\xbb\xbfid,zip,total,paid,created,note,\n"+
+		"1,01234,10.5,true,2023-01-02,hello,x\n"+
+		"2,12345,3,false,2023-01-03 10:00:00,,y\n"+
+		"3,,,,,\"a, b\",\n")
+
+	rows := readRows(t, path, Options{})
+	require.Len(t, rows, 3)
+
+	assert.Equal(t, int64(1), get(rows[0], "id"))
+	assert.Equal(t, "01234", get(rows[0], "zip"))
+	assert.Equal(t, 10.5, get(rows[0], "total"))
+	assert.Equal(t, float64(3), get(rows[1], "total"))
+	assert.Equal(t, true, get(rows[0], "paid"))
+	assert.Equal(t, time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC), get(rows[1], "created"))
+	assert.Equal(t, "", get(rows[1], "note"))
+	assert.Equal(t, "a, b", get(rows[2], "note"))
+	assert.Nil(t, get(rows[2], "total"))
+	assert.Equal(t, "x", get(rows[0], "column_7"))
+
+	rows = readRows(t, path, Options{NoInfer: true})
+	assert.Equal(t, "1", get(rows[0], "id"))
+}
+
+func TestReadJSON(t *testing.T) {
+	path := writeFile(t, "events.jsonl", `{"id": 12345678901234, "name": "a", "score": 1.5, "tags": ["x", "y"]}
+
+{"name": "b", "id": 2, "ok": true, "score": null}
+`)
+	rows := readRows(t, path, Options{})
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(12345678901234), get(rows[0], "id"))
+	assert.Equal(t, `["x","y"]`, get(rows[0], "tags"))
+	assert.Equal(t, 1.5, get(rows[0], "score"))
+	assert.Equal(t, "name", rows[1].Oldest().Key)
+	assert.Equal(t, true, get(rows[1], "ok"))
+
+	path = writeFile(t, "events.json", `[{"id": 1}, {"id": 2}]`)
+	rows = readRows(t, path, Options{})
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(2), get(rows[1], "id"))
+}
+
+func TestReadXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	require.NoError(t, f.SetSheetRow("Sheet1", "A1", &[]interface{}{"id", "name"}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A2", &[]interface{}{1, "a"}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A3", &[]interface{}{2, "b"}))
+	path := filepath.Join(t.TempDir(), "people.xlsx")
+	require.NoError(t, f.SaveAs(path))
+
+	rows := readRows(t, path, Options{})
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(2), get(rows[1], "id"))
+	assert.Equal(t, "b", get(rows[1], "name"))
+}
+
+func TestReadParquet(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "created", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", ""}, []bool{true, false})
+	b.Field(2).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1672531200000, 0}, nil)
+	tags := b.Field(3).(*array.ListBuilder)
+	tags.Append(true)
+	tags.ValueBuilder().(*array.StringBuilder).AppendValues([]string{"x", "y"}, nil)
+	tags.AppendNull()
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	path := filepath.Join(t.TempDir(), "rows.parquet")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w, err := pqarrow.NewFileWriter(schema, f, nil, pqarrow.DefaultWriterProps())
+	require.NoError(t, err)
+	require.NoError(t, w.Write(rec))
+	require.NoError(t, w.Close())
+
+	rows := readRows(t, path, Options{})
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(1), get(rows[0], "id"))
+	assert.Equal(t, "a", get(rows[0], "name"))
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), get(rows[0], "created"))
+	assert.Equal(t, `["x","y"]`, get(rows[0], "tags"))
+	assert.Nil(t, get(rows[1], "name"))
+	assert.Nil(t, get(rows[1], "tags"))
+}
+
+func TestOpenScratch(t *testing.T) {
+	orders := writeFile(t, "orders.csv", "id,total\n1,10\n2,20\n")
+	items := writeFile(t, "items.jsonl", `{"order_id": 1, "sku": "a"}`+"\n"+`{"order_id": 1, "sku": "b"}`+"\n")
+
+	db, err := OpenScratch(context.Background(), []string{orders, "lines=" + items})
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM orders o JOIN lines l ON l.order_id = o.id"))
+	assert.Equal(t, 2, count)
+
+	_, err = OpenScratch(context.Background(), []string{orders, orders})
+	assert.Error(t, err)
+
+	empty := writeFile(t, "empty.csv", "id,total\n")
+	_, err = OpenScratch(context.Background(), []string{empty})
+	assert.ErrorContains(t, err, "is empty")
+}
+
+func TestOpenScratchPartitionedPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "date=2023-01-01")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, "x.csv")
+	require.NoError(t, os.WriteFile(path, []byte("id\n1\n"), 0644))
+
+	table, path_ := splitScratchFile(path)
+	assert.Equal(t, "x", table)
+	assert.Equal(t, path, path_)
+
+	table, path_ = splitScratchFile("lines=" + path)
+	assert.Equal(t, "lines", table)
+	assert.Equal(t, path, path_)
+
+	db, err := OpenScratch(context.Background(), []string{path})
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM x"))
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,122 @@
+package load
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet/file"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+const parquetReadSize = 1000
+
+// readParquet reads a parquet file by batches of rows.
+// Dates and timestamps are converted to times, decimals to floats,
+// and nested columns are kept as JSON strings.
+func readParquet(ctx context.Context, path string, gp middlewares.Processor) error {
+	pf, err := file.OpenParquetFile(path, false)
+	if err != nil {
+		return err
+	}
+	defer func(pf *file.Reader) {
+		_ = pf.Close()
+	}(pf)
+
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: parquetReadSize}, memory.DefaultAllocator)
+	if err != nil {
+		return err
+	}
+	rr, err := fr.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer rr.Release()
+
+	fields := rr.Schema().Fields()
+	for rr.Next() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rec := rr.Record()
+		for i := 0; i < int(rec.NumRows()); i++ {
+			row := types.NewRow()
+			for j, field := range fields {
+				value, err := arrowValue(rec.Column(j), i)
+				if err != nil {
+					return err
+				}
+				row.Set(field.Name, value)
+			}
+			err = gp.AddRow(ctx, row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the reader reports the end of the file as io.EOF
+	if err := rr.Err(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func arrowValue(a arrow.Array, i int) (interface{}, error) {
+	if a.IsNull(i) {
+		return nil, nil
+	}
+
+	switch a := a.(type) {
+	case *array.Boolean:
+		return a.Value(i), nil
+	case *array.Int8:
+		return int64(a.Value(i)), nil
+	case *array.Int16:
+		return int64(a.Value(i)), nil
+	case *array.Int32:
+		return int64(a.Value(i)), nil
+	case *array.Int64:
+		return a.Value(i), nil
+	case *array.Uint8:
+		return int64(a.Value(i)), nil
+	case *array.Uint16:
+		return int64(a.Value(i)), nil
+	case *array.Uint32:
+		return int64(a.Value(i)), nil
+	case *array.Uint64:
+		return a.Value(i), nil
+	case *array.Float32:
+		return float64(a.Value(i)), nil
+	case *array.Float64:
+		return a.Value(i), nil
+	case *array.String:
+		return a.Value(i), nil
+	case *array.LargeString:
+		return a.Value(i), nil
+	case *array.Binary:
+		return string(a.Value(i)), nil
+	case *array.FixedSizeBinary:
+		return string(a.Value(i)), nil
+	case *array.Date32:
+		return a.Value(i).ToTime().UTC(), nil
+	case *array.Date64:
+		return a.Value(i).ToTime().UTC(), nil
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		return a.Value(i).ToTime(unit).UTC(), nil
+	case *array.Decimal128:
+		return a.Value(i).ToFloat64(a.DataType().(*arrow.Decimal128Type).Scale), nil
+	}
+
+	data, err := json.Marshal(a.GetOneForMarshal(i))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,72 @@
+package load
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-go-golems/sqleton/pkg/sink"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// OpenScratch creates an in-memory SQLite database and loads each file into it.
+//
+// A file is loaded into a table named after it (see TableName), unless given as table=path.
+// The database only lives as long as its single connection, so it can't be used concurrently.
+func OpenScratch(ctx context.Context, files []string) (*sqlx.DB, error) {
+	db, err := sqlx.ConnectContext(ctx, "sqlite3", ":memory:")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create scratch database")
+	}
+	// every connection to :memory: is a different database
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	tables := map[string]string{}
+	for _, file := range files {
+		table, path := splitScratchFile(file)
+		if previous, ok := tables[table]; ok {
+			_ = db.Close()
+			return nil, errors.Errorf("%s and %s would both be loaded into table %s, use table=file to rename one of them", previous, path, table)
+		}
+		tables[table] = path
+
+		w, err := sink.NewTableWriter(db, table, sink.WithFastPath(true), sink.WithBatchSize(5000))
+		if err == nil {
+			err = ReadFile(ctx, path, Options{}, w)
+		}
+		if err == nil {
+			err = w.Close(ctx)
+		}
+		if err == nil && w.Stats().Rows == 0 {
+			// the table is created out of the rows, there is nothing to infer its columns from
+			err = errors.Errorf("%s is empty, no table %s can be created from it", path, table)
+		}
+		if err != nil {
+			_ = db.Close()
+			return nil, errors.Wrapf(err, "could not load %s into the scratch database", path)
+		}
+	}
+
+	return db, nil
+}
+
+var identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// splitScratchFile splits a table=path argument. Paths that contain = themselves,
+// such as data/date=2023-01-01/x.csv, are loaded into a table named after the file.
+func splitScratchFile(file string) (string, string) {
+	table, path, ok := strings.Cut(file, "=")
+	if ok && identifier.MatchString(table) {
+		if _, err := os.Stat(path); err == nil {
+			return table, path
+		}
+	}
+	return TableName(file), file
+}
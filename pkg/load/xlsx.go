@@ -0,0 +1,71 @@
+package load
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/pkg/errors"
+	"github.com/xuri/excelize/v2"
+)
+
+// readXLSX reads a sheet whose first row is the header, streaming its rows.
+func readXLSX(ctx context.Context, path string, options Options, gp middlewares.Processor) error {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *excelize.File) {
+		_ = f.Close()
+	}(f)
+
+	sheet := options.Sheet
+	if sheet == "" {
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return errors.New("no sheet found")
+		}
+		sheet = sheets[0]
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return errors.Wrapf(err, "could not read sheet %s", sheet)
+	}
+	defer func(rows *excelize.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var t *textTable
+	for rows.Next() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		record, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			if len(record) == 0 {
+				// skip the empty rows before the header
+				continue
+			}
+			t = newTextTable(record, options, gp)
+			continue
+		}
+		if len(record) == 0 {
+			continue
+		}
+		err = t.add(ctx, record)
+		if err != nil {
+			return err
+		}
+	}
+	if err = rows.Error(); err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+
+	return t.flush(ctx)
+}
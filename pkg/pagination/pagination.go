@@ -0,0 +1,336 @@
+package pagination
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPageSize is used when neither the pagination section nor --page-size set a page size.
+const DefaultPageSize = 100
+
+// Pagination declares the columns a query is ordered by, so that it can be paged through
+// with keyset predicates instead of OFFSET.
+type Pagination struct {
+	// Keys are the ordering columns. Together, they must identify a row.
+	Keys     []*Key `yaml:"keys"`
+	PageSize int    `yaml:"page-size,omitempty"`
+	// PageSizeFlag is the name of a flag of the command holding the page size, for
+	// commands that already have a limit flag. 0 disables pagination.
+	PageSizeFlag string `yaml:"page-size-flag,omitempty"`
+}
+
+// Key is an ordering column of a paginated query.
+//
+// It can be written as a string, `column` or `column desc`, or as a map
+// to use a different expression in the WHERE clause than the name of the result column:
+//
+//	keys:
+//	  - column: date
+//	    expression: wp.post_date
+//	    order: desc
+type Key struct {
+	// Column is the name of the column in the result rows, where the cursor values are read from.
+	Column string `yaml:"column"`
+	// Expression is used in the WHERE and ORDER BY clauses, Column if empty.
+	Expression string `yaml:"expression,omitempty"`
+	// Order is asc or desc.
+	Order string `yaml:"order,omitempty"`
+}
+
+func (k *Key) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		key, err := ParseKey(value.Value)
+		if err != nil {
+			return err
+		}
+		*k = *key
+		return nil
+	}
+
+	type rawKey Key
+	raw := &rawKey{}
+	if err := value.Decode(raw); err != nil {
+		return err
+	}
+	*k = Key(*raw)
+	return k.validate()
+}
+
+func (k *Key) validate() error {
+	if k.Column == "" {
+		return errors.New("pagination key without column")
+	}
+	switch strings.ToLower(k.Order) {
+	case "", "asc", "desc":
+	default:
+		return errors.Errorf("invalid order %s for pagination key %s, use asc or desc", k.Order, k.Column)
+	}
+	return nil
+}
+
+func (k *Key) Desc() bool {
+	return strings.EqualFold(k.Order, "desc")
+}
+
+func (k *Key) expression() string {
+	if k.Expression != "" {
+		return k.Expression
+	}
+	return k.Column
+}
+
+// ParseKey parses an ORDER BY item like `id` or `created_at DESC`.
+// A qualified column (`wp.post_date`) is read from the result column `post_date`.
+func ParseKey(s string) (*Key, error) {
+	fields := strings.Fields(s)
+	ret := &Key{}
+	switch len(fields) {
+	case 1:
+	case 2:
+		ret.Order = strings.ToLower(fields[1])
+	default:
+		return nil, errors.Errorf("could not parse pagination key %s", s)
+	}
+	ret.Column = fields[0]
+	if idx := strings.LastIndex(ret.Column, "."); idx >= 0 {
+		ret.Expression = ret.Column
+		ret.Column = ret.Column[idx+1:]
+	}
+	return ret, ret.validate()
+}
+
+// ParseOrderBy parses a comma separated ORDER BY clause into keys.
+func ParseOrderBy(orderBy string) ([]*Key, error) {
+	ret := []*Key{}
+	for _, s := range strings.Split(orderBy, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		key, err := ParseKey(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, key)
+	}
+	return ret, nil
+}
+
+// OrderBy returns the ORDER BY clause matching the keys, without the ORDER BY keyword.
+func (p *Pagination) OrderBy() string {
+	ret := make([]string, len(p.Keys))
+	for i, k := range p.Keys {
+		ret[i] = k.expression()
+		if k.Desc() {
+			ret[i] += " DESC"
+		}
+	}
+	return strings.Join(ret, ", ")
+}
+
+// Where returns the predicate selecting the rows following the cursor, for example
+// `(created_at, id) > ('2023-01-01 10:00:00', 12)`. Keys with mixed orders are expanded into
+// `created_at < ... OR (created_at = ... AND id > ...)`.
+//
+// The values are rendered as literals, quoted for the given driver.
+func (p *Pagination) Where(cursor string, driver string) (string, error) {
+	values, err := DecodeCursor(cursor, len(p.Keys))
+	if err != nil {
+		return "", err
+	}
+
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i], err = literal(v, driver)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid cursor value for %s", p.Keys[i].Column)
+		}
+	}
+	return p.predicate(literals), nil
+}
+
+// WhereArgs is like Where, but uses arg to add the values as arguments of the query
+// and get their placeholder.
+func (p *Pagination) WhereArgs(cursor string, arg func(v interface{}) string) (string, error) {
+	values, err := DecodeCursor(cursor, len(p.Keys))
+	if err != nil {
+		return "", err
+	}
+
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		if n, ok := v.(json.Number); ok {
+			if n_, err := n.Int64(); err == nil {
+				v = n_
+			} else if v, err = n.Float64(); err != nil {
+				return "", errors.Wrapf(err, "invalid cursor value for %s", p.Keys[i].Column)
+			}
+		}
+		placeholders[i] = arg(v)
+	}
+	return p.predicate(placeholders), nil
+}
+
+func (p *Pagination) predicate(values []string) string {
+	sameOrder := true
+	for _, k := range p.Keys[1:] {
+		if k.Desc() != p.Keys[0].Desc() {
+			sameOrder = false
+		}
+	}
+
+	if sameOrder {
+		op := ">"
+		if p.Keys[0].Desc() {
+			op = "<"
+		}
+		if len(p.Keys) == 1 {
+			return fmt.Sprintf("%s %s %s", p.Keys[0].expression(), op, values[0])
+		}
+		expressions := make([]string, len(p.Keys))
+		for i, k := range p.Keys {
+			expressions[i] = k.expression()
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(expressions, ", "), op, strings.Join(values, ", "))
+	}
+
+	ors := []string{}
+	for i, k := range p.Keys {
+		ands := []string{}
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = %s", p.Keys[j].expression(), values[j]))
+		}
+		op := ">"
+		if k.Desc() {
+			op = "<"
+		}
+		ands = append(ands, fmt.Sprintf("%s %s %s", k.expression(), op, values[i]))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// EncodeCursor returns the cursor pointing after the row, out of the values of its key columns.
+func (p *Pagination) EncodeCursor(row types.Row) (string, error) {
+	values := make([]interface{}, len(p.Keys))
+	for i, k := range p.Keys {
+		v, ok := row.Get(k.Column)
+		if !ok {
+			return "", errors.Errorf("pagination key %s is not a column of the result", k.Column)
+		}
+		switch v_ := v.(type) {
+		case nil:
+			return "", errors.Errorf("pagination key %s is NULL, pagination keys can't be NULL", k.Column)
+		case time.Time:
+			v = v_.Format("2006-01-02 15:04:05.999999")
+		case []byte:
+			v = string(v_)
+		}
+		values[i] = v
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.Wrap(err, "could not encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor returns the key values stored in a cursor.
+func DecodeCursor(cursor string, keys int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cursor")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	values := []interface{}{}
+	err = decoder.Decode(&values)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cursor")
+	}
+	if len(values) != keys {
+		return nil, errors.Errorf("invalid cursor, expected %d values, got %d", keys, len(values))
+	}
+	return values, nil
+}
+
+func literal(v interface{}, driver string) (string, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if _, err := v.Float64(); err != nil {
+			return "", err
+		}
+		return v.String(), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case string:
+		s := strings.ReplaceAll(v, "'", "''")
+		if driver == "mysql" {
+			s = strings.ReplaceAll(s, `\`, `\\`)
+		}
+		return "'" + s + "'", nil
+	default:
+		return "", errors.Errorf("unsupported value %v", v)
+	}
+}
+
+// Recorder passes rows to the next processor, and keeps the key values of the last one
+// to compute the cursor of the next page. It doesn't close the next processor.
+type Recorder struct {
+	pagination *Pagination
+	next       middlewares.Processor
+	last       types.Row
+	Count      int
+}
+
+var _ middlewares.Processor = (*Recorder)(nil)
+
+func NewRecorder(pagination *Pagination, next middlewares.Processor) *Recorder {
+	return &Recorder{pagination: pagination, next: next}
+}
+
+func (r *Recorder) AddRow(ctx context.Context, row types.Row) error {
+	// the next processor might modify the row, so we keep a copy of the keys
+	r.last = types.NewRow()
+	for _, k := range r.pagination.Keys {
+		if v, ok := row.Get(k.Column); ok {
+			r.last.Set(k.Column, v)
+		}
+	}
+	r.Count++
+	return r.next.AddRow(ctx, row)
+}
+
+func (r *Recorder) Close(ctx context.Context) error {
+	return nil
+}
+
+func (r *Recorder) SetColumnTypes(columnTypes []*sql.ColumnType) error {
+	if cts, ok := r.next.(stream.ColumnTypesSetter); ok {
+		return cts.SetColumnTypes(columnTypes)
+	}
+	return nil
+}
+
+// Cursor returns the cursor pointing after the last row, empty if there were no rows.
+func (r *Recorder) Cursor() (string, error) {
+	if r.last == nil {
+		return "", nil
+	}
+	return r.pagination.EncodeCursor(r.last)
+}
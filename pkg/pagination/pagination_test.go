@@ -0,0 +1,78 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePagination(t *testing.T) {
+	p := &Pagination{}
+	err := yaml.Unmarshal([]byte(`
+keys:
+  - wp.post_date desc
+  - column: id
+    expression: wp.ID
+    order: desc
+page-size: 20
+`), p)
+	require.NoError(t, err)
+	require.Len(t, p.Keys, 2)
+	assert.Equal(t, "post_date", p.Keys[0].Column)
+	assert.True(t, p.Keys[0].Desc())
+	assert.Equal(t, "wp.post_date DESC, wp.ID DESC", p.OrderBy())
+	assert.Equal(t, 20, p.PageSize)
+
+	err = yaml.Unmarshal([]byte(`keys: [id sideways]`), p)
+	assert.Error(t, err)
+}
+
+func TestWhere(t *testing.T) {
+	p := &Pagination{Keys: []*Key{{Column: "created"}, {Column: "id"}}}
+	cursor, err := p.EncodeCursor(types.NewRow(
+		types.MRP("id", int64(12)),
+		types.MRP("created", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)),
+	))
+	require.NoError(t, err)
+
+	where, err := p.Where(cursor, "sqlite3")
+	require.NoError(t, err)
+	assert.Equal(t, "(created, id) > ('2023-01-02 10:00:00', 12)", where)
+
+	args := []interface{}{}
+	where, err = p.WhereArgs(cursor, func(v interface{}) string {
+		args = append(args, v)
+		return "?"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "(created, id) > (?, ?)", where)
+	assert.Equal(t, []interface{}{"2023-01-02 10:00:00", int64(12)}, args)
+
+	p.Keys[0].Order = "desc"
+	where, err = p.Where(cursor, "sqlite3")
+	require.NoError(t, err)
+	assert.Equal(t, "((created < '2023-01-02 10:00:00') OR (created = '2023-01-02 10:00:00' AND id > 12))", where)
+
+	_, err = p.Where("nope", "sqlite3")
+	assert.Error(t, err)
+	_, err = p.EncodeCursor(types.NewRow(types.MRP("id", 1), types.MRP("created", nil)))
+	assert.Error(t, err)
+}
+
+func TestLiteral(t *testing.T) {
+	p := &Pagination{Keys: []*Key{{Column: "name", Order: "desc"}}}
+	cursor, err := p.EncodeCursor(types.NewRow(types.MRP("name", `it's a \ test`)))
+	require.NoError(t, err)
+
+	where, err := p.Where(cursor, "postgres")
+	require.NoError(t, err)
+	assert.Equal(t, `name < 'it''s a \ test'`, where)
+
+	where, err = p.Where(cursor, "mysql")
+	require.NoError(t, err)
+	assert.Equal(t, `name < 'it''s a \\ test'`, where)
+}
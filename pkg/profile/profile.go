@@ -0,0 +1,600 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Options configures the statistics computed by Table.
+type Options struct {
+	// Sample is the percentage of rows to profile, 0 to profile all of them.
+	Sample float64
+	// Top is the number of most frequent values reported per column, 0 to skip them.
+	Top int
+	// Buckets is the number of buckets of the histograms, 0 to skip them.
+	Buckets int
+	// ApproximateDistinct estimates the number of distinct values with a HyperLogLog,
+	// computed while reading the rows, instead of counting them in the database.
+	ApproximateDistinct bool
+}
+
+// ValueCount is a value of a column and the number of rows having it.
+type ValueCount struct {
+	Value interface{}
+	Count int64
+}
+
+// Bucket counts the values between From (included) and To (excluded, except for the last bucket).
+// The bounds are float64, or time.Time for date columns.
+type Bucket struct {
+	From  interface{}
+	To    interface{}
+	Count int64
+}
+
+// ColumnProfile holds the statistics of a column.
+// The statistics that don't apply to the type of the column are left empty.
+type ColumnProfile struct {
+	Column *schema.Column
+	Rows   int64
+	Nulls  int64
+	// Distinct is the number of distinct non-NULL values, estimated if DistinctApproximate is set.
+	Distinct            *int64
+	DistinctApproximate bool
+	Min                 interface{}
+	Max                 interface{}
+	// The lengths are only computed for strings.
+	MinLength *int64
+	MaxLength *int64
+	AvgLength *float64
+	Top       []*ValueCount
+	// Histogram is the distribution of the values for numbers and dates, and of the lengths for strings.
+	Histogram []*Bucket
+
+	nonNull int64
+	// minEpoch and maxEpoch are the extremes of date columns, as seconds since 1970
+	minEpoch interface{}
+	maxEpoch interface{}
+}
+
+func (p *ColumnProfile) NullFraction() float64 {
+	if p.Rows == 0 {
+		return 0
+	}
+	return float64(p.Nulls) / float64(p.Rows)
+}
+
+// ParseSample parses a sample size given as a percentage (`1%`) or a fraction (`0.01`),
+// and returns it as a percentage.
+func ParseSample(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	factor := 100.0
+	if strings.HasSuffix(s, "%") {
+		s = strings.TrimSuffix(s, "%")
+		factor = 1
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 || f*factor > 100 {
+		return 0, errors.Errorf("invalid sample %s, use a percentage like 1%% or a fraction like 0.01", s)
+	}
+	return f * factor, nil
+}
+
+// dialect holds the SQL expressions that differ between databases.
+type dialect struct {
+	// quote quotes a column name, as columns can be reserved words or mixed case
+	quote  func(name string) string
+	length func(column string) string
+	// epoch converts a date column to seconds since 1970, for the histograms
+	epoch func(column string) string
+	floor func(expr string) string
+	// sample returns the FROM clause selecting percent percent of the rows of table,
+	// the same ones for a given seed where the database allows it.
+	sample func(table string, percent float64, seed int32) string
+}
+
+var mysqlDialect = &dialect{
+	quote:  func(name string) string { return "`" + strings.ReplaceAll(name, "`", "``") + "`" },
+	length: func(column string) string { return fmt.Sprintf("CHAR_LENGTH(%s)", column) },
+	epoch:  func(column string) string { return fmt.Sprintf("UNIX_TIMESTAMP(%s)", column) },
+	floor:  func(expr string) string { return fmt.Sprintf("FLOOR(%s)", expr) },
+	sample: func(table string, percent float64, seed int32) string {
+		return fmt.Sprintf("(SELECT * FROM %s WHERE RAND(%d) < %s) AS sample", table, seed, formatFloat(percent/100))
+	},
+}
+
+var postgresDialect = &dialect{
+	quote:  quoteDouble,
+	length: func(column string) string { return fmt.Sprintf("CHAR_LENGTH(%s)", column) },
+	epoch:  func(column string) string { return fmt.Sprintf("EXTRACT(EPOCH FROM %s)", column) },
+	floor:  func(expr string) string { return fmt.Sprintf("FLOOR(%s)", expr) },
+	sample: func(table string, percent float64, seed int32) string {
+		return fmt.Sprintf("%s TABLESAMPLE BERNOULLI (%s) REPEATABLE (%d)", table, formatFloat(percent), seed)
+	},
+}
+
+var sqliteDialect = &dialect{
+	quote:  quoteDouble,
+	length: func(column string) string { return fmt.Sprintf("LENGTH(%s)", column) },
+	epoch:  func(column string) string { return fmt.Sprintf("CAST(strftime('%%s', %s) AS INTEGER)", column) },
+	// the math functions are optional in sqlite, the values are never negative here
+	floor: func(expr string) string { return fmt.Sprintf("CAST(%s AS INTEGER)", expr) },
+	// random() can't be seeded, the rowids are hashed instead so that every query samples the same rows
+	sample: func(table string, percent float64, seed int32) string {
+		return fmt.Sprintf("(SELECT * FROM %s WHERE ((rowid * 2654435761 + %d) %% 1000000 + 1000000) %% 1000000 < %d) AS sample",
+			table, seed, int64(math.Round(percent*10000)))
+	},
+}
+
+func quoteDouble(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func dialectOf(driver string) (*dialect, error) {
+	switch driver {
+	case "mysql":
+		return mysqlDialect, nil
+	case "postgres", "pgx":
+		return postgresDialect, nil
+	case "sqlite3", "sqlite":
+		return sqliteDialect, nil
+	}
+	return nil, errors.Errorf("profiling is not supported for driver %s", driver)
+}
+
+// Table computes the statistics of the given columns of table.
+//
+// The statistics are computed in the database: one query for the counts, the extremes and
+// the lengths of all the columns, then one query per column for its most frequent values
+// and one for its histogram. With a sample, each query runs on the sampled rows.
+func Table(ctx context.Context, db *sqlx.DB, table string, columns []*schema.Column, options Options) ([]*ColumnProfile, error) {
+	d, err := dialectOf(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	from := table
+	if options.Sample > 0 && options.Sample < 100 {
+		from = d.sample(table, options.Sample, rand.Int31())
+	}
+	p := &profiler{db: db, dialect: d, from: from, options: options}
+
+	ret := make([]*ColumnProfile, len(columns))
+	for i, c := range columns {
+		ret[i] = &ColumnProfile{Column: c}
+	}
+
+	err = p.aggregate(ctx, ret)
+	if err != nil {
+		return nil, err
+	}
+	if options.ApproximateDistinct {
+		err = p.estimateDistinct(ctx, ret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, cp := range ret {
+		err = p.top(ctx, cp)
+		if err != nil {
+			return nil, err
+		}
+		err = p.histogram(ctx, cp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+type profiler struct {
+	db      *sqlx.DB
+	dialect *dialect
+	from    string
+	options Options
+}
+
+func hasDistinct(k schema.ColumnKind) bool {
+	return k != schema.KindOther
+}
+
+func hasExtremes(k schema.ColumnKind) bool {
+	return k == schema.KindString || k == schema.KindInt || k == schema.KindFloat || k == schema.KindDate
+}
+
+// aggregate computes the counts, the extremes and the lengths of all the columns in a single query.
+func (p *profiler) aggregate(ctx context.Context, profiles []*ColumnProfile) error {
+	exprs := []string{"COUNT(*)"}
+	setters := []func(v interface{}) error{}
+	toInt := func(target **int64) func(v interface{}) error {
+		return func(v interface{}) error {
+			if v == nil {
+				return nil
+			}
+			f, err := toFloat64(v)
+			if err != nil {
+				return err
+			}
+			i := int64(f)
+			*target = &i
+			return nil
+		}
+	}
+
+	for _, cp := range profiles {
+		cp := cp
+		c := p.dialect.quote(cp.Column.Name)
+		kind := cp.Column.Kind()
+
+		exprs = append(exprs, fmt.Sprintf("COUNT(%s)", c))
+		setters = append(setters, func(v interface{}) error {
+			n, err := toFloat64(v)
+			cp.nonNull = int64(n)
+			return err
+		})
+		if hasDistinct(kind) && !p.options.ApproximateDistinct {
+			exprs = append(exprs, fmt.Sprintf("COUNT(DISTINCT %s)", c))
+			setters = append(setters, toInt(&cp.Distinct))
+		}
+		if hasExtremes(kind) {
+			exprs = append(exprs, fmt.Sprintf("MIN(%s)", c), fmt.Sprintf("MAX(%s)", c))
+			setters = append(setters,
+				func(v interface{}) error { cp.Min = normalize(v); return nil },
+				func(v interface{}) error { cp.Max = normalize(v); return nil },
+			)
+		}
+		if kind == schema.KindDate {
+			epoch := p.dialect.epoch(c)
+			exprs = append(exprs, fmt.Sprintf("MIN(%s)", epoch), fmt.Sprintf("MAX(%s)", epoch))
+			setters = append(setters,
+				func(v interface{}) error { cp.minEpoch = v; return nil },
+				func(v interface{}) error { cp.maxEpoch = v; return nil },
+			)
+		}
+		if kind == schema.KindString {
+			length := p.dialect.length(c)
+			exprs = append(exprs,
+				fmt.Sprintf("MIN(%s)", length), fmt.Sprintf("MAX(%s)", length), fmt.Sprintf("AVG(%s)", length))
+			setters = append(setters, toInt(&cp.MinLength), toInt(&cp.MaxLength), func(v interface{}) error {
+				if v == nil {
+					return nil
+				}
+				f, err := toFloat64(v)
+				cp.AvgLength = &f
+				return err
+			})
+		}
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(exprs, ", "), p.from)
+	values, err := p.db.QueryRowxContext(ctx, query).SliceScan()
+	if err != nil {
+		return errors.Wrap(err, "could not compute column statistics")
+	}
+
+	rows, err := toFloat64(values[0])
+	if err != nil {
+		return err
+	}
+	for i, set := range setters {
+		err = set(values[i+1])
+		if err != nil {
+			return errors.Wrapf(err, "could not read %s", exprs[i+1])
+		}
+	}
+	for _, cp := range profiles {
+		cp.Rows = int64(rows)
+		cp.Nulls = cp.Rows - cp.nonNull
+	}
+	return nil
+}
+
+// estimateDistinct reads all the (sampled) rows to estimate the number of distinct values of the columns.
+func (p *profiler) estimateDistinct(ctx context.Context, profiles []*ColumnProfile) error {
+	estimated := []*ColumnProfile{}
+	names := []string{}
+	for _, cp := range profiles {
+		if hasDistinct(cp.Column.Kind()) {
+			estimated = append(estimated, cp)
+			names = append(names, p.dialect.quote(cp.Column.Name))
+		}
+	}
+	if len(estimated) == 0 {
+		return nil
+	}
+
+	rows, err := p.db.QueryxContext(ctx, fmt.Sprintf("SELECT %s FROM %s", strings.Join(names, ", "), p.from))
+	if err != nil {
+		return errors.Wrap(err, "could not read the rows")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	hlls := make([]*HyperLogLog, len(estimated))
+	for i := range hlls {
+		hlls[i] = NewHyperLogLog()
+	}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			if v != nil {
+				hlls[i].Add(formatValue(normalize(v)))
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return errors.Wrap(err, "could not read the rows")
+	}
+
+	for i, cp := range estimated {
+		n := int64(hlls[i].Count())
+		cp.Distinct = &n
+		cp.DistinctApproximate = true
+	}
+	return nil
+}
+
+// top computes the most frequent values of the column.
+func (p *profiler) top(ctx context.Context, cp *ColumnProfile) error {
+	if p.options.Top <= 0 || !hasDistinct(cp.Column.Kind()) || cp.nonNull == 0 {
+		return nil
+	}
+
+	c := cp.Column.Name
+	q := p.dialect.quote(c)
+	// ordered by position, as the column itself can be named count
+	query := fmt.Sprintf("SELECT %s, COUNT(*) AS count FROM %s WHERE %s IS NOT NULL GROUP BY %s ORDER BY 2 DESC LIMIT %d",
+		q, p.from, q, q, p.options.Top)
+	rows, err := p.db.QueryxContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not compute the most frequent values of %s", c)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+		count, err := toFloat64(values[1])
+		if err != nil {
+			return err
+		}
+		cp.Top = append(cp.Top, &ValueCount{Value: normalize(values[0]), Count: int64(count)})
+	}
+	return errors.Wrapf(rows.Err(), "could not compute the most frequent values of %s", c)
+}
+
+// histogram computes the distribution of the values of numbers and dates, and of the lengths of strings,
+// in buckets of equal width between the extremes computed by aggregate.
+func (p *profiler) histogram(ctx context.Context, cp *ColumnProfile) error {
+	if p.options.Buckets <= 0 || cp.nonNull == 0 {
+		return nil
+	}
+
+	c := cp.Column.Name
+	q := p.dialect.quote(c)
+	var expr string
+	var lo, hi float64
+	var err error
+	isDate := false
+	// unit is the step between the values of integers, lengths and dates without time,
+	// whose buckets are a multiple of it wide, and 0 for continuous values
+	unit := 0.0
+
+	switch cp.Column.Kind() {
+	case schema.KindInt, schema.KindFloat:
+		expr = q
+		if cp.Column.Kind() == schema.KindInt {
+			unit = 1
+		}
+		lo, err = toFloat64(cp.Min)
+		if err == nil {
+			hi, err = toFloat64(cp.Max)
+		}
+	case schema.KindDate:
+		expr = p.dialect.epoch(q)
+		isDate = true
+		if strings.EqualFold(cp.Column.DataType, "date") {
+			unit = 86400
+		}
+		lo, err = toFloat64(cp.minEpoch)
+		if err == nil {
+			hi, err = toFloat64(cp.maxEpoch)
+		}
+	case schema.KindString:
+		if cp.MinLength == nil || cp.MaxLength == nil {
+			return nil
+		}
+		expr = p.dialect.length(q)
+		unit = 1
+		lo, hi = float64(*cp.MinLength), float64(*cp.MaxLength)
+	default:
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not compute the histogram of %s", c)
+	}
+
+	n := p.options.Buckets
+	width := (hi - lo) / float64(n)
+	if unit > 0 {
+		width = math.Ceil((hi-lo+unit)/float64(n)/unit) * unit
+		n = int(math.Ceil((hi - lo + unit) / width))
+	}
+
+	bound := func(f float64) interface{} {
+		if isDate {
+			return time.Unix(int64(f), 0).UTC()
+		}
+		if unit == 0 && width > 0 {
+			// keep 3 significant digits of the width, instead of the noise of the division
+			d := math.Pow(10, math.Max(0, 3-math.Ceil(math.Log10(width))))
+			return math.Round(f*d) / d
+		}
+		return f
+	}
+
+	if width <= 0 {
+		cp.Histogram = []*Bucket{{From: bound(lo), To: bound(hi), Count: cp.nonNull}}
+		return nil
+	}
+
+	query := fmt.Sprintf("SELECT %s AS bucket, COUNT(*) AS count FROM %s WHERE %s IS NOT NULL GROUP BY 1",
+		p.dialect.floor(fmt.Sprintf("(%s - %s) / %s", expr, formatFloat(lo), formatFloat(width))), p.from, q)
+	rows, err := p.db.QueryxContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not compute the histogram of %s", c)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	counts := make([]int64, n)
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+		if values[0] == nil {
+			continue
+		}
+		b, err := toFloat64(values[0])
+		if err != nil {
+			return err
+		}
+		count, err := toFloat64(values[1])
+		if err != nil {
+			return err
+		}
+		// the maximum falls into the last bucket, and rounding can push values out of the range
+		i := int(math.Max(0, math.Min(b, float64(n-1))))
+		counts[i] += int64(count)
+	}
+	if err = rows.Err(); err != nil {
+		return errors.Wrapf(err, "could not compute the histogram of %s", c)
+	}
+
+	for i, count := range counts {
+		cp.Histogram = append(cp.Histogram, &Bucket{
+			From:  bound(lo + float64(i)*width),
+			To:    bound(lo + float64(i+1)*width),
+			Count: count,
+		})
+	}
+	return nil
+}
+
+// Row returns the statistics as a row, with the most frequent values and the histogram
+// formatted as strings.
+func (p *ColumnProfile) Row() types.Row {
+	row := types.NewRow(
+		types.MRP("column", p.Column.Name),
+		types.MRP("type", p.Column.Type),
+		types.MRP("rows", p.Rows),
+		types.MRP("nulls", p.Nulls),
+		types.MRP("null_fraction", math.Round(p.NullFraction()*10000)/10000),
+	)
+
+	var distinct interface{}
+	if p.Distinct != nil {
+		distinct = *p.Distinct
+	}
+	row.Set("distinct", distinct)
+	row.Set("distinct_approximate", p.DistinctApproximate)
+	row.Set("min", formatOptional(p.Min))
+	row.Set("max", formatOptional(p.Max))
+
+	var minLength, maxLength, avgLength interface{}
+	if p.MinLength != nil {
+		minLength = *p.MinLength
+	}
+	if p.MaxLength != nil {
+		maxLength = *p.MaxLength
+	}
+	if p.AvgLength != nil {
+		avgLength = math.Round(*p.AvgLength*100) / 100
+	}
+	row.Set("min_length", minLength)
+	row.Set("max_length", maxLength)
+	row.Set("avg_length", avgLength)
+
+	top := make([]string, len(p.Top))
+	for i, vc := range p.Top {
+		top[i] = fmt.Sprintf("%s (%d)", formatValue(vc.Value), vc.Count)
+	}
+	row.Set("top", strings.Join(top, ", "))
+
+	histogram := make([]string, len(p.Histogram))
+	for i, b := range p.Histogram {
+		histogram[i] = fmt.Sprintf("%s..%s: %d", formatValue(b.From), formatValue(b.To), b.Count)
+	}
+	row.Set("histogram", strings.Join(histogram, ", "))
+
+	return row
+}
+
+// normalize converts the byte slices returned by the drivers for strings and decimals.
+func normalize(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+func formatOptional(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return formatValue(v)
+}
+
+func formatValue(v interface{}) string {
+	switch v_ := v.(type) {
+	case time.Time:
+		if v_.Hour() == 0 && v_.Minute() == 0 && v_.Second() == 0 && v_.Nanosecond() == 0 {
+			return v_.Format("2006-01-02")
+		}
+		return v_.Format("2006-01-02 15:04:05")
+	case float64:
+		return formatFloat(v_)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch v_ := v.(type) {
+	case int64:
+		return float64(v_), nil
+	case float64:
+		return v_, nil
+	case []byte:
+		return toFloat64(string(v_))
+	case string:
+		f, err := strconv.ParseFloat(v_, 64)
+		if err == nil {
+			return f, nil
+		}
+	}
+	return 0, errors.Errorf("%v is not a number", v)
+}
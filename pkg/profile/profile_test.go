@@ -0,0 +1,168 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, amount REAL, created DATE, data BLOB)`)
+	require.NoError(t, err)
+	for i := 1; i <= 100; i++ {
+		name := fmt.Sprintf("'%s'", []string{"a", "bb", "ccc", "bb"}[i%4])
+		if i%10 == 0 {
+			name = "NULL"
+		}
+		_, err = db.Exec(fmt.Sprintf(`INSERT INTO t VALUES (%d, %s, %d.5, date('2023-01-01', '+%d days'), x'00')`,
+			i, name, i-1, i-1))
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func profileByName(profiles []*ColumnProfile) map[string]*ColumnProfile {
+	ret := map[string]*ColumnProfile{}
+	for _, p := range profiles {
+		ret[p.Column.Name] = p
+	}
+	return ret
+}
+
+func TestTable(t *testing.T) {
+	db := openTestDB(t)
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+
+	columns, err := schema.ListColumns(ctx, db, "t")
+	require.NoError(t, err)
+	profiles, err := Table(ctx, db, "t", columns, Options{Top: 2, Buckets: 4})
+	require.NoError(t, err)
+	p := profileByName(profiles)
+
+	name := p["name"]
+	assert.Equal(t, int64(100), name.Rows)
+	assert.Equal(t, int64(10), name.Nulls)
+	assert.InDelta(t, 0.1, name.NullFraction(), 0.0001)
+	assert.Equal(t, int64(3), *name.Distinct)
+	assert.Equal(t, "a", name.Min)
+	assert.Equal(t, "ccc", name.Max)
+	assert.Equal(t, int64(1), *name.MinLength)
+	assert.Equal(t, int64(3), *name.MaxLength)
+	require.Len(t, name.Top, 2)
+	assert.Equal(t, "bb", name.Top[0].Value)
+	assert.Equal(t, int64(50), name.Top[0].Count)
+	// the lengths are integers, so there are only 3 buckets
+	require.Len(t, name.Histogram, 3)
+	assert.Equal(t, []int64{20, 50, 20}, bucketCounts(name.Histogram))
+
+	amount := p["amount"]
+	assert.Equal(t, int64(0), amount.Nulls)
+	assert.Equal(t, int64(100), *amount.Distinct)
+	assert.Nil(t, amount.MinLength)
+	// 0.5 to 99.5 in 4 buckets, the maximum in the last one
+	assert.Equal(t, []int64{25, 25, 25, 25}, bucketCounts(amount.Histogram))
+	assert.Equal(t, 0.5, amount.Histogram[0].From)
+
+	created := p["created"]
+	assert.Equal(t, []int64{25, 25, 25, 25}, bucketCounts(created.Histogram))
+	assert.Equal(t, "2023-01-01", formatValue(created.Histogram[0].From))
+
+	data := p["data"]
+	assert.Nil(t, data.Distinct)
+	assert.Nil(t, data.Min)
+	assert.Empty(t, data.Top)
+	assert.Empty(t, data.Histogram)
+
+	row := name.Row()
+	top, _ := row.Get("top")
+	assert.Equal(t, "bb (50), ccc (20)", top)
+}
+
+func TestTableApproximateAndSample(t *testing.T) {
+	db := openTestDB(t)
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+
+	columns, err := schema.ListColumns(ctx, db, "t")
+	require.NoError(t, err)
+	profiles, err := Table(ctx, db, "t", columns, Options{ApproximateDistinct: true})
+	require.NoError(t, err)
+	p := profileByName(profiles)
+	assert.True(t, p["id"].DistinctApproximate)
+	assert.Equal(t, int64(100), *p["id"].Distinct)
+	assert.Equal(t, int64(3), *p["name"].Distinct)
+
+	profiles, err = Table(ctx, db, "t", columns, Options{Sample: 50})
+	require.NoError(t, err)
+	assert.Less(t, profiles[0].Rows, int64(100))
+}
+
+func TestTableReservedColumnNames(t *testing.T) {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+
+	_, err = db.Exec(`CREATE TABLE t ("order" INTEGER, "group" TEXT, "key" DATE, "count" INTEGER)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO t VALUES (1, 'a', '2023-01-01', 5), (2, 'a', '2023-01-02', 5), (3, 'b', NULL, 6)`)
+	require.NoError(t, err)
+
+	columns, err := schema.ListColumns(ctx, db, "t")
+	require.NoError(t, err)
+	for _, options := range []Options{{Top: 2, Buckets: 2}, {ApproximateDistinct: true}} {
+		profiles, err := Table(ctx, db, "t", columns, options)
+		require.NoError(t, err)
+		p := profileByName(profiles)
+		assert.Equal(t, int64(2), *p["group"].Distinct)
+		assert.Equal(t, int64(1), p["key"].Nulls)
+		assert.Equal(t, int64(3), p["order"].Max)
+		if options.Top > 0 {
+			require.Len(t, p["count"].Top, 2)
+			assert.Equal(t, int64(5), p["count"].Top[0].Value)
+			assert.Equal(t, int64(2), p["count"].Top[0].Count)
+		}
+	}
+}
+
+func bucketCounts(buckets []*Bucket) []int64 {
+	ret := make([]int64, len(buckets))
+	for i, b := range buckets {
+		ret[i] = b.Count
+	}
+	return ret
+}
+
+func TestHyperLogLog(t *testing.T) {
+	h := NewHyperLogLog()
+	for i := 0; i < 200000; i++ {
+		h.Add(fmt.Sprintf("value-%d", i%100000))
+	}
+	assert.InEpsilon(t, 100000, float64(h.Count()), 0.03)
+}
+
+func TestParseSample(t *testing.T) {
+	for s, expected := range map[string]float64{"1%": 1, "0.5%": 0.5, "0.01": 1, "100%": 100} {
+		f, err := ParseSample(s)
+		require.NoError(t, err, s)
+		assert.InDelta(t, expected, f, 1e-9, s)
+	}
+	for _, s := range []string{"0%", "200%", "2", "x"} {
+		_, err := ParseSample(s)
+		assert.Error(t, err, s)
+	}
+}
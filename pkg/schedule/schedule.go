@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a schedule file, listing the query commands to run periodically.
+//
+//	jobs:
+//	  - name: orders-daily
+//	    command: shop orders
+//	    flags:
+//	      status: [ paid, shipped ]
+//	      from: 2023-01-01
+//	    schedule: "0 6 * * *"
+//	    sinks:
+//	      - type: file
+//	        path: /data/orders-{{ .Time.Format "2006-01-02" }}.csv
+//	        format: csv
+type File struct {
+	Jobs []*Job `yaml:"jobs"`
+}
+
+// Job runs a query command on a cron schedule and writes its rows to sinks.
+type Job struct {
+	Name string `yaml:"name"`
+	// Command is the path of the command, as on the command line, for example "mysql ps".
+	Command string `yaml:"command"`
+	// Flags are the values of the flags of the command, by flag name.
+	Flags map[string]interface{} `yaml:"flags,omitempty"`
+	// Arguments are the positional arguments of the command.
+	Arguments []string `yaml:"arguments,omitempty"`
+	// Connection is a connection name or database URL. The connection flags of
+	// the schedule command are used if empty.
+	Connection string `yaml:"connection,omitempty"`
+	// Schedule is a standard cron expression, or a descriptor such as @hourly or @every 10m.
+	Schedule string  `yaml:"schedule"`
+	Sinks    []*Sink `yaml:"sinks"`
+
+	schedule cron.Schedule
+}
+
+// Load reads and validates the schedule file at path.
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	err = yaml.Unmarshal(b, f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse schedule file %s", path)
+	}
+	err = f.Validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid schedule file %s", path)
+	}
+	return f, nil
+}
+
+func (f *File) Validate() error {
+	if len(f.Jobs) == 0 {
+		return errors.New("no jobs")
+	}
+	names := map[string]bool{}
+	for i, job := range f.Jobs {
+		if job.Name == "" {
+			return errors.Errorf("job %d has no name", i+1)
+		}
+		if names[job.Name] {
+			return errors.Errorf("duplicate job %s", job.Name)
+		}
+		names[job.Name] = true
+
+		err := job.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "job %s", job.Name)
+		}
+	}
+	return nil
+}
+
+func (j *Job) Validate() error {
+	if strings.TrimSpace(j.Command) == "" {
+		return errors.New("no command")
+	}
+	schedule, err := cron.ParseStandard(j.Schedule)
+	if err != nil {
+		return errors.Wrapf(err, "invalid schedule %q", j.Schedule)
+	}
+	j.schedule = schedule
+	if len(j.Sinks) == 0 {
+		return errors.New("no sinks")
+	}
+	for i, s := range j.Sinks {
+		err = s.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "sink %d", i+1)
+		}
+	}
+	return nil
+}
+
+// Args returns the command path, arguments and flags of the job, as they would be
+// passed on the command line.
+func (j *Job) Args() []string {
+	ret := append(strings.Fields(j.Command), j.Arguments...)
+
+	names := make([]string, 0, len(j.Flags))
+	for name := range j.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ret = append(ret, fmt.Sprintf("--%s=%s", name, flagValue(j.Flags[name])))
+	}
+	return ret
+}
+
+// flagValue formats v as a flag value, lists as comma separated values.
+func flagValue(v interface{}) string {
+	if l, ok := v.([]interface{}); ok {
+		values := make([]string, len(l))
+		for i, v_ := range l {
+			values[i] = flagValue(v_)
+		}
+		return strings.Join(values, ",")
+	}
+	if t, ok := v.(time.Time); ok {
+		// yaml decodes unquoted dates as times
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339)
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,191 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "schedule.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	f, err := Load(writeFile(t, `
+jobs:
+  - name: orders
+    command: shop orders
+    arguments: [ paid ]
+    flags:
+      limit: 10
+      from: 2023-01-01
+      status: [ paid, shipped ]
+      verbose: true
+    schedule: "@every 1m"
+    sinks:
+      - type: file
+        path: /tmp/orders.csv
+`))
+	require.NoError(t, err)
+	require.Len(t, f.Jobs, 1)
+	assert.Equal(t,
+		[]string{"shop", "orders", "paid", "--from=2023-01-01", "--limit=10", "--status=paid,shipped", "--verbose=true"},
+		f.Jobs[0].Args(),
+	)
+
+	for name, content := range map[string]string{
+		"no jobs":          `jobs: []`,
+		"invalid schedule": `{jobs: [{name: a, command: a, schedule: "every minute", sinks: [{type: file, path: a}]}]}`,
+		"no sinks":         `{jobs: [{name: a, command: a, schedule: "@hourly"}]}`,
+		"unknown sink":     `{jobs: [{name: a, command: a, schedule: "@hourly", sinks: [{type: s3}]}]}`,
+		"sqlite sink":      `{jobs: [{name: a, command: a, schedule: "@hourly", sinks: [{type: sqlite, path: a}]}]}`,
+		"duplicate job": `{jobs: [
+  {name: a, command: a, schedule: "@hourly", sinks: [{type: file, path: a}]},
+  {name: a, command: b, schedule: "@hourly", sinks: [{type: file, path: b}]}]}`,
+	} {
+		_, err = Load(writeFile(t, content))
+		assert.Error(t, err, name)
+	}
+}
+
+func testRows() []types.Row {
+	return []types.Row{
+		types.NewRow(types.MRP("id", 1), types.MRP("status", "paid")),
+		types.NewRow(types.MRP("id", 2), types.MRP("status", "shipped")),
+	}
+}
+
+func TestSinks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	info := &RunInfo{
+		Job:     "orders",
+		Command: "shop orders",
+		Time:    time.Date(2023, 3, 1, 6, 0, 0, 0, time.UTC),
+	}
+
+	s := &Sink{Type: SinkTypeFile, Path: filepath.Join(dir, `{{ .Job }}-{{ .Time.Format "2006-01-02" }}.csv`)}
+	require.NoError(t, s.Write(ctx, info, testRows()))
+	b, err := os.ReadFile(filepath.Join(dir, "orders-2023-03-01.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "id,status\n1,paid\n2,shipped\n", string(b))
+
+	dbPath := filepath.Join(dir, "snapshots.db")
+	s = &Sink{Type: SinkTypeSqlite, Path: dbPath, Table: "orders", TimestampColumn: "run_at"}
+	require.NoError(t, s.Write(ctx, info, testRows()))
+	require.NoError(t, s.Write(ctx, info, testRows()))
+	db, err := sqlx.Connect("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT count(*) FROM orders WHERE run_at IS NOT NULL"))
+	assert.Equal(t, 4, count)
+
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &payload)
+	}))
+	defer server.Close()
+	s = &Sink{Type: SinkTypeWebhook, URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	require.NoError(t, s.Write(ctx, info, testRows()))
+	assert.Equal(t, "orders", payload["job"])
+	assert.Len(t, payload["rows"], 2)
+
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer slow.Close()
+	defer close(done)
+	s = &Sink{Type: SinkTypeWebhook, URL: slow.URL, Timeout: "50ms"}
+	require.NoError(t, s.Validate())
+	err = s.Write(ctx, info, testRows())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Error(t, (&Sink{Type: SinkTypeWebhook, URL: slow.URL, Timeout: "soon"}).Validate())
+
+	out := filepath.Join(dir, "out.json")
+	s = &Sink{Type: SinkTypeCommand, Run: "cat > " + out + " && test $SQLETON_ROWS = 2"}
+	require.NoError(t, s.Write(ctx, info, testRows()))
+	b, err = os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"status": "shipped"`)
+
+	s = &Sink{Type: SinkTypeCommand, Run: "echo oops && exit 1"}
+	err = s.Write(ctx, info, testRows())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+}
+
+func TestRunJob(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	job := &Job{
+		Name:     "orders",
+		Command:  "shop orders",
+		Schedule: "@hourly",
+		Sinks: []*Sink{
+			{Type: SinkTypeCommand, Run: "exit 1"},
+			{Type: SinkTypeFile, Path: filepath.Join(dir, "orders.csv")},
+		},
+	}
+	require.NoError(t, job.Validate())
+
+	s := NewScheduler([]*Job{job}, func(ctx context.Context, job *Job) ([]types.Row, error) {
+		return testRows(), nil
+	})
+	r := s.RunJob(ctx, job)
+	assert.Equal(t, 2, r.Rows)
+	// the other sinks are written when one fails
+	require.Error(t, r.Error)
+	_, err := os.Stat(filepath.Join(dir, "orders.csv"))
+	assert.NoError(t, err)
+
+	s = NewScheduler([]*Job{job}, func(ctx context.Context, job *Job) ([]types.Row, error) {
+		return nil, errors.New("no such table")
+	})
+	r = s.RunJob(ctx, job)
+	assert.EqualError(t, r.Error, "no such table")
+}
+
+func TestRun(t *testing.T) {
+	job := &Job{
+		Name:     "often",
+		Command:  "shop orders",
+		Schedule: "@every 1s",
+		Sinks:    []*Sink{{Type: SinkTypeCommand, Run: "true"}},
+	}
+	runs := make(chan bool, 10)
+	s := NewScheduler([]*Job{job}, func(ctx context.Context, job *Job) ([]types.Row, error) {
+		runs <- true
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job didn't run")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,117 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// RunFunc runs the command of a job and returns its rows.
+type RunFunc func(ctx context.Context, job *Job) ([]types.Row, error)
+
+// Result is the outcome of a run of a job.
+type Result struct {
+	Job       string
+	StartedAt time.Time
+	Duration  time.Duration
+	Rows      int
+	// Error is the error of the command or of the sinks, the rows are written to
+	// the other sinks if one of them fails.
+	Error error
+}
+
+// Scheduler runs the jobs of a schedule file on their schedules.
+type Scheduler struct {
+	jobs []*Job
+	run  RunFunc
+}
+
+func NewScheduler(jobs []*Job, run RunFunc) *Scheduler {
+	return &Scheduler{
+		jobs: jobs,
+		run:  run,
+	}
+}
+
+// Run runs the jobs on their schedules until ctx is cancelled, then waits for the
+// running jobs to finish. A job isn't started again while its previous run is still running.
+func (s *Scheduler) Run(ctx context.Context) error {
+	logger := &cronLogger{}
+	c := cron.New(cron.WithChain(cron.Recover(logger), cron.SkipIfStillRunning(logger)), cron.WithLogger(logger))
+	for _, job := range s.jobs {
+		job_ := job
+		if job_.schedule == nil {
+			err := job_.Validate()
+			if err != nil {
+				return errors.Wrapf(err, "job %s", job_.Name)
+			}
+		}
+		id := c.Schedule(job_.schedule, cron.FuncJob(func() {
+			s.RunJob(ctx, job_)
+		}))
+		log.Info().Str("job", job_.Name).Str("schedule", job_.Schedule).
+			Time("next", c.Entry(id).Schedule.Next(time.Now())).Msg("Scheduled job")
+	}
+
+	c.Start()
+	<-ctx.Done()
+	log.Info().Msg("Stopping, waiting for the running jobs")
+	<-c.Stop().Done()
+	return nil
+}
+
+// RunJob runs job once and writes its rows to its sinks.
+func (s *Scheduler) RunJob(ctx context.Context, job *Job) *Result {
+	r := &Result{
+		Job:       job.Name,
+		StartedAt: time.Now(),
+	}
+	log.Info().Str("job", job.Name).Str("command", job.Command).Msg("Running job")
+
+	rows, err := s.run(ctx, job)
+	if err == nil {
+		r.Rows = len(rows)
+		info := &RunInfo{
+			Job:     job.Name,
+			Command: job.Command,
+			Time:    r.StartedAt,
+		}
+		failed := []string{}
+		for _, sink := range job.Sinks {
+			err_ := sink.Write(ctx, info, rows)
+			if err_ != nil {
+				log.Error().Err(err_).Str("job", job.Name).Str("sink", sink.String()).Msg("Could not write rows")
+				failed = append(failed, fmt.Sprintf("%s: %v", sink, err_))
+			}
+		}
+		if len(failed) > 0 {
+			err = errors.Errorf("%d of %d sinks failed: %s", len(failed), len(job.Sinks), strings.Join(failed, "; "))
+		}
+	}
+	r.Duration = time.Since(r.StartedAt)
+	r.Error = err
+
+	if err != nil {
+		log.Error().Err(err).Str("job", job.Name).Dur("duration", r.Duration).Int("rows", r.Rows).Msg("Job failed")
+	} else {
+		log.Info().Str("job", job.Name).Dur("duration", r.Duration).Int("rows", r.Rows).Msg("Job done")
+	}
+	return r
+}
+
+// cronLogger logs the messages of the cron scheduler with zerolog.
+type cronLogger struct{}
+
+func (l *cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	log.Debug().Fields(keysAndValues).Msg(msg)
+}
+
+func (l *cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	log.Error().Err(err).Fields(keysAndValues).Msg(fmt.Sprintf("cron: %s", msg))
+}
@@ -0,0 +1,313 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/helpers/templating"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/sink"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SinkType string
+
+const (
+	// SinkTypeFile writes the rows to a file in a glazed output format.
+	SinkTypeFile SinkType = "file"
+	// SinkTypeSqlite appends the rows to a table of a sqlite database.
+	SinkTypeSqlite SinkType = "sqlite"
+	// SinkTypeWebhook posts the rows as JSON to a URL.
+	SinkTypeWebhook SinkType = "webhook"
+	// SinkTypeCommand runs a shell command with the rows on its standard input.
+	SinkTypeCommand SinkType = "command"
+)
+
+// DefaultWebhookTimeout is the time a webhook sink waits for the server to respond.
+const DefaultWebhookTimeout = 30 * time.Second
+
+// Sink is where the rows of a job are written to after each run.
+//
+// Path and Run are templates, rendered with the RunInfo of the run.
+type Sink struct {
+	Type SinkType `yaml:"type"`
+	// Path is the file of file sinks and the database of sqlite sinks.
+	Path string `yaml:"path,omitempty"`
+	// Format is the glazed output format of file and command sinks, csv and json by default.
+	Format string `yaml:"format,omitempty"`
+	Table  string `yaml:"table,omitempty"`
+	// TimestampColumn is a column added to the rows of sqlite sinks, set to the time of the run,
+	// to tell apart the rows of each run.
+	TimestampColumn string            `yaml:"timestamp-column,omitempty"`
+	URL             string            `yaml:"url,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`
+	// Timeout is the time webhook sinks wait for the response, DefaultWebhookTimeout if empty.
+	Timeout string `yaml:"timeout,omitempty"`
+	Run     string `yaml:"run,omitempty"`
+}
+
+// RunInfo describes a run of a job, it is the data of the sink templates.
+type RunInfo struct {
+	Job     string
+	Command string
+	Time    time.Time
+}
+
+func (s *Sink) Validate() error {
+	switch s.Type {
+	case SinkTypeFile:
+		if s.Path == "" {
+			return errors.New("file sink without path")
+		}
+	case SinkTypeSqlite:
+		if s.Path == "" || s.Table == "" {
+			return errors.New("sqlite sink without path or table")
+		}
+	case SinkTypeWebhook:
+		if s.URL == "" {
+			return errors.New("webhook sink without url")
+		}
+		_, err := s.timeout()
+		if err != nil {
+			return err
+		}
+	case SinkTypeCommand:
+		if s.Run == "" {
+			return errors.New("command sink without run")
+		}
+	default:
+		return errors.Errorf("unknown sink type %q, must be one of file, sqlite, webhook or command", s.Type)
+	}
+	return nil
+}
+
+func (s *Sink) String() string {
+	switch s.Type {
+	case SinkTypeFile:
+		return fmt.Sprintf("file %s", s.Path)
+	case SinkTypeSqlite:
+		return fmt.Sprintf("sqlite %s:%s", s.Path, s.Table)
+	case SinkTypeWebhook:
+		return fmt.Sprintf("webhook %s", s.URL)
+	default:
+		return fmt.Sprintf("command %s", s.Run)
+	}
+}
+
+// Write writes the rows of the run described by info.
+func (s *Sink) Write(ctx context.Context, info *RunInfo, rows []types.Row) error {
+	switch s.Type {
+	case SinkTypeFile:
+		return s.writeFile(ctx, info, rows)
+	case SinkTypeSqlite:
+		return s.writeSqlite(ctx, info, rows)
+	case SinkTypeWebhook:
+		return s.postWebhook(ctx, info, rows)
+	case SinkTypeCommand:
+		return s.runCommand(ctx, info, rows)
+	default:
+		return errors.Errorf("unknown sink type %q", s.Type)
+	}
+}
+
+func (s *Sink) writeFile(ctx context.Context, info *RunInfo, rows []types.Row) error {
+	path, err := templating.RenderTemplateString(s.Path, info)
+	if err != nil {
+		return errors.Wrap(err, "could not render path")
+	}
+	b, err := FormatRows(ctx, rows, s.format("csv"))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+func (s *Sink) writeSqlite(ctx context.Context, info *RunInfo, rows []types.Row) error {
+	path, err := templating.RenderTemplateString(s.Path, info)
+	if err != nil {
+		return errors.Wrap(err, "could not render path")
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	db, err := sqlx.Connect("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return errors.Wrapf(err, "could not open %s", path)
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	w, err := sink.NewTableWriter(db, s.Table, sink.WithMode(sink.ModeAppend))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if s.TimestampColumn != "" {
+			row_ := types.NewRow(types.MRP(s.TimestampColumn, info.Time))
+			for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+				row_.Set(pair.Key, pair.Value)
+			}
+			row = row_
+		}
+		err = w.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close(ctx)
+}
+
+type webhookPayload struct {
+	Job     string      `json:"job"`
+	Command string      `json:"command"`
+	Time    time.Time   `json:"time"`
+	Rows    []types.Row `json:"rows"`
+}
+
+func (s *Sink) postWebhook(ctx context.Context, info *RunInfo, rows []types.Row) error {
+	if rows == nil {
+		rows = []types.Row{}
+	}
+	b, err := json.Marshal(&webhookPayload{
+		Job:     info.Job,
+		Command: info.Command,
+		Time:    info.Time,
+		Rows:    rows,
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not encode rows")
+	}
+
+	timeout, err := s.timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Sink) timeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return DefaultWebhookTimeout, nil
+	}
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, errors.Errorf("invalid webhook timeout %q, use a duration like 10s", s.Timeout)
+	}
+	return timeout, nil
+}
+
+func (s *Sink) runCommand(ctx context.Context, info *RunInfo, rows []types.Row) error {
+	run, err := templating.RenderTemplateString(s.Run, info)
+	if err != nil {
+		return errors.Wrap(err, "could not render command")
+	}
+	b, err := FormatRows(ctx, rows, s.format("json"))
+	if err != nil {
+		return err
+	}
+
+	c := exec.CommandContext(ctx, "sh", "-c", run)
+	c.Stdin = bytes.NewReader(b)
+	c.Env = append(os.Environ(),
+		"SQLETON_JOB="+info.Job,
+		"SQLETON_COMMAND="+info.Command,
+		fmt.Sprintf("SQLETON_ROWS=%d", len(rows)),
+	)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "command failed: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s *Sink) format(default_ string) string {
+	if s.Format == "" {
+		return default_
+	}
+	return s.Format
+}
+
+// FormatRows renders rows in the glazed output format, as --output format would.
+func FormatRows(ctx context.Context, rows []types.Row, format string) ([]byte, error) {
+	glazedParameterLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, err
+	}
+	parser, err := cli.NewCobraParserFromCommandDescription(
+		cmds.NewCommandDescription("sink", cmds.WithLayers(glazedParameterLayer)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = parser.Cmd.ParseFlags([]string{"--output", format})
+	if err != nil {
+		return nil, err
+	}
+	_, ps, err := parser.Parse([]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	gp, err := settings.SetupTableProcessor(ps)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	_, err = settings.SetupProcessorOutput(gp, ps, buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = gp.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
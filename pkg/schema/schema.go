@@ -0,0 +1,301 @@
+package schema
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrTableNotFound is returned by ListColumns when the table doesn't exist.
+var ErrTableNotFound = errors.New("table not found or has no columns")
+
+// Table describes a table (or view) as reported by the database catalog.
+type Table struct {
+	Schema  string `db:"table_schema"`
+	Name    string `db:"table_name"`
+	Type    string `db:"table_type"`
+	Comment string `db:"table_comment"`
+}
+
+// Column describes a single column of a table as reported by the database catalog.
+//
+// Type is the full column type as the database prints it (say, `varchar(255)`),
+// while DataType is just the base type (`varchar`).
+type Column struct {
+	Table      string `db:"table_name"`
+	Name       string `db:"column_name"`
+	Type       string `db:"column_type"`
+	DataType   string `db:"data_type"`
+	Nullable   bool   `db:"is_nullable"`
+	PrimaryKey bool   `db:"is_primary_key"`
+	Comment    string `db:"column_comment"`
+	Position   int    `db:"ordinal_position"`
+}
+
+// ColumnKind classifies column types, for example to decide which filters apply to a column.
+type ColumnKind string
+
+const (
+	KindString ColumnKind = "string"
+	KindInt    ColumnKind = "int"
+	KindFloat  ColumnKind = "float"
+	KindDate   ColumnKind = "date"
+	KindBool   ColumnKind = "bool"
+	// KindOther covers the types that are none of the above, like blobs or json.
+	KindOther ColumnKind = "other"
+)
+
+// Kind returns the kind of the column, from its DataType.
+func (c *Column) Kind() ColumnKind {
+	t := strings.ToLower(c.DataType)
+	switch {
+	case t == "date" || t == "datetime" || strings.HasPrefix(t, "timestamp"):
+		return KindDate
+	case t == "bool" || t == "boolean" || t == "bit":
+		return KindBool
+	case isIntType(t):
+		return KindInt
+	case t == "decimal" || t == "numeric" || t == "real" || t == "money" ||
+		strings.HasPrefix(t, "float") || strings.HasPrefix(t, "double"):
+		return KindFloat
+	case strings.Contains(t, "char") || strings.Contains(t, "text") || strings.Contains(t, "clob") ||
+		t == "enum" || t == "set" || t == "uuid" || t == "citext" || t == "string":
+		return KindString
+	}
+	return KindOther
+}
+
+func isIntType(t string) bool {
+	fields := strings.Fields(t)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "int", "integer", "bigint", "smallint", "tinyint", "mediumint",
+		"int2", "int4", "int8", "serial", "bigserial", "smallserial", "year":
+		return true
+	}
+	return false
+}
+
+// SplitTableName splits a possibly schema-qualified table name into its schema and table part.
+// The schema is empty if the name is not qualified.
+func SplitTableName(name string) (string, string) {
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		return name[:idx], name[idx+1:]
+	}
+	return "", name
+}
+
+// ListTables returns the tables and views of the current database (or schema, for postgres).
+func ListTables(ctx context.Context, db *sqlx.DB) ([]*Table, error) {
+	var query string
+
+	switch db.DriverName() {
+	case "mysql":
+		query = `
+SELECT TABLE_SCHEMA AS table_schema, TABLE_NAME AS table_name,
+       TABLE_TYPE AS table_type, TABLE_COMMENT AS table_comment
+FROM information_schema.TABLES
+WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY TABLE_NAME`
+	case "postgres":
+		query = `
+SELECT t.table_schema, t.table_name, t.table_type,
+       COALESCE(obj_description(c.oid, 'pg_class'), '') AS table_comment
+FROM information_schema.tables t
+LEFT JOIN pg_catalog.pg_namespace n ON n.nspname = t.table_schema
+LEFT JOIN pg_catalog.pg_class c ON c.relname = t.table_name AND c.relnamespace = n.oid
+WHERE t.table_schema NOT IN ('pg_catalog', 'information_schema')
+ORDER BY t.table_schema, t.table_name`
+	case "sqlite3", "sqlite":
+		query = `
+SELECT 'main' AS table_schema, name AS table_name,
+       CASE type WHEN 'view' THEN 'VIEW' ELSE 'BASE TABLE' END AS table_type,
+       '' AS table_comment
+FROM sqlite_master
+WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+ORDER BY name`
+	default:
+		return nil, errors.Errorf("schema introspection is not supported for driver %s", db.DriverName())
+	}
+
+	ret := []*Table{}
+	err := db.SelectContext(ctx, &ret, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list tables")
+	}
+	return ret, nil
+}
+
+// ListColumns returns the columns of the given table, in ordinal order.
+// The table name can be qualified with a schema.
+func ListColumns(ctx context.Context, db *sqlx.DB, table string) ([]*Column, error) {
+	schema_, name := SplitTableName(table)
+
+	var query string
+	var args []interface{}
+
+	switch db.DriverName() {
+	case "mysql":
+		query = `
+SELECT TABLE_NAME AS table_name, COLUMN_NAME AS column_name,
+       COLUMN_TYPE AS column_type, DATA_TYPE AS data_type,
+       IS_NULLABLE = 'YES' AS is_nullable, COLUMN_KEY = 'PRI' AS is_primary_key,
+       COLUMN_COMMENT AS column_comment, ORDINAL_POSITION AS ordinal_position
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+ORDER BY ORDINAL_POSITION`
+		args = []interface{}{schema_, name}
+	case "postgres":
+		query = `
+SELECT c.table_name, c.column_name,
+       format_type(a.atttypid, a.atttypmod) AS column_type, c.data_type,
+       c.is_nullable = 'YES' AS is_nullable,
+       EXISTS (
+         SELECT 1 FROM pg_catalog.pg_index i
+         WHERE i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY(i.indkey)
+       ) AS is_primary_key,
+       COALESCE(col_description(a.attrelid, a.attnum), '') AS column_comment,
+       c.ordinal_position
+FROM information_schema.columns c
+JOIN pg_catalog.pg_namespace n ON n.nspname = c.table_schema
+JOIN pg_catalog.pg_class cl ON cl.relname = c.table_name AND cl.relnamespace = n.oid
+JOIN pg_catalog.pg_attribute a ON a.attrelid = cl.oid AND a.attname = c.column_name
+WHERE c.table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND c.table_name = $2
+ORDER BY c.ordinal_position`
+		args = []interface{}{schema_, name}
+	case "sqlite3", "sqlite":
+		query = `
+SELECT ? AS table_name, name AS column_name,
+       type AS column_type, lower(type) AS data_type,
+       "notnull" = 0 AS is_nullable, pk > 0 AS is_primary_key,
+       '' AS column_comment, cid + 1 AS ordinal_position
+FROM pragma_table_info(?)
+ORDER BY cid`
+		args = []interface{}{name, name}
+	default:
+		return nil, errors.Errorf("schema introspection is not supported for driver %s", db.DriverName())
+	}
+
+	ret := []*Column{}
+	err := db.SelectContext(ctx, &ret, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list columns of %s", table)
+	}
+	if len(ret) == 0 {
+		return nil, errors.Wrapf(ErrTableNotFound, "could not list columns of %s", table)
+	}
+
+	// strip the length / precision from the base type, sqlite only has the full declared type
+	for _, c := range ret {
+		if idx := strings.Index(c.DataType, "("); idx >= 0 {
+			c.DataType = strings.TrimSpace(c.DataType[:idx])
+		}
+	}
+
+	return ret, nil
+}
+
+// ForeignKey describes a foreign key constraint of a table. Columns and ReferencedColumns
+// are in the order of the constraint.
+type ForeignKey struct {
+	Name              string
+	Table             string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+}
+
+type foreignKeyColumn struct {
+	Name             string `db:"constraint_name"`
+	Table            string `db:"table_name"`
+	Column           string `db:"column_name"`
+	ReferencedTable  string `db:"referenced_table_name"`
+	ReferencedColumn string `db:"referenced_column_name"`
+}
+
+// ListForeignKeys returns the foreign keys of the given table.
+// The table name can be qualified with a schema.
+func ListForeignKeys(ctx context.Context, db *sqlx.DB, table string) ([]*ForeignKey, error) {
+	schema_, name := SplitTableName(table)
+
+	var query string
+	var args []interface{}
+
+	switch db.DriverName() {
+	case "mysql":
+		query = `
+SELECT CONSTRAINT_NAME AS constraint_name, TABLE_NAME AS table_name, COLUMN_NAME AS column_name,
+       REFERENCED_TABLE_NAME AS referenced_table_name, REFERENCED_COLUMN_NAME AS referenced_column_name
+FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+  AND REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`
+		args = []interface{}{schema_, name}
+	case "postgres":
+		query = `
+SELECT c.conname AS constraint_name, cl.relname AS table_name, a.attname AS column_name,
+       rcl.relname AS referenced_table_name, ra.attname AS referenced_column_name
+FROM pg_catalog.pg_constraint c
+JOIN pg_catalog.pg_class cl ON cl.oid = c.conrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = cl.relnamespace
+JOIN pg_catalog.pg_class rcl ON rcl.oid = c.confrelid
+CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, position)
+JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+JOIN pg_catalog.pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum
+WHERE c.contype = 'f' AND n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND cl.relname = $2
+ORDER BY c.conname, k.position`
+		args = []interface{}{schema_, name}
+	case "sqlite3", "sqlite":
+		query = `
+SELECT 'fk_' || id AS constraint_name, ? AS table_name, "from" AS column_name,
+       "table" AS referenced_table_name, COALESCE("to", '') AS referenced_column_name
+FROM pragma_foreign_key_list(?)
+ORDER BY id, seq`
+		args = []interface{}{name, name}
+	default:
+		return nil, errors.Errorf("schema introspection is not supported for driver %s", db.DriverName())
+	}
+
+	rows := []*foreignKeyColumn{}
+	err := db.SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list foreign keys of %s", table)
+	}
+
+	ret := []*ForeignKey{}
+	var current *ForeignKey
+	for _, r := range rows {
+		if current == nil || current.Name != r.Name {
+			current = &ForeignKey{Name: r.Name, Table: r.Table, ReferencedTable: r.ReferencedTable}
+			ret = append(ret, current)
+		}
+		current.Columns = append(current.Columns, r.Column)
+		current.ReferencedColumns = append(current.ReferencedColumns, r.ReferencedColumn)
+	}
+
+	// sqlite leaves out the referenced columns when the key references the primary key
+	for _, fk := range ret {
+		if fk.ReferencedColumns[0] != "" {
+			continue
+		}
+		columns, err := ListColumns(ctx, db, fk.ReferencedTable)
+		if err != nil {
+			return nil, err
+		}
+		fk.ReferencedColumns = []string{}
+		for _, c := range columns {
+			if c.PrimaryKey {
+				fk.ReferencedColumns = append(fk.ReferencedColumns, c.Name)
+			}
+		}
+		if len(fk.ReferencedColumns) != len(fk.Columns) {
+			return nil, errors.Errorf("could not resolve the columns referenced by foreign key %s of %s", fk.Name, table)
+		}
+	}
+
+	return ret, nil
+}
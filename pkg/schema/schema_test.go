@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE test (id INTEGER PRIMARY KEY, name VARCHAR(255) NOT NULL, created_at DATETIME)")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE VIEW test_names AS SELECT name FROM test")
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestListTables(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+
+	tables, err := ListTables(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, tables, 2)
+	assert.Equal(t, "test", tables[0].Name)
+	assert.Equal(t, "BASE TABLE", tables[0].Type)
+	assert.Equal(t, "test_names", tables[1].Name)
+	assert.Equal(t, "VIEW", tables[1].Type)
+}
+
+func TestListColumns(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+
+	columns, err := ListColumns(context.Background(), db, "test")
+	require.NoError(t, err)
+	require.Len(t, columns, 3)
+
+	assert.Equal(t, "id", columns[0].Name)
+	assert.True(t, columns[0].PrimaryKey)
+	assert.Equal(t, "name", columns[1].Name)
+	assert.Equal(t, "VARCHAR(255)", columns[1].Type)
+	assert.Equal(t, "varchar", columns[1].DataType)
+	assert.False(t, columns[1].Nullable)
+	assert.Equal(t, 3, columns[2].Position)
+
+	_, err = ListColumns(context.Background(), db, "does_not_exist")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestListForeignKeys(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Exec(`CREATE TABLE comments (
+		id INTEGER PRIMARY KEY,
+		test_id INTEGER REFERENCES test,
+		parent_id INTEGER REFERENCES comments(id)
+	)`)
+	require.NoError(t, err)
+
+	fks, err := ListForeignKeys(context.Background(), db, "comments")
+	require.NoError(t, err)
+	require.Len(t, fks, 2)
+	byTable := map[string]*ForeignKey{}
+	for _, fk := range fks {
+		byTable[fk.ReferencedTable] = fk
+	}
+	assert.Equal(t, []string{"test_id"}, byTable["test"].Columns)
+	assert.Equal(t, []string{"id"}, byTable["test"].ReferencedColumns)
+	assert.Equal(t, []string{"parent_id"}, byTable["comments"].Columns)
+	assert.Equal(t, []string{"id"}, byTable["comments"].ReferencedColumns)
+
+	fks, err = ListForeignKeys(context.Background(), db, "test")
+	require.NoError(t, err)
+	assert.Empty(t, fks)
+}
+
+func TestColumnKind(t *testing.T) {
+	tests := map[string]ColumnKind{
+		"varchar":                     KindString,
+		"character varying":           KindString,
+		"longtext":                    KindString,
+		"bigint":                      KindInt,
+		"integer":                     KindInt,
+		"tinyint":                     KindInt,
+		"numeric":                     KindFloat,
+		"double precision":            KindFloat,
+		"date":                        KindDate,
+		"timestamp without time zone": KindDate,
+		"datetime":                    KindDate,
+		"boolean":                     KindBool,
+		"blob":                        KindOther,
+		"jsonb":                       KindOther,
+		"interval":                    KindOther,
+		"point":                       KindOther,
+		"int unsigned":                KindInt,
+	}
+	for dataType, kind := range tests {
+		assert.Equal(t, kind, (&Column{DataType: dataType}).Kind(), dataType)
+	}
+}
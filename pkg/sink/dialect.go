@@ -0,0 +1,172 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindTime
+	kindString
+)
+
+// dialect covers the differences between the supported databases when creating and filling tables.
+type dialect struct {
+	driver string
+	// maxParameters is the maximum number of placeholders in a single statement
+	maxParameters int
+}
+
+func newDialect(driver string) (*dialect, error) {
+	switch driver {
+	case "mysql", "postgres":
+		return &dialect{driver: driver, maxParameters: 65535}, nil
+	case "sqlite3", "sqlite":
+		return &dialect{driver: "sqlite3", maxParameters: 32766}, nil
+	default:
+		return nil, errors.Errorf("writing to %s databases is not supported", driver)
+	}
+}
+
+func (d *dialect) quote(name string) string {
+	if d.driver == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteTable quotes a possibly schema-qualified table name.
+func (d *dialect) quoteTable(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = d.quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// columnType returns the type used for columns created out of values of kind k.
+// MySQL can't index TEXT columns without a prefix length, so string keys are VARCHAR there.
+func (d *dialect) columnType(k kind, isKey bool) string {
+	switch d.driver {
+	case "mysql":
+		switch k {
+		case kindBool:
+			return "BOOLEAN"
+		case kindInt:
+			return "BIGINT"
+		case kindFloat:
+			return "DOUBLE"
+		case kindTime:
+			return "DATETIME(6)"
+		}
+		if isKey {
+			return "VARCHAR(255)"
+		}
+		return "TEXT"
+	case "postgres":
+		switch k {
+		case kindBool:
+			return "BOOLEAN"
+		case kindInt:
+			return "BIGINT"
+		case kindFloat:
+			return "DOUBLE PRECISION"
+		case kindTime:
+			return "TIMESTAMP"
+		}
+		return "TEXT"
+	default:
+		switch k {
+		case kindBool:
+			return "BOOLEAN"
+		case kindInt:
+			return "INTEGER"
+		case kindFloat:
+			return "REAL"
+		case kindTime:
+			return "DATETIME"
+		}
+		return "TEXT"
+	}
+}
+
+// upsertClause returns the clause updating the non-key columns of rows that conflict on keys.
+func (d *dialect) upsertClause(columns []string, keys []string) string {
+	updates := []string{}
+	for _, c := range columns {
+		if contains(keys, c) {
+			continue
+		}
+		if d.driver == "mysql" {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", d.quote(c), d.quote(c)))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", d.quote(c), d.quote(c)))
+		}
+	}
+
+	if d.driver == "mysql" {
+		if len(updates) == 0 {
+			updates = append(updates, fmt.Sprintf("%s = %s", d.quote(keys[0]), d.quote(keys[0])))
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+
+	quotedKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		quotedKeys = append(quotedKeys, d.quote(k))
+	}
+	if len(updates) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quotedKeys, ", "))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedKeys, ", "), strings.Join(updates, ", "))
+}
+
+func valueKind(v interface{}) kind {
+	switch v.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return kindInt
+	case float32, float64:
+		return kindFloat
+	case time.Time, *time.Time:
+		return kindTime
+	default:
+		return kindString
+	}
+}
+
+// inferKind returns the kind that can hold all the values of column in rows.
+// Integers mixed with floats are floats, any other mix falls back to strings.
+func inferKind(rows []types.Row, column string) kind {
+	ret := kindNull
+	for _, row := range rows {
+		v, ok := row.Get(column)
+		if !ok {
+			continue
+		}
+		k := valueKind(v)
+		switch {
+		case k == kindNull || k == ret:
+		case ret == kindNull:
+			ret = k
+		case (ret == kindInt && k == kindFloat) || (ret == kindFloat && k == kindInt):
+			ret = kindFloat
+		default:
+			return kindString
+		}
+	}
+	return ret
+}
@@ -0,0 +1,157 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var readerHandlerCount int64
+
+func (d *dialect) hasFastPath(mode Mode) bool {
+	return d.driver == "sqlite3" || mode != ModeUpsert
+}
+
+// insertFast inserts the pending rows with the bulk loading mechanism of the database.
+func (w *TableWriter) insertFast(ctx context.Context, tx *sqlx.Tx, d *dialect, columns []string) error {
+	switch d.driver {
+	case "postgres":
+		return w.copyIn(ctx, tx, columns)
+	case "mysql":
+		return w.loadData(ctx, tx, d, columns)
+	default:
+		return w.insertPrepared(ctx, tx, d, columns)
+	}
+}
+
+// insertPrepared inserts the rows one by one with a single prepared statement.
+// This is the fastest way to insert into sqlite, as there is no network roundtrip.
+func (w *TableWriter) insertPrepared(ctx context.Context, tx *sqlx.Tx, d *dialect, columns []string) error {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	query := w.insertClause(d, columns) + placeholders + w.conflictClause(d, columns)
+
+	stmt, err := tx.PreparexContext(ctx, w.db.Rebind(query))
+	if err != nil {
+		return errors.Wrapf(err, "could not prepare insert into %s", w.table)
+	}
+	defer func(stmt *sqlx.Stmt) {
+		_ = stmt.Close()
+	}(stmt)
+
+	for _, row := range w.pending {
+		_, err = stmt.ExecContext(ctx, w.rowValues(row, columns)...)
+		if err != nil {
+			return errors.Wrapf(err, "could not insert into %s", w.table)
+		}
+	}
+	return nil
+}
+
+// copyIn streams the rows with COPY FROM STDIN.
+func (w *TableWriter) copyIn(ctx context.Context, tx *sqlx.Tx, columns []string) error {
+	var query string
+	if schema_, table := schema.SplitTableName(w.table); schema_ != "" {
+		query = pq.CopyInSchema(schema_, table, columns...)
+	} else {
+		query = pq.CopyIn(table, columns...)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not start copy into %s", w.table)
+	}
+	for _, row := range w.pending {
+		_, err = stmt.ExecContext(ctx, w.rowValues(row, columns)...)
+		if err != nil {
+			_ = stmt.Close()
+			return errors.Wrapf(err, "could not copy into %s", w.table)
+		}
+	}
+	// an Exec without arguments flushes the buffered rows
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		_ = stmt.Close()
+		return errors.Wrapf(err, "could not copy into %s", w.table)
+	}
+	return stmt.Close()
+}
+
+// loadData sends the rows as tab separated values with LOAD DATA LOCAL INFILE,
+// through a reader handler registered with the mysql driver.
+func (w *TableWriter) loadData(ctx context.Context, tx *sqlx.Tx, d *dialect, columns []string) error {
+	buf := &bytes.Buffer{}
+	for _, row := range w.pending {
+		for i, v := range w.rowValues(row, columns) {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(mysqlTSVValue(v))
+		}
+		buf.WriteByte('\n')
+	}
+
+	name := fmt.Sprintf("sqleton-%d", atomic.AddInt64(&readerHandlerCount, 1))
+	mysql.RegisterReaderHandler(name, func() io.Reader {
+		return bytes.NewReader(buf.Bytes())
+	})
+	defer mysql.DeregisterReaderHandler(name)
+
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quoted = append(quoted, d.quote(c))
+	}
+	query := fmt.Sprintf(
+		`LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4 `+
+			`FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (%s)`,
+		name, d.quoteTable(w.table), strings.Join(quoted, ", "))
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not load data into %s (is local_infile enabled on the server?)", w.table)
+	}
+	return nil
+}
+
+// mysqlTSVValue formats a value for LOAD DATA with the default escaping, where \N is NULL.
+func mysqlTSVValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return `\N`
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	case *time.Time:
+		if v == nil {
+			return `\N`
+		}
+		return v.Format("2006-01-02 15:04:05.999999")
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	return strings.NewReplacer(
+		`\`, `\\`,
+		"\t", `\t`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\x00", `\0`,
+	).Replace(s)
+}
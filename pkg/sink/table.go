@@ -0,0 +1,492 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Mode describes what happens to the rows already in the destination table.
+type Mode string
+
+const (
+	// ModeAppend inserts the rows, leaving the existing ones untouched.
+	ModeAppend Mode = "append"
+	// ModeReplace deletes all the existing rows before inserting.
+	ModeReplace Mode = "replace"
+	// ModeUpsert inserts the rows, updating the existing rows with the same keys.
+	ModeUpsert Mode = "upsert"
+)
+
+var Modes = []string{string(ModeAppend), string(ModeReplace), string(ModeUpsert)}
+
+// Stats reports the progress of a TableWriter.
+type Stats struct {
+	Rows    int64
+	Batches int
+	// Created is set if the destination table was created by the writer
+	Created bool
+	// Deleted is the number of rows deleted in replace mode
+	Deleted int64
+	Started time.Time
+}
+
+var _ middlewares.Processor = (*TableWriter)(nil)
+
+// TableWriter is a glazed processor that inserts the rows it is passed into a table, in batches.
+//
+// The destination table is created on the first batch if it doesn't exist, with column types
+// inferred from the values of that batch unless declared with WithColumnTypes.
+// Each batch is inserted in its own transaction, except in replace mode where the existing
+// rows are deleted and all the batches inserted in a single transaction, committed by Close,
+// so that a failed copy leaves the table untouched.
+type TableWriter struct {
+	db          *sqlx.DB
+	table       string
+	mode        Mode
+	keys        []string
+	batchSize   int
+	columnTypes map[string]string
+	onBatch     func(stats Stats)
+	createTable bool
+	fastPath    bool
+
+	// columns are the destination columns rows are inserted into, set once the table is prepared
+	columns []string
+	// columnNames maps the (lower case) row keys to the destination columns
+	columnNames map[string]string
+	prepared    bool
+	pending     []types.Row
+	stats       Stats
+	// tx is the transaction spanning the whole write in replace mode
+	tx *sqlx.Tx
+}
+
+type TableWriterOption func(*TableWriter)
+
+func WithMode(mode Mode) TableWriterOption {
+	return func(w *TableWriter) {
+		w.mode = mode
+	}
+}
+
+// WithKeys sets the columns identifying a row, used to resolve conflicts in upsert mode
+// and as primary key when creating the table.
+func WithKeys(keys ...string) TableWriterOption {
+	return func(w *TableWriter) {
+		w.keys = keys
+	}
+}
+
+func WithBatchSize(batchSize int) TableWriterOption {
+	return func(w *TableWriter) {
+		w.batchSize = batchSize
+	}
+}
+
+// WithColumnTypes declares the SQL types of some columns when creating the table.
+func WithColumnTypes(columnTypes map[string]string) TableWriterOption {
+	return func(w *TableWriter) {
+		for k, v := range columnTypes {
+			w.columnTypes[k] = v
+		}
+	}
+}
+
+// WithCreateTable sets whether the destination table is created if it doesn't exist (the default).
+func WithCreateTable(createTable bool) TableWriterOption {
+	return func(w *TableWriter) {
+		w.createTable = createTable
+	}
+}
+
+// WithFastPath enables the bulk loading mechanism of the database when there is one:
+// COPY FROM STDIN on postgres, LOAD DATA LOCAL INFILE on mysql (which needs local_infile
+// to be enabled on the server) and a single prepared statement per batch on sqlite.
+// Upserts always use INSERT statements on mysql and postgres.
+func WithFastPath(fastPath bool) TableWriterOption {
+	return func(w *TableWriter) {
+		w.fastPath = fastPath
+	}
+}
+
+// WithProgress registers a callback called after every batch.
+func WithProgress(onBatch func(stats Stats)) TableWriterOption {
+	return func(w *TableWriter) {
+		w.onBatch = onBatch
+	}
+}
+
+func NewTableWriter(db *sqlx.DB, table string, options ...TableWriterOption) (*TableWriter, error) {
+	ret := &TableWriter{
+		db:          db,
+		table:       table,
+		mode:        ModeAppend,
+		batchSize:   1000,
+		columnTypes: map[string]string{},
+		createTable: true,
+		stats: Stats{
+			Started: time.Now(),
+		},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+
+	switch ret.mode {
+	case ModeAppend, ModeReplace:
+	case ModeUpsert:
+		if len(ret.keys) == 0 {
+			return nil, errors.New("upsert mode needs at least one key column")
+		}
+	default:
+		return nil, errors.Errorf("unknown mode %s, expected one of %s", ret.mode, strings.Join(Modes, ", "))
+	}
+	if ret.batchSize <= 0 {
+		return nil, errors.New("batch size must be positive")
+	}
+	if _, err := newDialect(db.DriverName()); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (w *TableWriter) Stats() Stats {
+	return w.stats
+}
+
+// Columns returns the destination columns, once the first batch has been written.
+func (w *TableWriter) Columns() []string {
+	return w.columns
+}
+
+func (w *TableWriter) AddRow(ctx context.Context, row types.Row) error {
+	w.pending = append(w.pending, row)
+	if len(w.pending) >= w.batchSize {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+// Close writes the remaining rows. In replace mode, the destination table is emptied
+// even if no rows were written.
+func (w *TableWriter) Close(ctx context.Context) error {
+	err := w.flush(ctx)
+	if w.tx == nil {
+		return err
+	}
+	if err != nil {
+		_ = w.Abort()
+		return err
+	}
+	err = w.tx.Commit()
+	w.tx = nil
+	if err != nil {
+		return errors.Wrapf(err, "could not commit the rows written to %s", w.table)
+	}
+	return nil
+}
+
+// Abort rolls back the rows written in replace mode, when the write fails before Close.
+// Batches that were already committed in the other modes are kept.
+func (w *TableWriter) Abort() error {
+	if w.tx == nil {
+		return nil
+	}
+	err := w.tx.Rollback()
+	w.tx = nil
+	return err
+}
+
+func (w *TableWriter) flush(ctx context.Context) error {
+	d, _ := newDialect(w.db.DriverName())
+
+	if !w.prepared {
+		err := w.prepare(ctx, d)
+		if err != nil {
+			return err
+		}
+	}
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	columns, err := w.batchColumns(w.pending)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return errors.Errorf("can't insert rows without columns into %s", w.table)
+	}
+
+	tx := w.tx
+	if tx == nil {
+		tx, err = w.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return errors.Wrap(err, "could not start transaction")
+		}
+		defer func() {
+			_ = tx.Rollback()
+		}()
+	}
+
+	if w.fastPath && d.hasFastPath(w.mode) {
+		err = w.insertFast(ctx, tx, d, columns)
+	} else {
+		err = w.insertBatch(ctx, tx, d, columns)
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.tx == nil {
+		err = tx.Commit()
+		if err != nil {
+			return errors.Wrap(err, "could not commit batch")
+		}
+	}
+
+	w.stats.Rows += int64(len(w.pending))
+	w.stats.Batches++
+	w.pending = w.pending[:0]
+	if w.onBatch != nil {
+		w.onBatch(w.stats)
+	}
+
+	return nil
+}
+
+// insertBatch inserts the pending rows with multi-row INSERT statements,
+// as many rows per statement as the placeholder limit of the database allows.
+func (w *TableWriter) insertBatch(ctx context.Context, tx *sqlx.Tx, d *dialect, columns []string) error {
+	perStatement := d.maxParameters / len(columns)
+	if perStatement > w.batchSize {
+		perStatement = w.batchSize
+	}
+	for start := 0; start < len(w.pending); start += perStatement {
+		end := start + perStatement
+		if end > len(w.pending) {
+			end = len(w.pending)
+		}
+		query, args := w.buildInsert(d, columns, w.pending[start:end])
+		_, err := tx.ExecContext(ctx, w.db.Rebind(query), args...)
+		if err != nil {
+			return errors.Wrapf(err, "could not insert into %s", w.table)
+		}
+	}
+	return nil
+}
+
+// prepare looks up the destination table, creating it out of the pending rows if it doesn't exist.
+func (w *TableWriter) prepare(ctx context.Context, d *dialect) error {
+	existing, err := schema.ListColumns(ctx, w.db, w.table)
+	if err != nil && !errors.Is(err, schema.ErrTableNotFound) {
+		return err
+	}
+
+	if len(existing) == 0 {
+		if !w.createTable {
+			return errors.Errorf("table %s doesn't exist", w.table)
+		}
+		if len(w.pending) == 0 {
+			// nothing to create the table from
+			return nil
+		}
+		columns := rowColumns(w.pending)
+		if len(columns) == 0 {
+			return errors.Errorf("can't create %s out of rows without columns", w.table)
+		}
+		err = w.create(ctx, d, columns)
+		if err != nil {
+			return err
+		}
+		w.stats.Created = true
+		w.setColumns(columns)
+	} else {
+		columns := make([]string, 0, len(existing))
+		for _, c := range existing {
+			columns = append(columns, c.Name)
+		}
+		w.setColumns(columns)
+	}
+
+	for _, k := range w.keys {
+		if _, ok := w.columnNames[strings.ToLower(k)]; !ok {
+			return errors.Errorf("key column %s is not a column of %s", k, w.table)
+		}
+	}
+
+	if w.mode == ModeReplace && !w.stats.Created {
+		tx, err := w.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return errors.Wrap(err, "could not start transaction")
+		}
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", d.quoteTable(w.table)))
+		if err != nil {
+			_ = tx.Rollback()
+			return errors.Wrapf(err, "could not empty %s", w.table)
+		}
+		w.stats.Deleted, _ = res.RowsAffected()
+		w.tx = tx
+	}
+
+	w.prepared = true
+	return nil
+}
+
+func (w *TableWriter) setColumns(columns []string) {
+	w.columns = columns
+	w.columnNames = map[string]string{}
+	for _, c := range columns {
+		w.columnNames[strings.ToLower(c)] = c
+	}
+}
+
+func (w *TableWriter) create(ctx context.Context, d *dialect, columns []string) error {
+	isKey := map[string]bool{}
+	for _, k := range w.keys {
+		isKey[k] = true
+	}
+
+	definitions := []string{}
+	for _, c := range columns {
+		type_, ok := w.columnTypes[c]
+		if !ok {
+			type_ = d.columnType(inferKind(w.pending, c), isKey[c])
+		}
+		definition := fmt.Sprintf("%s %s", d.quote(c), type_)
+		if isKey[c] {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+	}
+	if len(w.keys) > 0 {
+		keys := make([]string, 0, len(w.keys))
+		for _, k := range w.keys {
+			if !contains(columns, k) {
+				return errors.Errorf("key column %s is not a column of the copied rows", k)
+			}
+			keys = append(keys, d.quote(k))
+		}
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ", ")))
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", d.quoteTable(w.table), strings.Join(definitions, ",\n  "))
+	_, err := w.db.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not create table %s", w.table)
+	}
+	return nil
+}
+
+// batchColumns returns the destination columns present in the rows, in table order.
+// Only these columns are inserted (and updated, in upsert mode),
+// so that the other columns keep their default or current values.
+func (w *TableWriter) batchColumns(rows []types.Row) ([]string, error) {
+	present := map[string]bool{}
+	for _, row := range rows {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			c, ok := w.columnNames[strings.ToLower(pair.Key)]
+			if !ok {
+				return nil, errors.Errorf("column %s is not a column of %s", pair.Key, w.table)
+			}
+			present[c] = true
+		}
+	}
+
+	ret := []string{}
+	for _, c := range w.columns {
+		if present[c] {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// rowValues returns the values of row for the given destination columns, nil if missing.
+func (w *TableWriter) rowValues(row types.Row, columns []string) []interface{} {
+	ret := make([]interface{}, len(columns))
+	for i, c := range columns {
+		v, ok := row.Get(c)
+		if !ok {
+			v = w.lookup(row, c)
+		}
+		ret[i] = v
+	}
+	return ret
+}
+
+func (w *TableWriter) insertClause(d *dialect, columns []string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quoted = append(quoted, d.quote(c))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES ", d.quoteTable(w.table), strings.Join(quoted, ", "))
+}
+
+func (w *TableWriter) conflictClause(d *dialect, columns []string) string {
+	if w.mode != ModeUpsert {
+		return ""
+	}
+	keys := make([]string, 0, len(w.keys))
+	for _, k := range w.keys {
+		keys = append(keys, w.columnNames[strings.ToLower(k)])
+	}
+	return " " + d.upsertClause(columns, keys)
+}
+
+// buildInsert builds a multi-row insert statement with ? placeholders.
+func (w *TableWriter) buildInsert(d *dialect, columns []string, rows []types.Row) (string, []interface{}) {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for _, row := range rows {
+		args = append(args, w.rowValues(row, columns)...)
+		values = append(values, placeholders)
+	}
+
+	query := w.insertClause(d, columns) + strings.Join(values, ", ") + w.conflictClause(d, columns)
+	return query, args
+}
+
+// lookup returns the value of the destination column c in row, matching the keys case-insensitively.
+func (w *TableWriter) lookup(row types.Row, c string) interface{} {
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		if strings.EqualFold(pair.Key, c) {
+			return pair.Value
+		}
+	}
+	return nil
+}
+
+// rowColumns returns the columns of the rows, in the order they first appear.
+func rowColumns(rows []types.Row) []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			if !seen[pair.Key] {
+				seen[pair.Key] = true
+				ret = append(ret, pair.Key)
+			}
+		}
+	}
+	return ret
+}
+
+func contains(l []string, s string) bool {
+	for _, s_ := range l {
+		if s_ == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package sink
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/schema"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// every connection to :memory: is a different database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func writeRows(t *testing.T, w *TableWriter, rows ...types.Row) {
+	ctx := context.Background()
+	for _, row := range rows {
+		require.NoError(t, w.AddRow(ctx, row))
+	}
+	require.NoError(t, w.Close(ctx))
+}
+
+func TestTableWriterCreatesTable(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+
+	w, err := NewTableWriter(db, "posts", WithBatchSize(2), WithKeys("id"),
+		WithColumnTypes(map[string]string{"title": "VARCHAR(100)"}))
+	require.NoError(t, err)
+	writeRows(t, w,
+		types.NewRow(types.MRP("id", 1), types.MRP("title", "a"), types.MRP("score", 1)),
+		types.NewRow(types.MRP("id", 2), types.MRP("title", "b"), types.MRP("score", 1.5)),
+		types.NewRow(types.MRP("id", 3), types.MRP("title", nil), types.MRP("score", nil)),
+	)
+	assert.True(t, w.Stats().Created)
+	assert.Equal(t, int64(3), w.Stats().Rows)
+	assert.Equal(t, 2, w.Stats().Batches)
+
+	columns, err := schema.ListColumns(context.Background(), db, "posts")
+	require.NoError(t, err)
+	require.Len(t, columns, 3)
+	assert.Equal(t, "INTEGER", columns[0].Type)
+	assert.True(t, columns[0].PrimaryKey)
+	assert.Equal(t, "VARCHAR(100)", columns[1].Type)
+	assert.Equal(t, "REAL", columns[2].Type)
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM posts"))
+	assert.Equal(t, 3, count)
+}
+
+func TestTableWriterModes(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, n INTEGER DEFAULT 7)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO t VALUES (1, 'one', 1), (2, 'two', 2)")
+	require.NoError(t, err)
+
+	_, err = NewTableWriter(db, "t", WithMode(ModeUpsert))
+	assert.Error(t, err)
+
+	w, err := NewTableWriter(db, "t", WithMode(ModeUpsert), WithKeys("id"))
+	require.NoError(t, err)
+	writeRows(t, w,
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "deux")),
+		types.NewRow(types.MRP("id", 3), types.MRP("name", "trois")),
+	)
+	assert.False(t, w.Stats().Created)
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM t ORDER BY id"))
+	assert.Equal(t, []string{"one", "deux", "trois"}, names)
+	var ns []int
+	require.NoError(t, db.Select(&ns, "SELECT n FROM t ORDER BY id"))
+	assert.Equal(t, []int{1, 2, 7}, ns)
+
+	w, err = NewTableWriter(db, "t", WithMode(ModeReplace))
+	require.NoError(t, err)
+	writeRows(t, w, types.NewRow(types.MRP("ID", 4), types.MRP("name", "four")))
+	assert.Equal(t, int64(3), w.Stats().Deleted)
+
+	names = nil
+	require.NoError(t, db.Select(&names, "SELECT name FROM t ORDER BY id"))
+	assert.Equal(t, []string{"four"}, names)
+
+	w, err = NewTableWriter(db, "t")
+	require.NoError(t, err)
+	require.NoError(t, w.AddRow(context.Background(), types.NewRow(types.MRP("nope", 1))))
+	assert.Error(t, w.Close(context.Background()))
+}
+
+func TestTableWriterReplaceIsAtomic(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+
+	_, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO t VALUES (1, 'one'), (2, 'two')")
+	require.NoError(t, err)
+
+	// the second batch fails, the deletion and the first batch are rolled back
+	w, err := NewTableWriter(db, "t", WithMode(ModeReplace), WithBatchSize(1))
+	require.NoError(t, err)
+	require.NoError(t, w.AddRow(ctx, types.NewRow(types.MRP("id", 3), types.MRP("name", "three"))))
+	assert.Error(t, w.AddRow(ctx, types.NewRow(types.MRP("id", 4), types.MRP("nope", "four"))))
+	require.NoError(t, w.Abort())
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM t ORDER BY id"))
+	assert.Equal(t, []string{"one", "two"}, names)
+
+	w, err = NewTableWriter(db, "t")
+	require.NoError(t, err)
+	require.NoError(t, w.AddRow(ctx, types.NewRow()))
+	assert.EqualError(t, w.Close(ctx), "can't insert rows without columns into t")
+}
+
+func TestTableWriterFastPath(t *testing.T) {
+	db := createDB(t)
+	defer func() { _ = db.Close() }()
+
+	w, err := NewTableWriter(db, "t", WithCreateTable(false))
+	require.NoError(t, err)
+	require.NoError(t, w.AddRow(context.Background(), types.NewRow(types.MRP("id", 1))))
+	assert.Error(t, w.Close(context.Background()))
+
+	w, err = NewTableWriter(db, "t", WithFastPath(true), WithBatchSize(10), WithKeys("id"), WithMode(ModeUpsert))
+	require.NoError(t, err)
+	rows := []types.Row{}
+	for i := 0; i < 25; i++ {
+		rows = append(rows, types.NewRow(types.MRP("id", i%20), types.MRP("name", "x")))
+	}
+	writeRows(t, w, rows...)
+	assert.Equal(t, int64(25), w.Stats().Rows)
+	assert.Equal(t, 3, w.Stats().Batches)
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM t"))
+	assert.Equal(t, 20, count)
+}
+
+func TestMysqlTSVValue(t *testing.T) {
+	assert.Equal(t, `\N`, mysqlTSVValue(nil))
+	assert.Equal(t, `a\tb\nc\\d`, mysqlTSVValue("a\tb\nc\\d"))
+	assert.Equal(t, "1", mysqlTSVValue(true))
+	assert.Equal(t, "12", mysqlTSVValue(int64(12)))
+}
@@ -0,0 +1,248 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const cursorName = "sqleton_cursor"
+
+// DefaultFetchSize is the default of the --fetch-size flag.
+const DefaultFetchSize = 1000
+
+type Options struct {
+	// FetchSize is the number of rows fetched at once through a server-side cursor on postgres.
+	// 0 reads the whole result set with a single query.
+	FetchSize int
+}
+
+type Option func(*Options)
+
+// ColumnTypesSetter is implemented by processors that need the column types of the result,
+// for example to write typed output. SetColumnTypes is called before the rows of each query are added.
+type ColumnTypesSetter interface {
+	SetColumnTypes(columnTypes []*sql.ColumnType) error
+}
+
+func WithFetchSize(fetchSize int) Option {
+	return func(o *Options) {
+		o.FetchSize = fetchSize
+	}
+}
+
+// RunQueryIntoGlaze runs the query and passes the rows to gp one at a time, as they are read.
+//
+// Rows are only read from the connection once gp has processed the previous one,
+// which keeps memory usage flat for large result sets: the mysql driver reads the result
+// from the connection as rows are requested, and postgres SELECT queries are read through
+// a server-side cursor, FetchSize rows at a time.
+func RunQueryIntoGlaze(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	args []interface{},
+	gp middlewares.Processor,
+	options ...Option,
+) error {
+	o := &Options{}
+	for _, option := range options {
+		option(o)
+	}
+
+	// cancelling the query makes the drivers drop the connection instead of reading
+	// the rest of the result set when we stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if o.FetchSize > 0 && db.DriverName() == "postgres" && isCursorQuery(query) {
+		return runCursor(ctx, cancel, db, query, args, o.FetchSize, gp)
+	}
+
+	// use a prepared statement so that when using mysql, we get native types back
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not prepare query: %s", query)
+	}
+	defer func(stmt *sqlx.Stmt) {
+		_ = stmt.Close()
+	}(stmt)
+
+	rows, err := stmt.QueryxContext(ctx, args...)
+	if err != nil {
+		return errors.Wrapf(err, "could not execute query: %s", query)
+	}
+
+	_, err = processRows(ctx, rows, gp)
+	if err != nil {
+		cancel()
+	}
+	_ = rows.Close()
+	return err
+}
+
+// RunNamedQueryIntoGlaze is RunQueryIntoGlaze for a query with :name parameters, bound to
+// the values in parameters. As with sqlx named queries, :: is an escaped colon, and a parameter
+// missing from parameters is an error.
+func RunNamedQueryIntoGlaze(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	parameters map[string]interface{},
+	gp middlewares.Processor,
+	options ...Option,
+) error {
+	compiled, args, err := sqlx.Named(query, parameters)
+	if err != nil {
+		return errors.Wrapf(err, "could not bind parameters of query: %s", query)
+	}
+	return RunQueryIntoGlaze(ctx, db, db.Rebind(compiled), args, gp, options...)
+}
+
+// runCursor declares a cursor for the query in a transaction and fetches it in chunks of fetchSize rows.
+func runCursor(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	db *sqlx.DB,
+	query string,
+	args []interface{},
+	fetchSize int,
+	gp middlewares.Processor,
+) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not start transaction")
+	}
+	defer func(tx *sqlx.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursorName, query), args...)
+	if err != nil {
+		return errors.Wrapf(err, "could not execute query: %s", query)
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM %s", fetchSize, cursorName)
+	for {
+		rows, err := tx.QueryxContext(ctx, fetch)
+		if err != nil {
+			return errors.Wrapf(err, "could not fetch rows of query: %s", query)
+		}
+		n, err := processRows(ctx, rows, gp)
+		_ = rows.Close()
+		if err != nil {
+			cancel()
+			return err
+		}
+		if n < fetchSize {
+			break
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "CLOSE "+cursorName)
+	if err != nil {
+		return errors.Wrap(err, "could not close cursor")
+	}
+	return tx.Commit()
+}
+
+// processRows passes the rows to gp and returns how many were read.
+func processRows(ctx context.Context, rows *sqlx.Rows, gp middlewares.Processor) (int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get columns")
+	}
+
+	if cts, ok := gp.(ColumnTypesSetter); ok {
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return 0, errors.Wrap(err, "could not get column types")
+		}
+		err = cts.SetColumnTypes(columnTypes)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	values := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	n := 0
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return n, errors.Wrap(err, "could not scan row")
+		}
+
+		row := types.NewRow()
+		for i, col := range cols {
+			switch v := values[i].(type) {
+			case []byte:
+				row.Set(col, string(v))
+			default:
+				row.Set(col, v)
+			}
+		}
+
+		err = gp.AddRow(ctx, row)
+		if err != nil {
+			return n, errors.Wrap(err, "could not process row")
+		}
+		n++
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return n, errors.Wrap(err, "could not read rows")
+	}
+	return n, nil
+}
+
+// isCursorQuery returns true if a cursor can be declared for the query, that is, if it is
+// a SELECT, VALUES or TABLE statement, or a WITH query.
+func isCursorQuery(query string) bool {
+	query = skipComments(query)
+	end := strings.IndexFunc(query, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if end >= 0 {
+		query = query[:end]
+	}
+	switch strings.ToLower(query) {
+	case "select", "with", "values", "table":
+		return true
+	}
+	return false
+}
+
+func skipComments(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(query, "--"):
+			i := strings.Index(query, "\n")
+			if i < 0 {
+				return ""
+			}
+			query = query[i+1:]
+		case strings.HasPrefix(query, "/*"):
+			i := strings.Index(query, "*/")
+			if i < 0 {
+				return ""
+			}
+			query = query[i+2:]
+		default:
+			return query
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// limitProcessor fails once it has received limit rows.
+type limitProcessor struct {
+	rows  []types.Row
+	limit int
+}
+
+func (p *limitProcessor) AddRow(ctx context.Context, row types.Row) error {
+	if len(p.rows) == p.limit {
+		return errors.New("limit reached")
+	}
+	p.rows = append(p.rows, row)
+	return nil
+}
+
+func (p *limitProcessor) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestRunQueryIntoGlaze(t *testing.T) {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE posts (id INTEGER, title TEXT, body BLOB)`)
+	require.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		_, err = db.Exec(`INSERT INTO posts VALUES (?, ?, ?)`, i, "post", []byte("body"))
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	gp := &limitProcessor{limit: 100}
+	err = RunQueryIntoGlaze(ctx, db, "SELECT id, title, body FROM posts WHERE id > ?", []interface{}{7}, gp,
+		WithFetchSize(2))
+	require.NoError(t, err)
+	require.Len(t, gp.rows, 3)
+	assert.Equal(t, "id", gp.rows[0].Oldest().Key)
+	v, _ := gp.rows[0].Get("id")
+	assert.Equal(t, int64(8), v)
+	v, _ = gp.rows[2].Get("body")
+	assert.Equal(t, "body", v)
+
+	gp = &limitProcessor{limit: 4}
+	err = RunQueryIntoGlaze(ctx, db, "SELECT id FROM posts", nil, gp)
+	assert.Error(t, err)
+	assert.Len(t, gp.rows, 4)
+
+	// the connection is usable after stopping early
+	gp = &limitProcessor{limit: 100}
+	require.NoError(t, RunQueryIntoGlaze(ctx, db, "SELECT COUNT(*) AS n FROM posts", nil, gp))
+	v, _ = gp.rows[0].Get("n")
+	assert.Equal(t, int64(10), v)
+}
+
+func TestIsCursorQuery(t *testing.T) {
+	assert.True(t, isCursorQuery("SELECT 1"))
+	assert.True(t, isCursorQuery("  -- comment\n/* other */ with a as (select 1) select * from a"))
+	assert.True(t, isCursorQuery("(SELECT 1) UNION (SELECT 2)"))
+	assert.False(t, isCursorQuery("SHOW TABLES"))
+	assert.False(t, isCursorQuery("EXPLAIN SELECT 1"))
+	assert.False(t, isCursorQuery("INSERT INTO t SELECT 1"))
+	assert.False(t, isCursorQuery("-- only a comment"))
+}
+
+func TestRunNamedQueryIntoGlaze(t *testing.T) {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	gp := &limitProcessor{limit: 100}
+	err = RunNamedQueryIntoGlaze(ctx, db, "SELECT :id AS id, 'a::b' AS s", map[string]interface{}{"id": 3}, gp)
+	require.NoError(t, err)
+	require.Len(t, gp.rows, 1)
+	v, _ := gp.rows[0].Get("id")
+	assert.Equal(t, int64(3), v)
+	v, _ = gp.rows[0].Get("s")
+	assert.Equal(t, "a:b", v)
+
+	// unbound parameters fail instead of being passed to the database as NULL
+	err = RunNamedQueryIntoGlaze(ctx, db, "SELECT :id AS id", map[string]interface{}{}, &limitProcessor{limit: 100})
+	assert.ErrorContains(t, err, "could not find name id")
+}